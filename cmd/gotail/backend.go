@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// backends the file change notification backends that can be given with
+// --backend
+var backends = []string{"auto", "inotify", "kqueue", "poll"}
+
+// checkBackend return an error if backend is unknown or not available on this
+// platform
+func checkBackend(backend string) error {
+	switch backend {
+	case "auto", "poll", nativeBackend:
+		return nil
+	}
+	for _, known := range backends {
+		if backend == known {
+			return fmt.Errorf("--backend %s is not available on %s", backend, runtime.GOOS)
+		}
+	}
+
+	return fmt.Errorf("unknown --backend %q, expected auto, inotify, kqueue, or poll", backend)
+}
+
+// resolveBackend get the backend to use for backend. Changes to files are
+// polled for on Windows unless a backend is given, as notification there
+// doesn't work reliably for files that are held open by the programs writing
+// to them.
+func resolveBackend(backend string) string {
+	if backend == "auto" && runtime.GOOS == "windows" {
+		return "poll"
+	}
+
+	return backend
+}
+
+// maxFiles the number of files that can be followed with limit open files.
+// kqueue needs a descriptor for each watch as well as for the file itself.
+func maxFiles(limit uint64, backend string) uint64 {
+	if backend != "poll" && nativeBackend == "kqueue" {
+		return limit / 2
+	}
+
+	return limit
+}
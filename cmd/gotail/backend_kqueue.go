@@ -0,0 +1,7 @@
+//go:build darwin || freebsd || openbsd || netbsd || dragonfly
+// +build darwin freebsd openbsd netbsd dragonfly
+
+package main
+
+// nativeBackend the file change notification backend used unless polling
+const nativeBackend = "kqueue"
@@ -0,0 +1,4 @@
+package main
+
+// nativeBackend the file change notification backend used unless polling
+const nativeBackend = "inotify"
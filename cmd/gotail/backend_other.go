@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !openbsd && !netbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!openbsd,!netbsd,!dragonfly
+
+package main
+
+// nativeBackend the file change notification backend used unless polling.
+// Other platforms have no backend that can be chosen by name.
+const nativeBackend = ""
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imarsman/gotail/internal/input"
+	"github.com/imarsman/gotail/internal/util"
+)
+
+/*
+	gotail bench times gotail on the files given: printing the last -n lines,
+	the first -n lines, every line, and lines appended to a followed file.
+	Each is run as a process of its own writing to the null device, as timing
+	gotail by hand with time does, and the fastest of --runs runs is reported.
+	With --compare the system's tail and head are timed doing the same. Runs
+	use the config file and GOTAIL_* variables as any other run would.
+	Following is timed from appending lines to a followed file to all of them
+	being printed, so its rate includes the limit set with --rate-capacity and
+	--rate-interval.
+*/
+
+const (
+	benchSettle        = 500 * time.Millisecond // wait for a follower to open its file
+	benchFollowTimeout = 2 * time.Minute        // longest wait for followed lines
+)
+
+// benchOptions settings for gotail bench
+type benchOptions struct {
+	gotail      string // gotail executable timed
+	numLines    int
+	runs        int  // runs of each, with the fastest reported
+	compare     bool // also time the system's tail and head
+	followLines int  // lines appended to a followed file, 0 to not time following
+}
+
+// benchCase work timed on a file by gotail and by the system command doing
+// the same
+type benchCase struct {
+	name   string
+	gotail []string
+	system []string
+	whole  bool // whether the whole file is read, so a rate can be given
+}
+
+// benchResult times for a case, with 0 for one not timed
+type benchResult struct {
+	name           string
+	gotail, system time.Duration
+	rate           func(time.Duration) string
+}
+
+// benchCases get the work timed for path
+func benchCases(path string, numLines int) []benchCase {
+	n := strconv.Itoa(numLines)
+	return []benchCase{
+		{name: "tail -n " + n, gotail: []string{"-n", n, path}, system: []string{"tail", "-n", n, path}},
+		{name: "head -n " + n, gotail: []string{"-H", "-n", n, path}, system: []string{"head", "-n", n, path}},
+		{name: "all lines", gotail: []string{"-H", "-n", "+1", path}, system: []string{"tail", "-n", "+1", path}, whole: true},
+	}
+}
+
+// benchTime get the fastest of runs runs of command, its output discarded
+func benchTime(command []string, runs int) (best time.Duration, err error) {
+	for i := 0; i < runs; i++ {
+		cmd := exec.Command(command[0], command[1:]...)
+		// A nil Stdout is the null device
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		start := time.Now()
+		if err = cmd.Run(); err != nil {
+			return 0, fmt.Errorf("%s: %v %s", strings.Join(command, " "), err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		if took := time.Since(start); i == 0 || took < best {
+			best = took
+		}
+	}
+
+	return
+}
+
+// benchFollow time command, following a new file given as its last argument,
+// printing the lines of content once they are appended to the file
+func benchFollow(command []string, content []byte) (time.Duration, error) {
+	lines := bytes.Count(content, []byte("\n"))
+	if lines == 0 {
+		return 0, errors.New("no lines to follow")
+	}
+	dir, err := os.MkdirTemp("", "gotail-bench")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "follow.log")
+	if err = os.WriteFile(path, nil, 0644); err != nil {
+		return 0, err
+	}
+
+	cmd := exec.Command(command[0], append(command[1:], path)...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err = cmd.Start(); err != nil {
+		return 0, err
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	time.Sleep(benchSettle)
+
+	done := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 64*1024)
+		var seen int
+		for seen < lines {
+			n, err := out.Read(buf)
+			seen += bytes.Count(buf[:n], []byte("\n"))
+			if err != nil {
+				done <- fmt.Errorf("%s stopped after %d of %d lines: %v", command[0], seen, lines, err)
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	start := time.Now()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	_, err = file.Write(content)
+	file.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	timer := time.NewTimer(benchFollowTimeout)
+	defer timer.Stop()
+	select {
+	case err = <-done:
+		return time.Since(start), err
+	case <-timer.C:
+		return 0, fmt.Errorf("%s didn't print %d followed lines within %s", command[0], lines, benchFollowTimeout)
+	}
+}
+
+// formatBench format a time and, if there is one, a rate, with - for none
+func formatBench(took time.Duration, rate func(time.Duration) string) string {
+	if took == 0 {
+		return "-"
+	}
+	s := took.Round(time.Microsecond).String()
+	if rate != nil {
+		s += " (" + rate(took) + ")"
+	}
+
+	return s
+}
+
+// writeBench write the results for a file as a table
+func writeBench(w io.Writer, path string, size int64, results []benchResult, compare bool) {
+	fmt.Fprintf(w, "%s (%s)\n", path, util.FormatSize(size))
+	for _, r := range results {
+		if compare {
+			fmt.Fprintf(w, "  %-14s gotail %-28s system %s\n", r.name, formatBench(r.gotail, r.rate), formatBench(r.system, r.rate))
+			continue
+		}
+		fmt.Fprintf(w, "  %-14s gotail %s\n", r.name, formatBench(r.gotail, r.rate))
+	}
+}
+
+// runBench time gotail on every file matching patterns, writing a report to w
+func runBench(w io.Writer, patterns []string, opts benchOptions) error {
+	if opts.runs < 1 {
+		return errors.New("--runs must be at least 1")
+	}
+	if opts.followLines < 0 {
+		return errors.New("--follow-lines can't be negative")
+	}
+	files, err := expandGlobs(patterns)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no files match %s", strings.Join(patterns, " "))
+	}
+
+	// Commands not found are left out of the comparison
+	found := func(command string) bool {
+		_, err := exec.LookPath(command)
+		return opts.compare && err == nil
+	}
+
+	for i, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		size := info.Size()
+		bytesRate := func(took time.Duration) string {
+			return util.FormatSize(int64(float64(size)/took.Seconds())) + "/s"
+		}
+
+		var results []benchResult
+		for _, c := range benchCases(path, opts.numLines) {
+			r := benchResult{name: c.name}
+			if c.whole {
+				r.rate = bytesRate
+			}
+			if r.gotail, err = benchTime(append([]string{opts.gotail}, c.gotail...), opts.runs); err != nil {
+				return err
+			}
+			if found(c.system[0]) {
+				if r.system, err = benchTime(c.system, opts.runs); err != nil {
+					return err
+				}
+			}
+			results = append(results, r)
+		}
+
+		if opts.followLines > 0 {
+			lines, _, err := input.GetLines(path, true, false, opts.followLines)
+			if err != nil {
+				return err
+			}
+			if len(lines) > 0 {
+				content := []byte(strings.Join(lines, "\n") + "\n")
+				r := benchResult{
+					name: "follow " + strconv.Itoa(len(lines)),
+					rate: func(took time.Duration) string {
+						return strconv.Itoa(int(float64(len(lines))/took.Seconds())) + " lines/s"
+					},
+				}
+				if r.gotail, err = benchFollow([]string{opts.gotail, "-f", "-n", "0"}, content); err != nil {
+					return err
+				}
+				if found("tail") {
+					if r.system, err = benchFollow([]string{"tail", "-f", "-n", "0"}, content); err != nil {
+						return err
+					}
+				}
+				results = append(results, r)
+			}
+		}
+
+		writeBench(w, path, size, results, opts.compare)
+	}
+
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/imarsman/gotail/cmd/internal/args"
+	"github.com/posener/complete/v2"
+	"github.com/posener/complete/v2/predict"
+)
+
+// containerRuntimes runtimes that can be used for --container sources
+var containerRuntimes = []string{"docker", "podman", "nerdctl", "kubectl"}
+
+// logFilePredictors predict files that are likely to be logs and directories
+// to look for them in
+var logFilePredictors = []complete.Predictor{
+	predict.Files("*.log"),
+	predict.Files("*.txt"),
+	predict.Files("*.gz"),
+	predict.Files("*.bz2"),
+	predict.Dirs("*"),
+	predict.Set{"/var/log/"},
+}
+
+// predictLogFiles combine log file predictions without the duplicate
+// directories each file predictor adds
+func predictLogFiles(prefix string) (options []string) {
+	seen := map[string]bool{}
+	for _, p := range logFilePredictors {
+		for _, option := range p.Predict(prefix) {
+			if !seen[option] {
+				seen[option] = true
+				options = append(options, option)
+			}
+		}
+	}
+
+	return
+}
+
+// predictContainers predict NAME: prefixes for --container using the names of
+// running containers. Nothing is predicted if the runtime isn't available.
+func predictContainers(prefix string) (options []string) {
+	runtime := args.Args.ContainerRuntime
+	if runtime == "" {
+		runtime = "docker"
+	}
+
+	var command []string
+	switch runtime {
+	case "kubectl":
+		command = []string{runtime, "get", "pods", "-o", "name"}
+	default:
+		command = []string{runtime, "ps", "--format", "{{.Names}}"}
+	}
+
+	// Don't hold up the shell if the runtime is slow to respond
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, command[0], command[1:]...).Output()
+	if err != nil {
+		return
+	}
+	for _, name := range strings.Fields(string(out)) {
+		options = append(options, strings.TrimPrefix(name, "pod/")+":")
+	}
+
+	return
+}
+
+// completionCommand describe flags and the values they can take for shell
+// completion. Commands that only stand for flags share the flags of the
+// command itself.
+func completionCommand() *complete.Command {
+	cmd := &complete.Command{
+		Sub: map[string]*complete.Command{
+			"diff": {
+				Flags: map[string]complete.Predictor{
+					"state-file": predict.Files("*.json"),
+				},
+				Args: complete.PredictFunc(predictLogFiles),
+			},
+			"bench": {
+				Flags: map[string]complete.Predictor{
+					"runs":         predict.Set{"1", "5", "10"},
+					"compare":      predict.Nothing,
+					"follow-lines": predict.Set{"0", "1000", "10000"},
+				},
+				Args: complete.PredictFunc(predictLogFiles),
+			},
+			"gen": {
+				Flags: map[string]complete.Predictor{
+					"rate":         predict.Set{"10", "100", "1000"},
+					"count":        predict.Something,
+					"json":         predict.Nothing,
+					"format":       predict.Set{"text", "json", "logfmt"},
+					"file":         predict.Files("*"),
+					"rotate":       predict.Set{"1MB", "10MB", "100MB"},
+					"copytruncate": predict.Nothing,
+					"seed":         predict.Something,
+				},
+				Args: predict.Files("*"),
+			},
+			"snapshot": {
+				Flags: map[string]complete.Predictor{
+					"numlines":   predict.Something,
+					"output-dir": predict.Dirs("*"),
+					"tar":        predict.Files("*.tar*"),
+				},
+				Args: complete.PredictFunc(predictLogFiles),
+			},
+		},
+		Flags: map[string]complete.Predictor{
+			"nocolour":            predict.Nothing,
+			"color":               predict.Set{"always", "auto", "never"},
+			"follow":              predict.Nothing,
+			"followname":          predict.Nothing,
+			"numlines":            predict.Something,
+			"bytes":               predict.Something,
+			"printextra":          predict.Nothing,
+			"linenumbers":         predict.Nothing,
+			"number-start":        predict.Set{"0", "1"},
+			"number-separator":    predict.Something,
+			"json":                predict.Nothing,
+			"json-only":           predict.Nothing,
+			"keep-key-order":      predict.Nothing,
+			"match":               predict.Something,
+			"highlight":           predict.Something,
+			"rule":                predict.Something,
+			"exclude":             predict.Something,
+			"group-dirs":          predict.Nothing,
+			"strict":              predict.Nothing,
+			"heartbeat":           predict.Something,
+			"max-line-length":     predict.Something,
+			"truncate":            predict.Something,
+			"wrap":                predict.Something,
+			"explode-array":       predict.Nothing,
+			"validate-json":       predict.Nothing,
+			"quiet":               predict.Nothing,
+			"verbose":             predict.Nothing,
+			"dir":                 predict.Dirs("*"),
+			"max-memory":          predict.Something,
+			"recheck":             predict.Set{"notify", "interval"},
+			"since":               predict.Something,
+			"until":               predict.Something,
+			"copy-match":          predict.Nothing,
+			"no-scroll-interrupt": predict.Nothing,
+			"squash-repeats":      predict.Nothing,
+			"squash-timeout":      predict.Set{"1s", "2s", "10s"},
+			"schema":              predict.Files("*.json"),
+			"schema-invalid":      predict.Nothing,
+			"check-order":         predict.Nothing,
+			"clock-jump":          predict.Set{"1m", "10m", "1h"},
+			"script":              predict.Files("*.lua"),
+			"hash-field":          predict.Something,
+			"hash-key":            predict.Something,
+			"head":                predict.Nothing,
+			"interval":            predict.Something,
+			"format-hint":         predict.Set{"auto", "json", "logfmt", "access", "plain"},
+			"container":           complete.PredictFunc(predictContainers),
+			"container-runtime":   predict.Set(containerRuntimes),
+			"cmd":                 predict.Something,
+			"fd":                  predict.Set{"3", "4", "5"},
+			"metrics-addr":        predict.Something,
+			"metrics-tls-cert":    predict.Files("*"),
+			"metrics-tls-key":     predict.Files("*"),
+			"metrics-client-ca":   predict.Files("*"),
+			"metrics-token":       predict.Something,
+			"metrics-allow":       predict.Something,
+			"stream":              predict.Nothing,
+			"stream-replay":       predict.Something,
+			"stall-warning":       predict.Set{"1m", "5m", "10m", "30m", "1h"},
+			"summary-every":       predict.Set{"10s", "1m", "5m"},
+			"exit-on-eof":         predict.Nothing,
+			"follow-stdin":        predict.Nothing,
+			"watch-interval":      predict.Set{"1s", "2s", "5s"},
+			"watch-diff":          predict.Nothing,
+			"ring":                predict.Something,
+			"ring-dir":            predict.Dirs("*"),
+			"start-offset":        predict.Something,
+			"end-offset":          predict.Something,
+			"forward":             predict.Set{"tcp://", "udp://", "unix://", "unixgram://"},
+			"forward-only":        predict.Nothing,
+			"forward-queue":       predict.Files("*"),
+			"forward-queue-size":  predict.Set{"16MB", "64MB", "256MB", "1GB"},
+			"forward-drop":        predict.Set{"newest", "oldest"},
+			"sleep-interval":      predict.Set{"250ms", "1s", "5s"},
+			"rate-capacity":       predict.Something,
+			"rate-interval":       predict.Set{"1ms", "10ms", "100ms"},
+			"backend":             predict.Set(backends),
+			"sandbox":             predict.Something,
+			"sticky-header":       predict.Set{"top", "bottom"},
+			"file-colours":        predict.Nothing,
+			"file-bar":            predict.Nothing,
+			"alias":               predict.Something,
+			"short-names":         predict.Set{"none", "base", "prefix"},
+			"host-column":         predict.Nothing,
+			"prefix-filename":     predict.Nothing,
+			"canonical":           predict.Nothing,
+			"output":              predict.Set{"text", "json", "ndjson"},
+			"fallback-time":       predict.Set{"none", "received", "mtime"},
+			"config":              predict.Files("*.json"),
+			"profile":             complete.PredictFunc(predictProfiles),
+			"files":               complete.PredictFunc(predictLogFiles),
+		},
+		Args: complete.PredictFunc(predictLogFiles),
+	}
+	for _, name := range []string{"tail", "head", "follow", "serve", "agent"} {
+		cmd.Sub[name] = &complete.Command{
+			Flags: cmd.Flags,
+			Args:  complete.PredictFunc(predictLogFiles),
+		}
+	}
+
+	return cmd
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/imarsman/gotail/cmd/gotail/output"
+	"github.com/imarsman/gotail/internal/config"
+	"github.com/imarsman/gotail/internal/util"
+)
+
+// startBytes the number of bytes at the start of a file used to tell whether
+// it has been replaced, such as by log rotation
+const startBytes = 256
+
+// diffState what is known about each file at the end of the last diff
+type diffState struct {
+	Files map[string]*fileState `json:"files"`
+}
+
+// fileState how far a file has been read and a hash of its first bytes
+type fileState struct {
+	Offset      int64  `json:"offset"`
+	Start       string `json:"start"`
+	StartLength int64  `json:"startlength"`
+}
+
+// loadDiffState read the state file at path. A missing file gives an empty
+// state.
+func loadDiffState(path string) (*diffState, error) {
+	state := &diffState{Files: map[string]*fileState{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, err
+	}
+	if state.Files == nil {
+		state.Files = map[string]*fileState{}
+	}
+
+	return state, nil
+}
+
+// save write the state to path, replacing it in one step so that an
+// interrupted run doesn't leave a partial file
+func (s *diffState) save(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// startHash get a hash of the first n bytes of file
+func startHash(file *os.File, n int64) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(file, 0, n)); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// newLines get the complete lines added to the file at path since the offset
+// in previous, along with the state to keep for the next run. A file seen for
+// the first time gives no lines. A file that is shorter than before or whose
+// first bytes have changed has been replaced and is read from the start. A
+// partial last line is left for the next run.
+func newLines(path string, previous *fileState) (lines []string, state *fileState, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return
+	}
+	size := fi.Size()
+	n := int64(startBytes)
+	if size < n {
+		n = size
+	}
+	start, err := startHash(file, n)
+	if err != nil {
+		return
+	}
+
+	state = &fileState{Start: start, StartLength: n}
+	source := config.ForPath(path)
+	if previous == nil {
+		// Start the next run after the last complete line
+		tail := int64(64 * 1024)
+		if size < tail {
+			tail = size
+		}
+		b := make([]byte, tail)
+		if _, err = file.ReadAt(b, size-tail); err != nil && err != io.EOF {
+			return
+		}
+		state.Offset = size - tail + int64(source.LineEnd(b))
+		return nil, state, nil
+	}
+
+	offset := previous.Offset
+	replaced := size < offset
+	if !replaced {
+		// Compare the same number of bytes as were hashed last time
+		check := start
+		if previous.StartLength != n {
+			if check, err = startHash(file, previous.StartLength); err != nil {
+				return
+			}
+		}
+		replaced = check != previous.Start
+	}
+	if replaced {
+		offset = 0
+	}
+
+	b := make([]byte, size-offset)
+	if _, err = file.ReadAt(b, offset); err != nil && err != io.EOF {
+		return
+	}
+	end := source.LineEnd(b)
+	if end > 0 {
+		text, _ := io.ReadAll(source.NewReader(bytes.NewReader(b[:end])))
+		for _, line := range strings.Split(strings.TrimSuffix(string(text), "\n"), "\n") {
+			lines = append(lines, strings.TrimSuffix(line, "\r"))
+		}
+	}
+	state.Offset = offset + int64(end)
+
+	return lines, state, nil
+}
+
+// runDiff print the lines added to files matching patterns since the last run
+// with the same state file, then record how far each file has been read.
+// Lines go through the output pipeline as for a tail. Files seen for the
+// first time are recorded without printing anything.
+func runDiff(w io.Writer, patterns []string, statePath string) error {
+	state, err := loadDiffState(statePath)
+	if err != nil {
+		return fmt.Errorf("reading state file %s: %v", statePath, err)
+	}
+	files, err := expandGlobs(patterns)
+	if err != nil {
+		return err
+	}
+
+	var printed bool
+	for _, path := range files {
+		lines, fs, err := newLines(path, state.Files[path])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			continue
+		}
+		state.Files[path] = fs
+		if len(lines) == 0 {
+			continue
+		}
+
+		if len(files) > 1 && !output.Records() {
+			if printed {
+				fmt.Fprintln(w)
+			}
+			name := output.SourceName(path)
+			fmt.Fprintln(w, output.Colour(output.HeaderColour(path), fmt.Sprintf("==> %s - %d new %s <==", name, len(lines), util.Pluralize("line", "lines", len(lines)))))
+		}
+		printed = true
+		output.WriteLines(w, path, lines)
+	}
+
+	return state.save(statePath)
+}
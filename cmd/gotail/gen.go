@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+	gotail gen writes made up log lines at a steady rate so that following,
+	rotation and rate limits can be tried out without a busy service. Lines
+	look like those of a web service, as plain text, JSON or logfmt, and the same seed
+	gives the same lines apart from their timestamps. With --rotate the file
+	is renamed to PATH.1 and started again once it reaches the size given, or
+	with --copytruncate it is copied to PATH.1 and truncated in place as
+	logrotate's copytruncate does.
+*/
+
+// genOptions settings for gotail gen
+type genOptions struct {
+	rate         int    // lines a second
+	count        int    // lines to write before stopping, 0 for no limit
+	format       string // text, json or logfmt
+	rotate       int64  // size the file is rotated at, 0 for never
+	copyTruncate bool   // rotate by copying and truncating rather than renaming
+	seed         int64
+}
+
+var (
+	genLevels  = []string{"INFO", "INFO", "INFO", "INFO", "INFO", "INFO", "INFO", "INFO", "DEBUG", "WARN", "ERROR"}
+	genMethods = []string{"GET", "GET", "GET", "POST", "PUT", "DELETE"}
+	genPaths   = []string{"/api/users", "/api/orders", "/api/search", "/health", "/login", "/static/app.js"}
+	genStatus  = map[string][]int{
+		"DEBUG": {200},
+		"INFO":  {200, 200, 201, 204, 304},
+		"WARN":  {400, 401, 404, 429},
+		"ERROR": {500, 502, 503},
+	}
+	genMessages = map[string][]string{
+		"DEBUG": {"cache hit", "query planned", "session refreshed"},
+		"INFO":  {"request handled", "request handled", "user signed in"},
+		"WARN":  {"slow request", "rate limited", "retrying upstream"},
+		"ERROR": {"upstream timed out", "connection refused", "unexpected EOF from database"},
+	}
+)
+
+// genFormats the forms gen can write lines in
+var genFormats = map[string]bool{"text": true, "json": true, "logfmt": true}
+
+// genLine make up a log line for now in format
+func genLine(r *rand.Rand, now time.Time, format string) string {
+	level := genLevels[r.Intn(len(genLevels))]
+	method := genMethods[r.Intn(len(genMethods))]
+	path := genPaths[r.Intn(len(genPaths))]
+	statuses := genStatus[level]
+	status := statuses[r.Intn(len(statuses))]
+	messages := genMessages[level]
+	message := messages[r.Intn(len(messages))]
+	duration := 1 + r.Intn(40)
+	if level == "WARN" || level == "ERROR" {
+		duration = 200 + r.Intn(5000)
+	}
+	user := 1000 + r.Intn(9000)
+	timestamp := now.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+
+	switch format {
+	case "text":
+		return fmt.Sprintf("%s %-5s %s %s %d %dms user=%d %s", timestamp, level, method, path, status, duration, user, message)
+	case "logfmt":
+		return fmt.Sprintf("time=%s level=%s method=%s path=%s status=%d duration_ms=%d user=%d msg=%q", timestamp, strings.ToLower(level), method, path, status, duration, user, message)
+	}
+	b, _ := json.Marshal(struct {
+		Time     string `json:"time"`
+		Level    string `json:"level"`
+		Method   string `json:"method"`
+		Path     string `json:"path"`
+		Status   int    `json:"status"`
+		Duration int    `json:"duration_ms"`
+		User     int    `json:"user"`
+		Message  string `json:"msg"`
+	}{timestamp, level, method, path, status, duration, user, message})
+
+	return string(b)
+}
+
+// runGen write made up lines to path until opts.count lines have been
+// written, or for ever if it is 0
+func runGen(path string, opts genOptions) error {
+	if opts.rate < 1 {
+		return errors.New("--rate must be at least 1")
+	}
+	if !genFormats[opts.format] {
+		return fmt.Errorf("unknown --format %q, use text, json or logfmt", opts.format)
+	}
+	if opts.count < 0 {
+		return errors.New("--count can't be negative")
+	}
+	if opts.copyTruncate && opts.rotate == 0 {
+		return errors.New("--copytruncate needs --rotate")
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		file.Close()
+	}()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	r := rand.New(rand.NewSource(opts.seed))
+	// Lines are written in batches every tick, or one a tick when the rate is
+	// low, so that high rates don't need a tick for every line
+	tick := time.Second / time.Duration(opts.rate)
+	if tick < 10*time.Millisecond {
+		tick = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	start := time.Now()
+	var written int
+	var batch []byte
+	for opts.count == 0 || written < opts.count {
+		due := int(time.Since(start).Seconds()*float64(opts.rate)) + 1
+		if opts.count > 0 && due > opts.count {
+			due = opts.count
+		}
+		now := time.Now()
+		for ; written < due; written++ {
+			batch = append(batch[:0], genLine(r, now, opts.format)...)
+			batch = append(batch, '\n')
+			if opts.rotate > 0 && size+int64(len(batch)) > opts.rotate && size > 0 {
+				if file, err = genRotate(file, path, opts.copyTruncate); err != nil {
+					return err
+				}
+				size = 0
+			}
+			// Each line is written whole so readers never see part of one
+			if _, err = file.Write(batch); err != nil {
+				return err
+			}
+			size += int64(len(batch))
+		}
+		if opts.count > 0 && written >= opts.count {
+			break
+		}
+		<-ticker.C
+	}
+
+	return nil
+}
+
+// genRotate move the lines in file at path to path.1 and get the file to
+// write to next
+func genRotate(file *os.File, path string, copyTruncate bool) (*os.File, error) {
+	if copyTruncate {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return file, err
+		}
+		if err = os.WriteFile(path+".1", content, 0644); err != nil {
+			return file, err
+		}
+		// Writes are appended so they go to the new end of the file
+		return file, file.Truncate(0)
+	}
+
+	file.Close()
+	if err := os.Rename(path, path+".1"); err != nil {
+		return nil, err
+	}
+
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+}
@@ -4,17 +4,34 @@
 package main
 
 import (
+	"os"
+	"os/signal"
 	"syscall"
 )
 
-// setrlimit set files limit
-func setrlimit(limit uint64) (err error) {
+// notifyDump send SIGUSR1 to c, which asks for the summary while following
+func notifyDump(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
+
+// notifyRing send SIGUSR2 to c, which asks for the lines kept by --ring to be
+// written to a file
+func notifyRing(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR2)
+}
+
+// setrlimit set files limit. The limit is kept to the hard limit as BSDs and
+// macOS refuse a soft limit above it. Return the limit in effect afterward.
+func setrlimit(limit uint64) (applied uint64, err error) {
 	var rLimit syscall.Rlimit
 	err = syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rLimit)
 	if err != nil {
 		return
 	}
-	rLimit.Cur = limit
+	if max := rlimitMax(&rLimit); limit > max {
+		limit = max
+	}
+	setRlimitCur(&rLimit, limit)
 	err = syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rLimit)
 	if err != nil {
 		return
@@ -23,5 +40,7 @@ func setrlimit(limit uint64) (err error) {
 	if err != nil {
 		return
 	}
+	applied = rlimitCur(&rLimit)
+
 	return
 }
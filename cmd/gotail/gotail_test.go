@@ -1,7 +1,15 @@
 package main
 
 import (
+	"encoding/json"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 //                Tests and benchmarks
@@ -53,7 +61,468 @@ func init() {
 }
 
 func TestRLimit(t *testing.T) {
-	t.Logf("Limit %+v", setrlimit(1000))
+	applied, err := setrlimit(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("Limit %+v", applied)
+}
+
+func TestCheckBackend(t *testing.T) {
+	for _, backend := range []string{"auto", "poll"} {
+		if err := checkBackend(backend); err != nil {
+			t.Errorf("%s: %v", backend, err)
+		}
+	}
+	if err := checkBackend("epoll"); err == nil {
+		t.Error("expected error for unknown backend")
+	}
+	if resolveBackend("auto") == "poll" && runtime.GOOS != "windows" {
+		t.Error("only Windows should poll by default")
+	}
+	if maxFiles(1000, "poll") != 1000 {
+		t.Error("polling should not reduce the files that can be followed")
+	}
+}
+
+func TestGroupByDir(t *testing.T) {
+	paths := []string{"/b/1.log", "/a/1.log", "/b/2.log", "/c/1.log", "/a/2.log"}
+	want := []string{"/b/1.log", "/b/2.log", "/a/1.log", "/a/2.log", "/c/1.log"}
+	if got := groupByDir(paths); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("groupByDir(%v) = %v", paths, got)
+	}
+}
+
+func TestMissingFile(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "a.log")
+	if err := os.WriteFile(existing, []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, pattern := range []string{existing, filepath.Join(dir, "*.log"), filepath.Join(dir, "[b].log")} {
+		if _, err := missingFile(pattern); err != nil {
+			t.Errorf("missingFile(%q) = %v, want nil", pattern, err)
+		}
+	}
+	missing := filepath.Join(dir, "b.log")
+	path, err := missingFile(missing)
+	if !os.IsNotExist(err) {
+		t.Errorf("missingFile(%q) = %v, want not exist", missing, err)
+	}
+	if path != missing {
+		t.Errorf("missingFile(%q) path = %q", missing, path)
+	}
+}
+
+// TestMissingFileHeaders run gotail on a missing and an existing file. The
+// test runs itself again to call main with the arguments after --.
+func TestMissingFileHeaders(t *testing.T) {
+	if os.Getenv("GOTAIL_TEST_MAIN") == "1" {
+		for i, a := range os.Args {
+			if a == "--" {
+				os.Args = append([]string{"gotail"}, os.Args[i+1:]...)
+				break
+			}
+		}
+		main()
+		os.Exit(0)
+	}
+
+	dir := t.TempDir()
+	missing, existing := filepath.Join(dir, "missing.log"), filepath.Join(dir, "a.log")
+	if err := os.WriteFile(existing, []byte("1\n2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestMissingFileHeaders$", "--", "-n", "1", missing, existing)
+	cmd.Env = append(os.Environ(), "GOTAIL_TEST_MAIN=1")
+	var stdout, stderr strings.Builder
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() != 1 {
+		t.Errorf("exit status = %v, want 1", err)
+	}
+	if want := "==> " + existing + " - tail 1 of 2 lines <==\n2\n"; stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+	if want := "stat " + missing + ": no such file or directory\n"; stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+}
+
+func TestTailStart(t *testing.T) {
+	for _, c := range []struct {
+		data string
+		n    int
+		want string
+	}{
+		{"a\nb\nc\n", 2, "b\nc\n"},
+		{"a\nb\nc", 2, "b\nc"},
+		{"a\nb\nc\n", 5, "a\nb\nc\n"},
+		{"a\nb\nc\n", 0, ""},
+		{"\n\n\n", 1, "\n"},
+		{"", 3, ""},
+	} {
+		start, err := tailStart(strings.NewReader(c.data), int64(len(c.data)), c.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.data[start:]; got != c.want {
+			t.Errorf("tailStart(%q, %d) = %q, want %q", c.data, c.n, got, c.want)
+		}
+	}
+}
+
+func TestRunStrict(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	os.WriteFile(a, []byte("1\n2\n3\n"), 0644)
+	os.WriteFile(b, []byte("x\ny"), 0644)
+
+	for _, c := range []struct {
+		names         []string
+		head, atStart bool
+		n             int
+		want          string
+	}{
+		{[]string{b}, false, false, 1, "y"},
+		{[]string{a, b}, false, false, 1, "==> " + a + " <==\n3\n\n==> " + b + " <==\ny"},
+		{[]string{a}, true, false, 2, "1\n2\n"},
+		{[]string{a}, true, true, 2, "2\n3\n"},
+		{[]string{a, b}, false, false, 0, ""},
+	} {
+		var out strings.Builder
+		_, failed := runStrict(&out, c.names, len(c.names) > 1, c.head, c.atStart, c.n, false)
+		if failed || out.String() != c.want {
+			t.Errorf("runStrict(%v, %v, %v, %d) = %q, %v, want %q", c.names, c.head, c.atStart, c.n, out.String(), failed, c.want)
+		}
+	}
+
+	var out strings.Builder
+	if _, failed := runStrict(&out, []string{filepath.Join(dir, "missing"), a}, true, false, false, 1, false); !failed {
+		t.Error("runStrict with a missing file did not fail")
+	}
+	if want := "==> " + a + " <==\n3\n"; out.String() != want {
+		t.Errorf("runStrict with a missing file = %q, want %q", out.String(), want)
+	}
+}
+
+func TestRunStrictBytes(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	os.WriteFile(a, []byte("12345\n"), 0644)
+	os.WriteFile(b, []byte("xy"), 0644)
+
+	for _, c := range []struct {
+		names         []string
+		head, atStart bool
+		n             int
+		want          string
+	}{
+		{[]string{a}, false, false, 3, "45\n"},
+		{[]string{b}, false, false, 10, "xy"},
+		{[]string{a, b}, false, false, 1, "==> " + a + " <==\n\n\n==> " + b + " <==\ny"},
+		{[]string{a}, true, false, 2, "12"},
+		{[]string{a}, true, true, 5, "5\n"},
+		{[]string{a}, true, true, 0, "12345\n"},
+		{[]string{a}, true, true, 10, ""},
+		{[]string{a}, false, false, 0, ""},
+	} {
+		var out strings.Builder
+		_, failed := runStrict(&out, c.names, len(c.names) > 1, c.head, c.atStart, c.n, true)
+		if failed || out.String() != c.want {
+			t.Errorf("runStrict(%v, %v, %v, %d) bytes = %q, %v, want %q", c.names, c.head, c.atStart, c.n, out.String(), failed, c.want)
+		}
+	}
+}
+
+func TestFollowStrict(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	os.WriteFile(a, []byte("1\n"), 0644)
+	os.WriteFile(b, []byte("x\n"), 0644)
+	fa, err := openStrict(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fb, err := openStrict(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []*strictFile{fa, fb}
+	defer fa.file.Close()
+	defer fb.file.Close()
+
+	appendTo := func(path, text string) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(text)
+		f.Close()
+	}
+
+	// Lines are copied as they are, JSON and a last line without a newline
+	// included
+	var out strings.Builder
+	last := b
+	appendTo(a, "x {\"b\":2}\r\npart")
+	followStrictOnce(&out, files, false, false, &last)
+	if want := "x {\"b\":2}\r\npart"; out.String() != want {
+		t.Errorf("followed %q, want %q", out.String(), want)
+	}
+
+	// Headers come between bytes from different files
+	out.Reset()
+	appendTo(a, "ial\n")
+	appendTo(b, "y\n")
+	followStrictOnce(&out, files, true, false, &last)
+	if want := "\n==> " + a + " <==\nial\n\n==> " + b + " <==\ny\n"; out.String() != want {
+		t.Errorf("followed %q, want %q", out.String(), want)
+	}
+
+	// With -F a replaced file is followed from its start
+	out.Reset()
+	os.Rename(a, a+".1")
+	os.WriteFile(a, []byte("new\n"), 0644)
+	followStrictOnce(&out, files, false, true, &last)
+	if want := "new\n"; out.String() != want {
+		t.Errorf("followed %q, want %q", out.String(), want)
+	}
+}
+
+func TestFirstLineNumber(t *testing.T) {
+	tests := []struct {
+		head, startAtOffset        bool
+		numLines, count, available int
+		first                      int
+	}{
+		{false, false, 10, 10, 127, 118},
+		{false, false, 10, 5, 5, 1},
+		{false, false, 10, 10, -1, 0},
+		{true, false, 10, 10, 127, 1},
+		{true, true, 20, 108, 127, 20},
+	}
+	for _, test := range tests {
+		if got := firstLineNumber(test.head, test.startAtOffset, test.numLines, test.count, test.available); got != test.first {
+			t.Errorf("firstLineNumber(%+v) = %d", test, got)
+		}
+	}
+}
+
+func TestNextLineNumber(t *testing.T) {
+	tests := []struct {
+		startAtOffset   bool
+		numLines, count int
+		next            int
+	}{
+		{false, 10, 10, 11},
+		{false, 10, 0, 1},
+		{true, 4, 2, 6},
+		{true, 0, 3, 3},
+		{true, 0, 0, 1},
+	}
+	for _, test := range tests {
+		if got := nextLineNumber(test.startAtOffset, test.numLines, test.count); got != test.next {
+			t.Errorf("nextLineNumber(%+v) = %d", test, got)
+		}
+	}
+}
+
+func TestFollowStdin(t *testing.T) {
+	tests := []struct {
+		follow, head bool
+		sources      int
+		followed     bool
+	}{
+		{true, false, 0, true},
+		{false, false, 0, false},
+		{true, true, 0, false},
+		{true, false, 1, false},
+	}
+	for _, test := range tests {
+		if got := followStdin(test.follow, test.head, test.sources); got != test.followed {
+			t.Errorf("followStdin(%+v) = %v", test, got)
+		}
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		old, new []string
+		changed  string
+	}{
+		{[]string{"a", "b", "c"}, []string{"a", "b", "c"}, ""},
+		{[]string{"a", "b", "c"}, []string{"a", "x", "c"}, "-b,+x"},
+		{[]string{"a"}, []string{"a", "b"}, "+b"},
+		{[]string{"a", "b"}, []string{"b"}, "-a"},
+		{nil, []string{"a"}, "+a"},
+	}
+	for _, test := range tests {
+		if got := strings.Join(diffLines(test.old, test.new), ","); got != test.changed {
+			t.Errorf("diffLines(%q, %q) = %q, want %q", test.old, test.new, got, test.changed)
+		}
+	}
+}
+
+func TestHitLines(t *testing.T) {
+	got := strings.Join(hitLines(map[string]uint64{"WARN": 1, "ERROR": 3, "DEBUG": 1}), ",")
+	if want := "ERROR: 3 lines,DEBUG: 1 line,WARN: 1 line"; got != want {
+		t.Errorf("hitLines = %q, want %q", got, want)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "logs", "a"), 0755)
+	os.WriteFile(filepath.Join(dir, "logs", "1.log"), []byte("1\n2\n3\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "logs", "a", "2.log"), []byte("4\n"), 0644)
+
+	out := filepath.Join(dir, "snap")
+	count, err := runSnapshot([]string{filepath.Join(dir, "logs", "**", "*.log")}, 2, out, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 files, got %d", count)
+	}
+	content, err := os.ReadFile(filepath.Join(out, snapshotPath(filepath.Join(dir, "logs", "1.log"), "/nowhere")))
+	if err != nil || string(content) != "2\n3\n" {
+		t.Errorf("unexpected snapshot %q: %v", content, err)
+	}
+
+	if _, err := runSnapshot([]string{filepath.Join(dir, "none", "*.log")}, 2, out, ""); err == nil {
+		t.Error("expected error when no files match")
+	}
+	if _, err := runSnapshot([]string{"x"}, 2, out, "x.tar"); err == nil {
+		t.Error("expected error with both --output-dir and --tar")
+	}
+}
+
+func TestGen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gen.log")
+	if err := runGen(path, genOptions{rate: 10000, count: 50, format: "json", rotate: 2000, seed: 1}); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, p := range []string{path + ".1", path} {
+		content, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(content) > 2000 {
+			t.Errorf("%s is %d bytes, over the rotation size", p, len(content))
+		}
+		lines = append(lines, strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")...)
+	}
+	for _, line := range lines {
+		if !json.Valid([]byte(line)) {
+			t.Errorf("line is not JSON: %s", line)
+		}
+	}
+
+	// The same seed gives the same lines apart from timestamps
+	r1, r2 := rand.New(rand.NewSource(7)), rand.New(rand.NewSource(7))
+	now := time.Now()
+	if genLine(r1, now, "text") != genLine(r2, now, "text") {
+		t.Error("expected the same line from the same seed")
+	}
+	if line := genLine(r1, now, "logfmt"); !strings.HasPrefix(line, "time=") || !strings.Contains(line, " level=") {
+		t.Errorf("unexpected logfmt line %s", line)
+	}
+
+	if err := runGen(path, genOptions{rate: 10, format: "yaml"}); err == nil {
+		t.Error("expected error with an unknown format")
+	}
+	if err := runGen(path, genOptions{rate: 10, format: "text", copyTruncate: true}); err == nil {
+		t.Error("expected error with --copytruncate and no --rotate")
+	}
+}
+
+func TestBench(t *testing.T) {
+	tail, err := exec.LookPath("tail")
+	if err != nil {
+		t.Skip("no tail to time")
+	}
+	if took, err := benchTime([]string{tail, "-n", "1", "gotail_test.go"}, 2); err != nil || took <= 0 {
+		t.Errorf("unexpected time %s, error %v", took, err)
+	}
+	if _, err := benchTime([]string{tail, "-n", "1", "missing.log"}, 1); err == nil {
+		t.Error("expected error for a missing file")
+	}
+	if took, err := benchFollow([]string{tail, "-f", "-n", "0"}, []byte("a\nb\nc\n")); err != nil || took <= 0 {
+		t.Errorf("unexpected follow time %s, error %v", took, err)
+	}
+
+	var sb strings.Builder
+	writeBench(&sb, "app.log", 2048, []benchResult{{name: "tail -n 10", gotail: 3 * time.Millisecond}}, true)
+	if want := "app.log (2.0KiB)\n  tail -n 10     gotail 3ms                          system -\n"; sb.String() != want {
+		t.Errorf("unexpected report %q", sb.String())
+	}
+	if err := runBench(&sb, []string{"x"}, benchOptions{runs: 0}); err == nil {
+		t.Error("expected error with no runs")
+	}
+}
+
+func TestSnapshotPath(t *testing.T) {
+	if p := snapshotPath("/work/logs/app.log", "/work"); p != filepath.FromSlash("logs/app.log") {
+		t.Errorf("unexpected path %s", p)
+	}
+	if p := snapshotPath("/var/log/app.log", "/work"); p != filepath.FromSlash("var/log/app.log") {
+		t.Errorf("unexpected path %s", p)
+	}
+}
+
+func TestNewLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	os.WriteFile(path, []byte("1\n2\n"), 0644)
+	appendTo := func(text string) {
+		f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		f.WriteString(text)
+		f.Close()
+	}
+
+	// Nothing is printed the first time a file is seen
+	lines, state, err := newLines(path, nil)
+	if err != nil || len(lines) != 0 || state.Offset != 4 {
+		t.Fatalf("unexpected first run %v %+v %v", lines, state, err)
+	}
+
+	// A partial last line waits for the next run
+	appendTo("3\n4")
+	lines, state, _ = newLines(path, state)
+	if strings.Join(lines, ",") != "3" {
+		t.Errorf("unexpected lines %v", lines)
+	}
+	appendTo("\n")
+	lines, state, _ = newLines(path, state)
+	if strings.Join(lines, ",") != "4" {
+		t.Errorf("unexpected lines %v", lines)
+	}
+
+	// A replaced file is read from its start
+	os.WriteFile(path, []byte("a\nb\nc\nd\n"), 0644)
+	lines, _, _ = newLines(path, state)
+	if strings.Join(lines, ",") != "a,b,c,d" {
+		t.Errorf("unexpected lines after replacement %v", lines)
+	}
+}
+
+func TestDiffState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state, err := loadDiffState(path)
+	if err != nil || len(state.Files) != 0 {
+		t.Fatalf("unexpected state %+v %v", state, err)
+	}
+	state.Files["/var/log/app.log"] = &fileState{Offset: 10, Start: "abc", StartLength: 10}
+	if err := state.save(path); err != nil {
+		t.Fatal(err)
+	}
+	state, err = loadDiffState(path)
+	if err != nil || state.Files["/var/log/app.log"].Offset != 10 {
+		t.Errorf("unexpected state %+v %v", state, err)
+	}
 }
 
 // func TestJSONLine(t *testing.T) {
@@ -69,3 +538,108 @@ func TestRLimit(t *testing.T) {
 // 	t.Log("ok", ok)
 // 	t.Logf("PREFIX %s JSON %s", jl.prefix, jl.json)
 // }
+
+func TestExpandGlobs(t *testing.T) {
+	// Overlapping patterns should not give duplicate paths
+	files, err := expandGlobs([]string{"../../sample/*.txt", "../../sample/1.txt", "../../sample/[12].txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 5 {
+		t.Fatalf("expected 5 files, got %d: %v", len(files), files)
+	}
+	if !strings.HasSuffix(files[0], "sample/1.txt") || !filepath.IsAbs(files[0]) {
+		t.Errorf("unexpected first file %s", files[0])
+	}
+}
+
+func TestExpandGlobsCache(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "1.log"), []byte("1\n"), 0644)
+	// Make the directory look old enough for its glob to be cached
+	old := time.Now().Add(-time.Minute)
+	os.Chtimes(dir, old, old)
+
+	pattern := filepath.Join(dir, "*.log")
+	files, _ := expandGlobs([]string{pattern})
+	if len(files) != 1 {
+		t.Fatalf("expected 1 file, got %v", files)
+	}
+	if _, _, ok := cachedGlob(pattern); !ok {
+		t.Fatal("expected glob to be cached")
+	}
+
+	// Adding a file changes the directory modification time
+	os.WriteFile(filepath.Join(dir, "2.log"), []byte("2\n"), 0644)
+	files, _ = expandGlobs([]string{pattern})
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %v", files)
+	}
+}
+
+func TestDirPattern(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	for _, name := range []string{"a.log", "b.log", filepath.Join("sub", "c.log")} {
+		os.WriteFile(filepath.Join(dir, name), []byte("line\n"), 0644)
+	}
+
+	pattern, err := dirPattern(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only files directly in the directory are found
+	if files := expandRecursive(pattern); len(files) != 2 {
+		t.Errorf("expected 2 files, got %v", files)
+	}
+	if files := expandRecursive(filepath.Join(dir, "**")); len(files) != 3 {
+		t.Errorf("expected 3 files, got %v", files)
+	}
+
+	if _, err := dirPattern(filepath.Join(dir, "a.log")); err == nil {
+		t.Error("expected an error for a file")
+	}
+}
+
+func TestFlatPattern(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		pattern string
+		ok      bool
+	}{
+		{filepath.Join(dir, "*.log"), true},
+		{filepath.Join(dir, "app.log"), true},
+		{filepath.Join(dir, "*", "app.log"), false},
+		{filepath.Join(dir, "missing", "*.log"), false},
+	}
+	for _, test := range tests {
+		if _, ok := flatPattern(test.pattern); ok != test.ok {
+			t.Errorf("flatPattern(%s) = %v", test.pattern, ok)
+		}
+	}
+}
+
+func TestMatchRecursive(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		match         bool
+	}{
+		{"/var/log/**/*.log", "/var/log/app.log", true},
+		{"/var/log/**/*.log", "/var/log/nginx/access.log", true},
+		{"/var/log/**/*.log", "/var/log/a/b/c.log", true},
+		{"/var/log/**/*.log", "/var/log/a/b/c.txt", false},
+		{"/var/log/**", "/var/log/a/b/c.txt", true},
+		{"/var/log/**/app/*.log", "/var/log/x/app/1.log", true},
+		{"/var/log/**/app/*.log", "/var/log/x/api/1.log", false},
+	}
+	for _, test := range tests {
+		if got := matchRecursive(test.pattern, test.path); got != test.match {
+			t.Errorf("matchRecursive(%s, %s) = %v", test.pattern, test.path, got)
+		}
+	}
+
+	if root := recursiveRoot("/var/log/**/*.log"); root != "/var/log/" {
+		t.Errorf("unexpected root %s", root)
+	}
+}
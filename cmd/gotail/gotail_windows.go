@@ -3,6 +3,16 @@
 
 package main
 
-func setrlimit(limit uint64) (err error) {
-	return nil
+import "os"
+
+// notifyDump do nothing as Windows has no SIGUSR1 to ask for the summary with
+func notifyDump(c chan<- os.Signal) {}
+
+// notifyRing do nothing as Windows has no SIGUSR2 to write the lines kept with
+func notifyRing(c chan<- os.Signal) {}
+
+// setrlimit do nothing as Windows has no limit on open files like RLIMIT_NOFILE.
+// Files are opened as handles, which are limited only by available memory.
+func setrlimit(limit uint64) (applied uint64, err error) {
+	return limit, nil
 }
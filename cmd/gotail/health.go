@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/imarsman/gotail/cmd/gotail/metrics"
+	"github.com/imarsman/gotail/cmd/gotail/output"
+)
+
+// watchStalls warn on stderr when a followed source has had no new lines for
+// threshold, as logging having stopped can itself be a sign of trouble. A
+// source is warned about once per stall and a note is printed when it resumes.
+func watchStalls(threshold time.Duration) {
+	// Check often enough that warnings are not much later than the threshold
+	interval := threshold / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	stalled := map[string]bool{}
+	for range time.Tick(interval) {
+		metrics.Each(func(name string, s *metrics.Source) {
+			if !s.Up() {
+				return
+			}
+			idle := time.Since(s.LastActivity())
+			switch {
+			case idle >= threshold && !stalled[name]:
+				stalled[name] = true
+				fmt.Fprintln(os.Stderr, output.Colour(output.BrightYellow,
+					fmt.Sprintf("==> no data from %s for %s - possible logging outage <==", name, idle.Round(time.Second))))
+			case idle < threshold && stalled[name]:
+				delete(stalled, name)
+				fmt.Fprintln(os.Stderr, output.Colour(output.BrightGreen, fmt.Sprintf("==> %s resumed <==", name)))
+			}
+		})
+	}
+}
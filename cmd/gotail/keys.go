@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/imarsman/gotail/cmd/gotail/output"
+	"github.com/imarsman/gotail/internal/util"
+	"golang.org/x/term"
+)
+
+const (
+	// copyKey the key that copies the most recent matching line while following
+	copyKey = 'c'
+	// pauseKey the key that pauses and resumes printing while following
+	pauseKey = ' '
+)
+
+// watchKeys act on keys pressed while following. With copy set the copy key
+// copies the most recent matching line to the clipboard, and with pause set
+// the pause key pauses printing or resumes it. Standard input must be a
+// terminal, which means it isn't being read as a source. The terminal is
+// switched to reading single key presses without echoing them, and the
+// function returned switches it back.
+func watchKeys(copy, pause bool) (restore func()) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return func() {}
+	}
+	restore, err := singleKeys(fd)
+	if err != nil {
+		return func() {}
+	}
+
+	go func() {
+		key := make([]byte, 1)
+		var paused bool
+		for {
+			if _, err := os.Stdin.Read(key); err != nil {
+				return
+			}
+			if key[0] == pauseKey && pause {
+				paused = !paused
+				output.SetPaused(paused)
+				if paused {
+					fmt.Fprintln(os.Stderr, "Paused, press space to resume")
+				} else {
+					fmt.Fprintln(os.Stderr, "Resumed")
+				}
+				continue
+			}
+			if key[0] != copyKey || !copy {
+				continue
+			}
+			line := output.LastMatch()
+			if line == "" {
+				fmt.Fprintln(os.Stderr, "No line has matched yet")
+				continue
+			}
+			if err := util.CopyToClipboard(line); err != nil {
+				fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Could not copy match:", err.Error()))
+				continue
+			}
+			fmt.Fprintln(os.Stderr, "Copied the last match to the clipboard")
+		}
+	}()
+
+	return
+}
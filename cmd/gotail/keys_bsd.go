@@ -0,0 +1,12 @@
+//go:build darwin || freebsd || openbsd || netbsd || dragonfly
+// +build darwin freebsd openbsd netbsd dragonfly
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// getTermios and setTermios the ioctl requests to get and set terminal settings
+const (
+	getTermios = unix.TIOCGETA
+	setTermios = unix.TIOCSETA
+)
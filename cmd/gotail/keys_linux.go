@@ -0,0 +1,9 @@
+package main
+
+import "golang.org/x/sys/unix"
+
+// getTermios and setTermios the ioctl requests to get and set terminal settings
+const (
+	getTermios = unix.TCGETS
+	setTermios = unix.TCSETS
+)
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd && !openbsd && !netbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!openbsd,!netbsd,!dragonfly
+
+package main
+
+import "errors"
+
+// singleKeys fail as key presses can only be read singly from terminals with
+// termios settings
+func singleKeys(fd int) (restore func(), err error) {
+	return nil, errors.New("single key presses can't be read on this platform")
+}
@@ -0,0 +1,30 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd || dragonfly
+// +build linux darwin freebsd openbsd netbsd dragonfly
+
+package main
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// singleKeys switch the terminal fd to give each key as it is pressed without
+// echoing it. Signals such as interrupt from ctrl-c and output processing are
+// left as they are, unlike in raw mode. The function returned switches the
+// terminal back.
+func singleKeys(fd int) (restore func(), err error) {
+	old, err := unix.IoctlGetTermios(fd, getTermios)
+	if err != nil {
+		return nil, err
+	}
+	keys := *old
+	keys.Lflag &^= unix.ICANON | unix.ECHO
+	keys.Cc[unix.VMIN] = 1
+	keys.Cc[unix.VTIME] = 0
+	if err = unix.IoctlSetTermios(fd, setTermios, &keys); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		unix.IoctlSetTermios(fd, setTermios, old)
+	}, nil
+}
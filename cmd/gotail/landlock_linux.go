@@ -0,0 +1,99 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Landlock system calls and access rights, from linux/landlock.h. The system
+// call numbers are the same on every architecture.
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	landlockRulePathBeneath = 1
+
+	landlockExecute    = 1 << 0
+	landlockWriteFile  = 1 << 1
+	landlockReadFile   = 1 << 2
+	landlockReadDir    = 1 << 3
+	landlockRemoveFile = 1 << 5
+	landlockMakeReg    = 1 << 8
+	landlockHandled    = 1<<13 - 1 // every right in the first landlock ABI
+)
+
+// landlockRulesetAttr struct landlock_ruleset_attr
+type landlockRulesetAttr struct {
+	handledAccessFS uint64
+}
+
+// landlockPathBeneathAttr struct landlock_path_beneath_attr, which is packed
+// so is read as the first 12 bytes
+type landlockPathBeneathAttr struct {
+	allowedAccess uint64
+	parentFd      int32
+}
+
+// restrict use landlock to allow reading and running files anywhere but
+// writing only beneath the directories given. Nothing more is done where the
+// kernel has no landlock or, with cgo, where the restriction can't be applied
+// to every thread.
+func restrict(writable []string) error {
+	attr := landlockRulesetAttr{handledAccessFS: landlockHandled}
+	fd, _, errno := syscall.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno == syscall.ENOSYS || errno == syscall.EOPNOTSUPP {
+		return nil
+	}
+	if errno != 0 {
+		return fmt.Errorf("landlock: %v", errno)
+	}
+	ruleset := int(fd)
+	defer unix.Close(ruleset)
+
+	if err := landlockAllow(ruleset, "/", landlockReadFile|landlockReadDir|landlockExecute); err != nil {
+		return err
+	}
+	for _, dir := range writable {
+		err := landlockAllow(ruleset, dir, landlockReadFile|landlockReadDir|landlockWriteFile|landlockRemoveFile|landlockMakeReg)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Required to restrict an unprivileged process
+	if _, _, errno = syscall.AllThreadsSyscall(syscall.SYS_PRCTL, unix.PR_SET_NO_NEW_PRIVS, 1, 0); errno == syscall.ENOTSUP {
+		return nil
+	}
+	if errno != 0 {
+		return fmt.Errorf("landlock: %v", errno)
+	}
+	if _, _, errno = syscall.AllThreadsSyscall(sysLandlockRestrictSelf, uintptr(ruleset), 0, 0); errno != 0 {
+		return fmt.Errorf("landlock: %v", errno)
+	}
+
+	return nil
+}
+
+// landlockAllow add a rule to ruleset allowing access beneath path
+func landlockAllow(ruleset int, path string, access uint64) error {
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("landlock: %s: %v", path, err)
+	}
+	defer unix.Close(fd)
+
+	attr := landlockPathBeneathAttr{allowedAccess: access, parentFd: int32(fd)}
+	_, _, errno := syscall.Syscall6(sysLandlockAddRule, uintptr(ruleset), landlockRulePathBeneath, uintptr(unsafe.Pointer(&attr)), 0, 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("landlock: %s: %v", path, errno)
+	}
+
+	return nil
+}
@@ -2,22 +2,25 @@ package main
 
 import (
 	"bufio"
+	"crypto/tls"
 	"fmt"
-	"io"
+	"math"
+	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"regexp"
-	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/imarsman/gotail/cmd/gotail/input"
+	"github.com/imarsman/gotail/cmd/gotail/metrics"
 	"github.com/imarsman/gotail/cmd/gotail/output"
-	"github.com/imarsman/gotail/cmd/gotail/util"
+	"github.com/imarsman/gotail/cmd/gotail/schema"
 	"github.com/imarsman/gotail/cmd/internal/args"
-	"github.com/posener/complete/v2"
-	"github.com/posener/complete/v2/predict"
+	"github.com/imarsman/gotail/internal/config"
+	"github.com/imarsman/gotail/internal/input"
+	"github.com/imarsman/gotail/internal/util"
 )
 
 /*
@@ -33,26 +36,24 @@ import (
 	Lines containing JSON can be expanded and printed in colour.
 
 	The native Unix implementation of tail is much smaller and uses less
-	resources. This is mostly a test but it seems to work well so far.
-
-	// Regular tail
-	$: time cat /var/log/wifi.log | tail -n +100 >/dev/null
-	tail -n +100 > /dev/null  0.01s user 0.00s system 83% cpu 0.010 total
-
-	// This tail
-	$: time cat /var/log/wifi.log | gotail -H -n +100 >/dev/null
-	gotail -H -n +100 > /dev/null  0.00s user 0.00s system 70% cpu 0.011 total
+	resources. This is mostly a test but it seems to work well so far. gotail
+	bench --compare times gotail against the system's tail and head.
 
 	There is likely more to do in terms of directing output properly to stdout
 	or stderr.
 */
 
-var useColour = true // use colour - defaults to true
-var follow bool      // follow renamed or replaced files
+var follow bool // follow renamed or replaced files
 // initialize followed files here - used to keep track of files being followed
 // so that they can have things done such as unlocking their channels.
 var followedFiles = make([]*output.FollowedFile, 0, 100)
 
+// commands being followed, such as tail run in containers
+var followedCommands = make([]*output.FollowedCommand, 0)
+
+// unix domain sockets being listened on
+var followedSockets = make([]*output.FollowedSocket, 0)
+
 var rlimit uint64
 
 /*
@@ -86,65 +87,247 @@ func callSetRLimit(limit uint64) (err error) {
 func init() {
 	rlimit = 1000
 
-	// Set files limit
-	setrlimit(rlimit)
+	// Set files limit. The hard limit may allow fewer files than asked for.
+	if applied, err := setrlimit(rlimit); err == nil {
+		rlimit = applied
+	}
+}
+
+// globWorkers the maximum number of glob patterns expanded at once
+const globWorkers = 8
+
+// absCache absolute, cleaned paths for paths found by globbing, kept between
+// scans as the same files are found each time.
+var absCache = map[string]string{}
+var absCacheMutex sync.Mutex
+
+// absPath get the absolute, cleaned form of path, using the cache if possible
+func absPath(path string) (abs string, err error) {
+	absCacheMutex.Lock()
+	abs, ok := absCache[path]
+	absCacheMutex.Unlock()
+	if ok {
+		return
+	}
+
+	abs, err = filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	abs = filepath.Clean(abs)
+
+	absCacheMutex.Lock()
+	absCache[path] = abs
+	absCacheMutex.Unlock()
+
+	return
+}
+
+// globResult the paths found for a pattern whose directory part has no
+// wildcards, kept along with the directory's modification time.
+type globResult struct {
+	dirModTime time.Time
+	globbedAt  time.Time
+	paths      []string
+}
+
+// globCache glob results by pattern, used to skip globbing when a pattern's
+// directory hasn't changed since the last scan
+var globCache = map[string]globResult{}
+var globCacheMutex sync.Mutex
+
+// cachedGlob get the paths for pattern from the cache if the directory they
+// come from hasn't changed. Adding or removing files changes a directory's
+// modification time. As that time can be coarse the cache is only used if the
+// directory was last changed at least a second before the cached glob.
+func cachedGlob(pattern string) (paths []string, modTime time.Time, ok bool) {
+	dir := filepath.Dir(pattern)
+	if strings.ContainsAny(dir, "*?[") {
+		return
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return
+	}
+	modTime = fi.ModTime()
+
+	globCacheMutex.Lock()
+	result, found := globCache[pattern]
+	globCacheMutex.Unlock()
+	if !found || !result.dirModTime.Equal(modTime) || !modTime.Before(result.globbedAt.Add(-time.Second)) {
+		return
+	}
+
+	return result.paths, modTime, true
 }
 
 // expandGlobs - take a list of glob patterns and get the complete expanded list,
 // adding this to the incoming list. The code makes an attempt to normalize paths.
+// Patterns are expanded in parallel with at most globWorkers at a time. Bad
+// patterns are skipped. Patterns whose directory is unchanged since the last
+// call are not globbed again. Directories and ** patterns are walked.
 func expandGlobs(existing []string) (expanded []string, err error) {
-	// make filter map
-	var found = map[string]bool{}
+	// Keep results for each pattern separate to preserve ordering
+	results := make([][]string, len(existing))
 
-	// add in existing items and mark them as present
-	// expanded = append(expanded, existing...)
-	for _, g := range existing {
-		var files []string
-		files, err = filepath.Glob(g)
-		if err != nil {
-			continue
-		}
-		for _, path := range files {
-			full, err := filepath.Abs(path)
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, globWorkers)
+	for i, g := range existing {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(i int, g string) {
+			defer wg.Done()
+			defer func() { <-limit }()
+
+			if pattern, ok := recursivePattern(g); ok {
+				results[i] = expandRecursive(pattern)
+				return
+			}
+			if dirPatterns[g] {
+				results[i] = expandRecursive(g)
+				return
+			}
+
+			paths, modTime, ok := cachedGlob(g)
+			if ok {
+				results[i] = paths
+				return
+			}
+
+			globbedAt := time.Now()
+			files, err := filepath.Glob(g)
 			if err != nil {
-				continue
+				return
+			}
+			for _, path := range files {
+				path, err := absPath(path)
+				if err != nil {
+					continue
+				}
+				results[i] = append(results[i], path)
+			}
+
+			// Remember the result if the directory could be checked
+			if !modTime.IsZero() {
+				globCacheMutex.Lock()
+				globCache[g] = globResult{dirModTime: modTime, globbedAt: globbedAt, paths: results[i]}
+				globCacheMutex.Unlock()
 			}
-			path = filepath.Clean(full)
+		}(i, g)
+	}
+	wg.Wait()
+
+	// make filter map
+	var found = map[string]bool{}
+	for _, paths := range results {
+		for _, path := range paths {
 			if !found[path] {
 				expanded = append(expanded, path)
 				found[path] = true
 			}
 		}
 	}
-	for _, path := range expanded {
-		full, err := filepath.Abs(path)
-		if err != nil {
-			continue
-		}
-		path = filepath.Clean(full)
-		found[path] = true
+
+	return
+}
+
+// missingFile get the path of a file named without glob characters and why it
+// can't be found, as expanding it finds nothing rather than an error. The
+// error is nil for patterns and for files that exist.
+func missingFile(pattern string) (path string, err error) {
+	if strings.ContainsAny(pattern, "*?[") {
+		return
 	}
+	path, err = absPath(pattern)
+	if err != nil {
+		return pattern, err
+	}
+	_, err = os.Stat(path)
 
 	return
 }
 
-func main() {
-	cmd := &complete.Command{
-		Flags: map[string]complete.Predictor{
-			"nocolour":    predict.Nothing,
-			"follow":      predict.Nothing,
-			"numlines":    predict.Nothing,
-			"printextra":  predict.Nothing,
-			"linenumbers": predict.Nothing,
-			"json":        predict.Nothing,
-			"json-only":   predict.Nothing,
-			"match":       predict.Nothing,
-			"head":        predict.Nothing,
-			"interval":    predict.Nothing,
-			"files":       predict.Files("*"),
-		},
+// groupByDir order paths so that those in the same directory are together.
+// Directories are kept in the order they were first found, as are the paths in
+// each directory.
+func groupByDir(paths []string) []string {
+	var dirs []string
+	byDir := map[string][]string{}
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		if _, ok := byDir[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], path)
 	}
+
+	grouped := make([]string, 0, len(paths))
+	for _, dir := range dirs {
+		grouped = append(grouped, byDir[dir]...)
+	}
+
+	return grouped
+}
+
+// nextLineNumber get the number -N gives the line after count lines printed.
+// Lines are numbered from 1 for a tail and from n for a head starting at n.
+func nextLineNumber(startAtOffset bool, numLines, count int) int {
+	if startAtOffset && numLines+count > 0 {
+		return numLines + count
+	}
+
+	return count + 1
+}
+
+// followStdin get whether piped standard input is followed rather than read to
+// its end. It is only followed when asked to and there are no other sources,
+// as otherwise those are what is followed.
+func followStdin(follow, head bool, sources int) bool {
+	return follow && !head && sources == 0
+}
+
+// firstLineNumber get the number in its source of the first of count lines
+// gathered, or 0 if it isn't known as only the end of the source was read
+func firstLineNumber(head, startAtOffset bool, numLines, count, linesAvailable int) int {
+	switch {
+	case startAtOffset:
+		return numLines
+	case head:
+		return 1
+	case linesAvailable < 0:
+		return 0
+	}
+
+	return linesAvailable - count + 1
+}
+
+// copyMatch copy the most recent matching line to the clipboard if requested
+func copyMatch() {
+	if !args.Args.CopyMatch {
+		return
+	}
+	line := output.LastMatch()
+	if line == "" {
+		return
+	}
+	if err := util.CopyToClipboard(line); err != nil {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Could not copy match:", err.Error()))
+	}
+}
+
+// signalStatus get the exit status for being stopped by sig, which as for a
+// process killed by a signal is 128 plus the signal number
+func signalStatus(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
+
+func main() {
+	cmd := completionCommand()
 	cmd.Complete("gotail")
+	args.Parse()
 
 	// Set re-check interval and ensure it is not zero
 	interval := args.Args.Interval
@@ -152,7 +335,34 @@ func main() {
 		interval = 5
 	}
 
-	var noColourFlag = args.Args.NoColour
+	// Load per-source settings and profiles
+	err := config.Init(args.Args.Config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()))
+		os.Exit(1)
+	}
+	if args.Args.Profile != "" {
+		if err := applyProfile(args.Args.Profile); err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+	}
+
+	// Strict output is the same as tail and head, so nothing can change it.
+	// Bytes counted with -c are written the same way.
+	if args.Args.Strict || args.Args.Bytes != "" {
+		flag := "--strict"
+		if !args.Args.Strict {
+			flag = "-c/--bytes"
+		}
+		if flags := strictConflicts(); len(flags) > 0 {
+			fmt.Fprintln(os.Stderr, flag+" can't be used with "+strings.Join(flags, ", ")+". Exiting.")
+			os.Exit(1)
+		}
+		config.Current = new(config.Config)
+	}
+
+	var noColourFlag = args.Args.NoColour || args.Args.Strict || args.Args.Bytes != "" || args.Args.Canonical
 
 	if args.Args.NumLines == "" {
 		args.Args.NumLines = "10"
@@ -161,7 +371,7 @@ func main() {
 	// Flag for whether to start tail partway into a file
 	var startAtOffset bool
 
-	follow = args.Args.Follow
+	follow = args.Args.Follow || args.Args.FollowName
 
 	var numLinesStr = args.Args.NumLines
 	var numLines int
@@ -169,10 +379,379 @@ func main() {
 	var printLines = args.Args.LineNumbers
 	var head = args.Args.Head
 
+	if err := checkBackend(args.Args.Backend); err != nil {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+		os.Exit(1)
+	}
+	args.Args.Backend = resolveBackend(args.Args.Backend)
+	if args.Args.Recheck != "notify" && args.Args.Recheck != "interval" {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Invalid --recheck value", args.Args.Recheck, "expected notify or interval. Exiting."))
+		os.Exit(1)
+	}
+	if args.Args.Quiet && args.Args.Verbose {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "-q/--quiet and --verbose can't be used together. Exiting."))
+		os.Exit(1)
+	}
+
+	outputMode, err := output.ParseOutput(args.Args.Output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+		os.Exit(1)
+	}
+	fallbackTime, err := output.ParseFallbackTime(args.Args.FallbackTime)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+		os.Exit(1)
+	}
+	// JSON objects hold their own line numbers and are not coloured
+	records := outputMode == output.OutputNDJSON
+	if records {
+		noColourFlag = true
+		printLines = false
+	}
+	// Lines are numbered as they are processed for records and for reports of
+	// invalid JSON, rather than as they are printed with -N
+	numbered := records || args.Args.ValidateJSON || args.Args.Forward != ""
+	if args.Args.Forward != "" && printLines {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--forward can't be used with -N, as forwarded lines give line numbers. Exiting."))
+		os.Exit(1)
+	}
+	if args.Args.ForwardOnly && args.Args.Forward == "" {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--forward-only needs --forward. Exiting."))
+		os.Exit(1)
+	}
+	if args.Args.NumberStart < 0 {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--number-start can't be negative. Exiting."))
+		os.Exit(1)
+	}
+	output.SetLineNumbers(args.Args.NumberStart, args.Args.NumberSeparator)
+	if args.Args.ValidateJSON && printLines {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--validate-json can't be used with -N, as its reports give line numbers. Exiting."))
+		os.Exit(1)
+	}
+	if args.Args.Canonical && (records || args.Args.JSON || args.Args.PrintExtra) {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--canonical can't be used with -j, -p, or --output ndjson. Exiting."))
+		os.Exit(1)
+	}
+	if args.Args.Heartbeat > 0 && !records {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--heartbeat needs --output ndjson. Exiting."))
+		os.Exit(1)
+	}
+
+	// Colour is on when standard output is a terminal unless --color says
+	// otherwise
+	colourMode := args.Args.Colour
 	if noColourFlag {
-		useColour = false
+		colourMode = "never"
+	}
+	// Set colour output for the run of this app
+	if err := output.SetColour(colourMode); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error()+". Exiting.")
+		os.Exit(1)
+	}
+
+	// Lines can be limited to those timestamped within a window
+	var since, until time.Time
+	if args.Args.Since != "" {
+		var err error
+		if since, err = output.ParseTimeBound(args.Args.Since, time.Now()); err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Invalid --since: "+err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+	}
+	if args.Args.Until != "" {
+		var err error
+		if until, err = output.ParseTimeBound(args.Args.Until, time.Now()); err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Invalid --until: "+err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+	}
+
+	// Long lines can be cut or broken up, but not both
+	if args.Args.Truncate < 0 || args.Args.Wrap < 0 {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--truncate and --wrap can't be negative. Exiting."))
+		os.Exit(1)
+	}
+	if args.Args.Truncate > 0 && args.Args.Wrap > 0 {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--truncate and --wrap can't be used together. Exiting."))
+		os.Exit(1)
+	}
+	if args.Args.Wrap > 0 && records {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--wrap can't be used with --output ndjson. Exiting."))
+		os.Exit(1)
+	}
+
+	if args.Args.WatchInterval < 0 {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--watch-interval can't be negative. Exiting."))
+		os.Exit(1)
+	}
+	if args.Args.WatchDiff && args.Args.WatchInterval == 0 {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--watch-diff needs --watch-interval. Exiting."))
+		os.Exit(1)
+	}
+
+	// The hash key can refer to where it is kept rather than be given
+	if args.Args.HashKey != "" {
+		var err error
+		if args.Args.HashKey, err = config.ResolveSecret(args.Args.HashKey); err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Invalid --hash-key: "+err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+	}
+
+	output.SetOptions(output.Options{
+		FormatHint:    args.Args.FormatHint,
+		ExplodeArray:  args.Args.ExplodeArray,
+		ValidateJSON:  args.Args.ValidateJSON,
+		JSON:          args.Args.JSON,
+		JSONOnly:      args.Args.JSONOnly,
+		KeepKeyOrder:  args.Args.KeepKeyOrder,
+		SchemaInvalid: args.Args.SchemaInvalid,
+		CheckOrder:    args.Args.CheckOrder,
+		ClockJump:     args.Args.ClockJump,
+		Since:         since,
+		Until:         until,
+		HashFields:    args.Args.HashFields,
+		HashKey:       args.Args.HashKey,
+		CopyMatch:     args.Args.CopyMatch,
+		Truncate:      args.Args.Truncate,
+		Wrap:          args.Args.Wrap,
+		HostColumn:    args.Args.HostColumn,
+		PrefixName:    args.Args.PrefixFilename,
+		Canonical:     args.Args.Canonical,
+		Poll:          args.Args.Backend == "poll",
+		RateCapacity:  args.Args.RateCapacity,
+		RateInterval:  args.Args.RateInterval,
+		Output:        outputMode,
+		FallbackTime:  fallbackTime,
+	})
+
+	if args.Args.SleepInterval <= 0 || args.Args.RateCapacity == 0 || args.Args.RateInterval <= 0 {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--sleep-interval, --rate-capacity, and --rate-interval must be more than 0. Exiting."))
+		os.Exit(1)
+	}
+	output.SetPollInterval(args.Args.SleepInterval)
+
+	if args.Args.MaxMemory != "" {
+		maxMemory, err := util.ParseSize(args.Args.MaxMemory)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Invalid --max-memory: "+err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+		output.SetMaxMemory(maxMemory)
+	}
+
+	if args.Args.Ring < 0 {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--ring can't be negative. Exiting."))
+		os.Exit(1)
+	}
+	if args.Args.Ring > 0 {
+		output.SetRing(args.Args.Ring)
+	}
+
+	if args.Args.FileBar && !args.Args.FileColours {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--file-bar needs --file-colours. Exiting."))
+		os.Exit(1)
+	}
+	if args.Args.FileColours {
+		output.SetFileColours(args.Args.FileBar)
+	}
+
+	if args.Args.SquashRepeats {
+		if args.Args.SquashTimeout <= 0 {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--squash-timeout must be positive. Exiting."))
+			os.Exit(1)
+		}
+		output.SetSquashRepeats(args.Args.SquashTimeout)
+	}
+
+	if args.Args.StreamReplay < 0 {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--stream-replay can't be negative. Exiting."))
+		os.Exit(1)
+	}
+	if args.Args.StreamReplay > 0 && !args.Args.Stream {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--stream-replay needs --stream. Exiting."))
+		os.Exit(1)
+	}
+	if args.Args.Stream {
+		if args.Args.MetricsAddr == "" {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--stream needs --metrics-addr to serve lines on. Exiting."))
+			os.Exit(1)
+		}
+		output.SetStream(args.Args.StreamReplay)
+	}
+
+	maxLineLength, err := util.ParseSize(args.Args.MaxLineLength)
+	if err != nil || maxLineLength < 1 || maxLineLength > math.MaxInt32 {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Invalid --max-line-length", args.Args.MaxLineLength, ". Exiting."))
+		os.Exit(1)
+	}
+	input.SetMaxLineLength(int(maxLineLength))
+
+	if args.Args.ForwardQueue != "" && args.Args.Forward == "" {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--forward-queue needs --forward. Exiting."))
+		os.Exit(1)
+	}
+	if args.Args.ForwardDrop != "newest" && args.Args.ForwardDrop != "oldest" {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Invalid --forward-drop", args.Args.ForwardDrop, ", expected newest or oldest. Exiting."))
+		os.Exit(1)
+	}
+	if args.Args.Forward != "" {
+		if err := output.SetForward(args.Args.Forward, args.Args.ForwardOnly); err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+		if args.Args.ForwardQueue != "" {
+			queueSize, err := util.ParseSize(args.Args.ForwardQueueSize)
+			if err != nil || queueSize < 1 {
+				fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Invalid --forward-queue-size", args.Args.ForwardQueueSize, ". Exiting."))
+				os.Exit(1)
+			}
+			if err := output.SetForwardQueue(args.Args.ForwardQueue, queueSize, args.Args.ForwardDrop == "oldest"); err != nil {
+				fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+				os.Exit(1)
+			}
+		}
+	}
+
+	// A byte range limits files read without following to a window of them
+	if args.Args.StartOffset != "" || args.Args.EndOffset != "" {
+		var start, end int64
+		var err error
+		if args.Args.StartOffset != "" {
+			if start, err = util.ParseSize(args.Args.StartOffset); err != nil {
+				fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Invalid --start-offset: "+err.Error()+". Exiting."))
+				os.Exit(1)
+			}
+		}
+		if args.Args.EndOffset != "" {
+			if end, err = util.ParseSize(args.Args.EndOffset); err != nil || end == 0 {
+				fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Invalid --end-offset", args.Args.EndOffset, ". Exiting."))
+				os.Exit(1)
+			}
+			if end <= start {
+				fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--end-offset must be after --start-offset. Exiting."))
+				os.Exit(1)
+			}
+		}
+		if args.Args.Follow || args.Args.FollowName {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--start-offset and --end-offset can't be used when following. Exiting."))
+			os.Exit(1)
+		}
+		input.SetByteRange(start, end)
+	}
+
+	// The metrics server can use TLS, with client certificates if a CA is given
+	var metricsTLS *tls.Config
+	if args.Args.MetricsTLSCert != "" || args.Args.MetricsTLSKey != "" || args.Args.MetricsClientCA != "" {
+		if args.Args.MetricsTLSCert == "" || args.Args.MetricsTLSKey == "" {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--metrics-tls-cert and --metrics-tls-key must be given together. Exiting."))
+			os.Exit(1)
+		}
+		var err error
+		if metricsTLS, err = metrics.TLSConfig(args.Args.MetricsTLSCert, args.Args.MetricsTLSKey, args.Args.MetricsClientCA); err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+	}
+
+	// Metrics can be limited to clients with a token and from given networks
+	var metricsAccess metrics.Access
+	if args.Args.MetricsToken != "" {
+		var err error
+		if metricsAccess.Token, err = config.ResolveSecret(args.Args.MetricsToken); err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+		if metricsAccess.Token == "" {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--metrics-token is empty. Exiting."))
+			os.Exit(1)
+		}
+	}
+	if len(args.Args.MetricsAllow) > 0 {
+		var err error
+		if metricsAccess.Allowed, err = metrics.ParseAllowed(args.Args.MetricsAllow); err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Invalid --metrics-allow: "+err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+	}
+	if args.Args.MetricsAddr != "" && metricsAccess.Token == "" && len(metricsAccess.Allowed) == 0 && metricsTLS == nil {
+		if host, _, err := net.SplitHostPort(args.Args.MetricsAddr); err == nil && (host == "" || host == "0.0.0.0" || host == "::") {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightYellow, "Metrics are served to anyone who can reach "+args.Args.MetricsAddr+"; use --metrics-token or --metrics-allow to limit them"))
+		}
+	}
+
+	if len(args.Args.HashFields) > 0 && args.Args.HashKey == "" {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--hash-field requires a key set with --hash-key or GOTAIL_HASH_KEY. Exiting."))
+		os.Exit(1)
+	}
+
+	if args.Args.FormatHint != "auto" {
+		if _, err := output.ParseFormat(args.Args.FormatHint); err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Invalid --format-hint value", args.Args.FormatHint, ". Exiting with usage information."))
+			os.Exit(1)
+		}
+	}
+
+	if args.Args.Match != "" {
+		warning, err := output.SetMatch(args.Args.Match)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+		if warning != "" {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightYellow, warning))
+		}
+	}
+
+	if len(args.Args.Excludes) > 0 {
+		warnings, err := output.SetExcludes(args.Args.Excludes)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+		for _, warning := range warnings {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightYellow, warning))
+		}
+	}
+
+	if len(args.Args.Highlights) > 0 {
+		warnings, err := output.SetHighlights(args.Args.Highlights)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+		for _, warning := range warnings {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightYellow, warning))
+		}
+	}
+
+	if len(args.Args.Rules) > 0 || len(config.Current.Rules) > 0 {
+		warnings, err := output.SetRules(config.Current.Rules, args.Args.Rules)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+		for _, warning := range warnings {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightYellow, warning))
+		}
+	}
+
+	if args.Args.Schema != "" {
+		s, err := schema.Load(args.Args.Schema)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+		output.SetSchema(s)
+	}
+
+	if args.Args.Script != "" {
+		if err := output.LoadScript(args.Args.Script); err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+			os.Exit(1)
+		}
 	}
-	output.SetColour(useColour) // Set colour output for the run of this app
 
 	// Set follow flag to false if this is a file head call
 	// This is relied upon later
@@ -180,54 +759,175 @@ func main() {
 		follow = false
 	}
 
-	justDigits, err := regexp.MatchString(`^[0-9]+$`, numLinesStr)
-	if err != nil {
+	// Privileges are dropped once followed files are open, so --sandbox does
+	// nothing without -f. With -F files are reopened by name, which may not be
+	// allowed once privileges are dropped.
+	if args.Args.Sandbox != "" && !follow {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--sandbox needs -f. Exiting."))
+		os.Exit(1)
+	}
+	if args.Args.Sandbox != "" && args.Args.FollowName {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "--sandbox can't be used with -F, as files reopened by name may not be readable once privileges are dropped. Exiting."))
+		os.Exit(1)
+	}
+
+	// A + prefix starts at line n rather than printing the last n lines. A unit
+	// suffix can be used for large counts, such as 10k or 2M.
+	nStrOrig := numLinesStr
+	if strings.HasPrefix(numLinesStr, "+") {
+		numLinesStr = numLinesStr[1:]
+		// Assume head if we got an offset
+		head = true
+		startAtOffset = true
+	}
+	count, err := util.ParseSize(numLinesStr)
+	if err != nil || count > math.MaxInt32 {
 		out := os.Stderr
-		fmt.Fprintln(out, output.Colour(output.BrightRed, "Got error", err.Error()))
+		fmt.Fprintln(out, output.Colour(output.BrightRed, "Invalid -n value", nStrOrig, ". Exiting with usage information."))
 		os.Exit(1)
 	}
-	if justDigits == false {
-		// Test for + prefix. Complain later if something else is wrong
-		if !strings.HasPrefix(numLinesStr, "+") {
-			out := os.Stderr
-			fmt.Fprintln(out, output.Colour(output.BrightRed, "Invalid -n value", numLinesStr, ". Exiting with usage information."))
+	numLines = int(count)
+
+	// -c counts bytes rather than lines, with the same + prefix and suffixes
+	var numBytes int
+	if args.Args.Bytes != "" {
+		bytesStr := strings.TrimPrefix(args.Args.Bytes, "+")
+		if bytesStr != args.Args.Bytes {
+			head = true
+			startAtOffset = true
+		}
+		count, err := util.ParseSize(bytesStr)
+		if err != nil || int64(int(count)) != count {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Invalid -c value", args.Args.Bytes, ". Exiting with usage information."))
 			os.Exit(1)
 		}
+		numBytes = int(count)
 	}
 
-	// Deal selectively with offset
-	if !justDigits {
-		nStrOrig := numLinesStr
-		numLinesStr = numLinesStr[1:]
-		// Ignore prefix if not a head request
-		var err error
-		// Invalid  somehow - for example +20a is not caught above but would be invalid
-		numLines, err = strconv.Atoi(numLinesStr)
+	if g := args.Args.Gen; g != nil {
+		opts := genOptions{rate: g.Rate, count: g.Count, format: g.Format, copyTruncate: g.CopyTruncate, seed: g.Seed}
+		if g.JSON {
+			opts.format = "json"
+		}
+		path := g.Path
+		if g.File != "" && path != "" && g.File != path {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Give the file to gen once, either after gen or with --file. Exiting."))
+			os.Exit(1)
+		}
+		if path == "" {
+			path = g.File
+		}
+		if path == "" {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "gen needs a file to write to. Exiting."))
+			os.Exit(1)
+		}
+		if g.Rotate != "" {
+			if opts.rotate, err = util.ParseSize(g.Rotate); err != nil || opts.rotate == 0 {
+				fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Invalid --rotate size", g.Rotate, ". Exiting."))
+				os.Exit(1)
+			}
+		}
+		if err := runGen(path, opts); err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+		return
+	}
+
+	if b := args.Args.Bench; b != nil {
+		gotail, err := os.Executable()
 		if err != nil {
-			out := os.Stderr
-			fmt.Fprintln(out, output.Colour(output.BrightRed, "Invalid -n value", nStrOrig, ". Exiting with usage information."))
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
 			os.Exit(1)
 		}
-		// Assume head if we got an offset
-		head = true
-		startAtOffset = true
-	} else {
-		var err error
-		// Extremely unlikely to have error as we've checked for all digits
-		numLines, err = strconv.Atoi(numLinesStr)
+		opts := benchOptions{gotail: gotail, numLines: numLines, runs: b.Runs, compare: b.Compare, followLines: b.FollowLines}
+		if err := runBench(os.Stdout, b.Patterns, opts); err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+		return
+	}
+
+	if s := args.Args.Snapshot; s != nil {
+		count, err := runSnapshot(s.Patterns, numLines, s.OutputDir, s.Tar)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote the last %d %s of %d %s\n", numLines, util.Pluralize("line", "lines", numLines), count, util.Pluralize("file", "files", count))
+		return
+	}
+
+	if d := args.Args.Diff; d != nil {
+		stdout := bufio.NewWriterSize(os.Stdout, 64*1024)
+		err := runDiff(stdout, d.Patterns, d.StateFile)
+		stdout.Flush()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+		return
+	}
+
+	if args.Args.WatchInterval > 0 {
+		stdout := bufio.NewWriterSize(os.Stdout, 64*1024)
+		err := runWatch(stdout, args.Args.Files, args.Args.WatchInterval, args.Args.WatchDiff)
+		stdout.Flush()
 		if err != nil {
-			out := os.Stderr
-			fmt.Fprintln(out, output.Colour(output.BrightRed, "invalid -n value", numLinesStr, ". Exiting with usage information."))
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
 			os.Exit(1)
 		}
+		return
+	}
+
+	if args.Args.Strict || args.Args.Bytes != "" {
+		names := args.Args.Files
+		if len(names) == 0 {
+			names = []string{"-"}
+		}
+		stdout := bufio.NewWriterSize(os.Stdout, 64*1024)
+		headers := (len(names) > 1 || args.Args.Verbose) && !args.Args.Quiet
+		n := numLines
+		if args.Args.Bytes != "" {
+			n = numBytes
+		}
+		last, failed := runStrict(stdout, names, headers, head, startAtOffset, n, args.Args.Bytes != "")
+		stdout.Flush()
+		if follow {
+			followStrict(names, headers, last)
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
 	}
 
 	var multipleFiles bool
 
-	// Write lines for a single file to avoid growing large output then dumping
-	// all at once. The lines to print are passed in.
-	var write = func(path string, head bool, lines []string, linesAvailable int) {
-		builder := new(strings.Builder)
+	// The directory of files being written under a directory header with
+	// --group-dirs, ending in a separator
+	var groupDir string
+
+	// Buffer output shared by headers and lines for all files so that it is
+	// written in large chunks. It must be flushed before followed files print.
+	stdout := bufio.NewWriterSize(os.Stdout, 64*1024)
+
+	// Write lines for a single file. The lines to print are passed in.
+	var write = func(path string, head bool, lines []string, linesAvailable int, format output.Format) {
+		source := config.ForPath(path)
+		name := output.SourceName(path)
+		colour := output.HeaderColour(path)
+
+		// Files grouped under a directory header get an indented sub-header
+		// without the directory
+		var indent string
+		if groupDir != "" {
+			indent = "  "
+			name = strings.TrimPrefix(name, groupDir)
+		}
+		header := func(format string, a ...interface{}) {
+			stdout.WriteString(output.Colour(colour, indent+fmt.Sprintf(format, a...)))
+		}
 
 		strategyStr := "tail"
 		if head {
@@ -236,43 +936,48 @@ func main() {
 
 		// write a line of dashes
 		if pretty == true && multipleFiles {
-			builder.WriteString(output.Colour(output.BrightBlue, fmt.Sprintf("%s\n", strings.Repeat("-", 80))))
+			stdout.WriteString(output.Colour(colour, fmt.Sprintf("%s\n", strings.Repeat("-", 80))))
 		}
 
 		// head is also true
 		if startAtOffset {
 			if len(lines) == 0 && multipleFiles {
-				builder.WriteString(output.Colour(output.BrightBlue, fmt.Sprintf("==> %s - starting at %d of %s %d <==\n", path, numLines, util.Pluralize("line", "lines", linesAvailable), linesAvailable)))
+				header("==> %s - starting at %d of %s %d <==\n", name, numLines, util.Pluralize("line", "lines", linesAvailable), linesAvailable)
 			} else {
 				// The tail utility prints out filenames if there is more than one
 				// file. Do so here as well.
 				if multipleFiles {
 					extent := len(lines) + numLines - 1
-					builder.WriteString(output.Colour(output.BrightBlue, fmt.Sprintf("==> %s - starting at %d of %s %d <==\n", path, numLines, util.Pluralize("line", "lines", linesAvailable), extent)))
+					header("==> %s - starting at %d of %s %d <==\n", name, numLines, util.Pluralize("line", "lines", linesAvailable), extent)
 				}
 			}
 		} else {
 			// No lines in file
 			if len(lines) == 0 && multipleFiles {
-				builder.WriteString(output.Colour(output.BrightBlue, fmt.Sprintf("==> %s - %s of %d %s <==\n", path, strategyStr, len(lines), util.Pluralize("line", "lines", len(lines)))))
+				header("==> %s - %s of %d %s <==\n", name, strategyStr, len(lines), util.Pluralize("line", "lines", len(lines)))
 			} else {
 				// With multiple files print out filename, etc. otherwise leave empty.
 				if multipleFiles {
 					if startAtOffset {
-						builder.WriteString(output.Colour(output.BrightBlue, fmt.Sprintf("==> %s - starting at %d of %d %s <==\n", path, numLines, linesAvailable, util.Pluralize("line", "lines", linesAvailable))))
+						header("==> %s - starting at %d of %d %s <==\n", name, numLines, linesAvailable, util.Pluralize("line", "lines", linesAvailable))
 					} else {
 						if head {
 							count := numLines
 							if numLines > linesAvailable {
 								count = linesAvailable
 							}
-							builder.WriteString(output.Colour(output.BrightBlue, fmt.Sprintf("==> %s - head %d of %d %s <==\n", path, count, linesAvailable, util.Pluralize("line", "lines", linesAvailable))))
+							header("==> %s - head %d of %d %s <==\n", name, count, linesAvailable, util.Pluralize("line", "lines", linesAvailable))
 						} else {
 							count := numLines
-							if numLines > linesAvailable {
+							if numLines > linesAvailable && linesAvailable >= 0 {
 								count = linesAvailable
 							}
-							builder.WriteString(output.Colour(output.BrightBlue, fmt.Sprintf("==> %s - tail %d of %d %s <==\n", path, count, linesAvailable, util.Pluralize("line", "lines", linesAvailable))))
+							if linesAvailable < 0 {
+								// Only the end of a long file was read
+								header("==> %s - tail %d %s <==\n", name, count, util.Pluralize("line", "lines", count))
+							} else {
+								header("==> %s - tail %d of %d %s <==\n", name, count, linesAvailable, util.Pluralize("line", "lines", linesAvailable))
+							}
 						}
 					}
 				}
@@ -280,81 +985,245 @@ func main() {
 		}
 		// Add a line of dashes
 		if pretty == true && multipleFiles {
-			builder.WriteString(output.Colour(output.BrightBlue, fmt.Sprintf("%s\n", strings.Repeat("-", 80))))
+			stdout.WriteString(output.Colour(colour, fmt.Sprintf("%s\n", strings.Repeat("-", 80))))
+		}
+
+		// Lines in a byte range are numbered from the lines before it
+		var linesBefore int
+		if input.Ranged() && path != "-" {
+			var err error
+			if linesBefore, err = input.LinesBefore(path); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+			}
+		}
+
+		if numbered {
+			first := firstLineNumber(head, startAtOffset, numLines, len(lines), linesAvailable)
+			if first > 0 {
+				first += linesBefore
+			}
+			output.SetLineNumber(path, first)
 		}
 
+		counter := metrics.For(path)
 		index := 0
-		// Print out all lines for file using string builder.
+		if printLines && len(lines) > 0 {
+			last := len(lines) + linesBefore
+			if startAtOffset {
+				last += numLines - 1
+			}
+			output.WidenLineNumbers(last)
+		}
+		// Print out all lines for file
 		for i := 0; i < len(lines); i++ {
 			if printLines == true {
+				counter.Line(len(lines[i]), true)
 				if startAtOffset {
 					index = i + numLines
 				} else {
 					index = i + 1
 				}
-				builder.WriteString(fmt.Sprintf("%-3d %s\n", index, lines[i]))
+				index += linesBefore
+				stdout.WriteString(output.LineNumber(index))
+				stdout.WriteString(lines[i])
+				stdout.WriteByte('\n')
 			} else {
-				if lines[i] == "" {
+				if lines[i] == "" && !numbered && !args.Args.PrefixFilename {
 					// Add newline for empty string
-					builder.WriteString("\n")
+					counter.Line(0, true)
+					stdout.WriteString("\n")
 				} else {
-					output, err := output.GetOutput(lines[i])
+					output, err := output.GetOutput(path, source, format, lines[i])
+					counter.Line(len(lines[i]), err == nil)
 					if err != nil {
 						continue
 					}
-					builder.WriteString(fmt.Sprintf("%s\n", output))
+					stdout.WriteString(output)
+					stdout.WriteByte('\n')
 				}
 			}
 		}
-		// Write out what was recieved with no added newline
-		io.WriteString(os.Stdout, builder.String())
 	}
 
-	// Use stdin if available
-	stat, _ := os.Stdin.Stat()
-	if (stat.Mode() & os.ModeCharDevice) == 0 {
-		scanner := bufio.NewScanner(os.Stdin)
-		for scanner.Scan() {
-			var line, err = output.GetOutput(scanner.Text())
+	// Descriptors inherited with --fd are opened before anything else can be
+	// given their numbers
+	var fdFiles []*os.File
+	var fdKinds []input.Kind
+	var fdSockets int // inherited sockets, which like socket sources have no end
+	for _, n := range args.Args.Fds {
+		file, kind, err := input.OpenFd(n)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+		fdFiles = append(fdFiles, file)
+		fdKinds = append(fdKinds, kind)
+		if kind == input.Socket {
+			fdSockets++
+		}
+	}
+
+	// Standard input given as - is read along with other sources
+	var readStdin bool
+	for _, f := range args.Args.Files {
+		if f == "-" {
+			readStdin = true
+		}
+	}
+
+	// Piped standard input given alone is followed with -f or --follow-stdin,
+	// as with kubectl logs -f pod | gotail -f -j, rather than read to its end
+	sources := len(args.Args.Files) + len(args.Args.Commands) + len(args.Args.Containers) + len(args.Args.Dirs) + len(fdFiles)
+	if input.ProbeStdin() != input.CharDevice && followStdin(follow || args.Args.FollowStdin, head, sources) {
+		readStdin = true
+		follow = true
+		output.SetFollowHeaders(false, "")
+	}
+
+	// Use stdin if available and it isn't one of the sources
+	if input.ProbeStdin() != input.CharDevice && !readStdin && len(fdFiles) == 0 {
+		source := config.ForPath("-")
+		scanner := input.NewScanner("standard input", source.NewReader(os.Stdin))
+
+		// Gather the first lines to detect the format of input
+		var sniffed []string
+		for len(sniffed) < output.SniffLines && scanner.Scan() {
+			sniffed = append(sniffed, scanner.Text())
+		}
+		format := output.FormatFor(sniffed)
+		output.SetLineNumber("-", 1)
+
+		var printLine = func(text string) {
+			var line, err = output.GetOutput("-", source, format, text)
 			if err != nil {
-				continue
+				return
 			}
-			io.WriteString(os.Stdout, fmt.Sprintf("%s\n", line))
+			stdout.WriteString(line)
+			stdout.WriteByte('\n')
+		}
+		for _, text := range sniffed {
+			printLine(text)
 		}
+		for scanner.Scan() {
+			printLine(scanner.Text())
+		}
+		stdout.Flush()
 		if err := scanner.Err(); err != nil {
 			fmt.Println("Got error", err)
 		}
+		copyMatch()
+		if printValidation() {
+			os.Exit(1)
+		}
 
 		os.Exit(0)
 	}
 
+	// Sources given as unix:// or unixgram:// are sockets to listen on rather
+	// than file patterns
+	var patterns, sockets []string
+	for _, f := range args.Args.Files {
+		if f == "-" {
+			continue
+		}
+		if _, _, ok := input.SocketAddress(f); ok {
+			sockets = append(sockets, f)
+		} else {
+			patterns = append(patterns, f)
+		}
+	}
+
+	// Files in directories given with --dir are found with a pattern that is
+	// watched rather than checked every interval when following
+	for _, dir := range args.Args.Dirs {
+		pattern, err := dirPattern(dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+			os.Exit(1)
+		}
+		patterns = append(patterns, pattern)
+		dirPatterns[pattern] = true
+	}
+
 	// look at files to tail
-	files, err := expandGlobs(args.Args.Files)
+	files, err := expandGlobs(patterns)
 	if err != nil {
 		panic(err)
 	}
+	if args.Args.GroupDirs {
+		files = groupByDir(files)
+	}
+
+	// Files that couldn't be read, by path. They are reported as they are
+	// found and make the exit status 1 unless they can be read later.
+	var unreadable = map[string]bool{}
+	for _, g := range patterns {
+		if path, err := missingFile(g); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			unreadable[path] = true
+		}
+	}
+
+	// Names shown in headers
+	if err := output.SetAliases(args.Args.Aliases); err != nil {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+		os.Exit(1)
+	}
+	if err := output.SetShortNames(args.Args.ShortNames, files); err != nil {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+		os.Exit(1)
+	}
 
 	// For printing out file information when > 1 file being processed
-	multipleFiles = len(files) > 1 // Are multiple files to be printed
+	// Are multiple files to be printed
+	// Headers are left out when lines are written as JSON objects
+	// Files named that are missing are counted as they were asked for, so the
+	// files that are there keep their headers, as with tail.
+	var stdinSources int
+	if readStdin {
+		stdinSources = 1
+	}
+	multipleFiles = len(files)+len(unreadable)+len(sockets)+len(args.Args.Containers)+len(args.Args.Commands)+len(fdFiles)+stdinSources > 1 && !records
+	// -q and --verbose decide headers for any number of sources
+	if args.Args.Verbose {
+		multipleFiles = !records
+	}
+	// Reports of invalid JSON give the file they are for, as do lines
+	// prefixed with the name of their file. Canonical output has no headers.
+	if args.Args.Quiet || args.Args.ValidateJSON || args.Args.PrefixFilename || args.Args.Canonical {
+		multipleFiles = false
+		output.SetFollowHeaders(false, "")
+	}
+	if args.Args.PrefixFilename {
+		output.PadNames(files)
+	}
 
-	if len(files) == 0 {
+	// An empty directory can be followed for files created in it
+	emptyDirs := follow && len(args.Args.Dirs) > 0
+	if len(files) == 0 && len(sockets) == 0 && len(args.Args.Containers) == 0 && len(args.Args.Commands) == 0 && len(fdFiles) == 0 && !readStdin && !emptyDirs {
 		out := os.Stderr
 		fmt.Fprintln(out, output.Colour(output.BrightRed, "No files specified. Exiting."))
 		os.Exit(1)
 	}
 
 	// Guard against handling too many files
-	if len(files) > int(rlimit) {
-		fmt.Fprintf(os.Stderr, "Too many files specified. Max is %d\n", rlimit)
+	if max := maxFiles(rlimit, args.Args.Backend); uint64(len(files)) > max {
+		fmt.Fprintf(os.Stderr, "Too many files specified. Max is %d\n", max)
 		os.Exit(1)
 	}
 
 	// make a map of files followed
 	var filesFollowed = map[string]bool{}
 
+	// Held while files are being run so that shutdown doesn't miss new files
+	var runMutex sync.Mutex
+
 	// runFiles run through file list and for any new files and when follow is
 	// true, add the files to the set of followed files.
 	var runFiles = func(files []string) {
+		runMutex.Lock()
+		defer runMutex.Unlock()
+
 		// make empty set of followed files
 		var newFollowedFiles = make([]*output.FollowedFile, 0, 100)
 
@@ -376,19 +1245,45 @@ func main() {
 			// Set path for future lookups
 			filesFollowed[path] = true
 
+			kind, err := input.ProbePath(files[i])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				unreadable[path] = true
+				continue
+			}
+			followStrategy := input.FollowStrategy(files[i], kind)
+
+			// Streams such as named pipes are used up by reading them, so
+			// when following their lines are only printed as they arrive
+			if follow && followStrategy == input.StreamFollow {
+				followedCommands = append(followedCommands, output.NewFollowedReader(files[i], input.OpenStream(files[i])))
+				delete(unreadable, path)
+				continue
+			}
+
 			lines, total, err := input.GetLines(files[i], head, startAtOffset, numLines)
 			if err != nil {
-				// there was a problem such as a bad file path
+				// The error, such as a bad file path, has been printed
+				unreadable[path] = true
 				continue
 			}
+			format := output.FormatFor(lines)
+			delete(unreadable, path)
 
-			if follow {
+			if follow && followStrategy == input.FileFollow {
 				// define followed file
-				ff, err := output.NewFollowedFileForPath(files[i])
+				ff, err := output.NewFollowedFileForPath(files[i], args.Args.FollowName)
 				// unlikely given that non-existent filess would be caught above
 				if err != nil {
+					fmt.Fprintln(os.Stderr, err.Error())
+					unreadable[path] = true
 					continue
 				}
+				ff.Format = format
+				// Followed lines are numbered on from those printed first
+				if printLines {
+					ff.LineNumber = nextLineNumber(startAtOffset, numLines, len(lines))
+				}
 				// Add to comprehensive list of followed files
 				followedFiles = append(followedFiles, ff)
 				// Add to list of new files found to follow
@@ -396,11 +1291,20 @@ func main() {
 			}
 
 			// This is what the tail command does - leave a space before file name
-			if i > 0 && len(files) > 1 {
-				fmt.Println()
+			if i > 0 && multipleFiles {
+				stdout.WriteByte('\n')
 			}
-			write(files[i], head, lines, total)
+			if args.Args.GroupDirs && multipleFiles {
+				dir := filepath.Dir(files[i]) + string(os.PathSeparator)
+				if dir != groupDir {
+					groupDir = dir
+					stdout.WriteString(output.Colour(output.BrightBlue, fmt.Sprintf("==> %s <==\n", dir)))
+				}
+			}
+			write(files[i], head, lines, total, format)
 		}
+		groupDir = ""
+		stdout.Flush()
 
 		if foundNew {
 			// Write to channel for each followed file to release them to
@@ -412,37 +1316,323 @@ func main() {
 		}
 	}
 
+	// Gather sources that are read by running a command, either tail inside a
+	// container or a --cmd shell command.
+	var commandNames []string
+	var commands [][]string
+	for _, spec := range args.Args.Containers {
+		name, command, err := input.ContainerCommand(args.Args.ContainerRuntime, spec, head, startAtOffset, follow, numLines)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()))
+			continue
+		}
+		commandNames = append(commandNames, name)
+		commands = append(commands, command)
+	}
+	for _, line := range args.Args.Commands {
+		commandNames = append(commandNames, line)
+		commands = append(commands, input.ShellCommand(line))
+	}
+
+	// runCommands get lines from command sources, printing them or, when
+	// following, starting commands to follow them.
+	var runCommands = func() {
+		for i, name := range commandNames {
+			if follow {
+				fc, err := output.NewFollowedCommand(name, commands[i])
+				if err != nil {
+					fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()))
+					continue
+				}
+				followedCommands = append(followedCommands, fc)
+				continue
+			}
+
+			lines, total, err := input.GetCommandLines(name, commands[i], head, startAtOffset, numLines)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()))
+				continue
+			}
+			if (i > 0 || len(files) > 0) && multipleFiles {
+				stdout.WriteByte('\n')
+			}
+			write(name, head, lines, total, output.FormatFor(lines))
+		}
+		stdout.Flush()
+	}
+
+	// runStdin read standard input given as -, printing its lines or, when
+	// following, printing lines as they arrive along with other sources.
+	var runStdin = func() {
+		if !readStdin {
+			return
+		}
+		if follow {
+			followedCommands = append(followedCommands, output.NewFollowedReader("-", os.Stdin))
+			return
+		}
+
+		lines, total, err := input.GetLines("-", head, startAtOffset, numLines)
+		if err != nil {
+			// The error has been printed
+			return
+		}
+		if multipleFiles {
+			stdout.WriteByte('\n')
+		}
+		write("-", head, lines, total, output.FormatFor(lines))
+		stdout.Flush()
+	}
+
+	// runFds read descriptors inherited with --fd as standard input is read.
+	// Sockets are listened on, so like socket sources they can only be
+	// followed.
+	var runFds = func() {
+		for i, file := range fdFiles {
+			name := file.Name()
+			if fdKinds[i] == input.Socket {
+				if !follow {
+					fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Socket source", name, "requires -f"))
+					continue
+				}
+				fs, err := output.NewInheritedSocket(name, file)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()))
+					continue
+				}
+				followedSockets = append(followedSockets, fs)
+				continue
+			}
+			if follow {
+				followedCommands = append(followedCommands, output.NewFollowedReader(name, file))
+				continue
+			}
+
+			lines, total, err := input.FdLines(file, head, startAtOffset, numLines)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				continue
+			}
+			if multipleFiles {
+				stdout.WriteByte('\n')
+			}
+			write(name, head, lines, total, output.FormatFor(lines))
+			stdout.Flush()
+		}
+	}
+
+	// runSockets listen on socket sources. Sockets have no lines until
+	// something connects so they can only be followed.
+	var runSockets = func() {
+		for _, name := range sockets {
+			if !follow {
+				fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Socket source", name, "requires -f"))
+				continue
+			}
+			fs, err := output.NewFollowedSocket(name)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()))
+				continue
+			}
+			followedSockets = append(followedSockets, fs)
+		}
+	}
+
+	// Watches directories for new files when following
+	var watcher *recursiveWatcher
+
+	// Closed when following should end without a signal
+	var ended chan struct{}
+
 	// Just run the files specified if following isn't being requested
 	if !follow {
 		runFiles(files)
+		runCommands()
+		runStdin()
+		runFds()
+		runSockets()
+		copyMatch()
+		if printValidation() || len(unreadable) > 0 {
+			os.Exit(1)
+		}
 	} else {
+		if args.Args.StickyHeader != "" && !records {
+			if err := output.SetStickyHeader(args.Args.StickyHeader); err != nil {
+				fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()+". Exiting."))
+				os.Exit(1)
+			}
+		}
+		if args.Args.SummaryEvery > 0 {
+			output.StartSummaries(args.Args.SummaryEvery, output.LineMatch())
+		}
+		if args.Args.Heartbeat > 0 {
+			output.StartHeartbeats(args.Args.Heartbeat)
+		}
+		if numbered {
+			output.SetLineNumber("-", 1)
+		}
+		runCommands()
+		runStdin()
+		runFds()
+		runSockets()
+
+		// Directories and patterns are watched for new files rather than
+		// being checked every interval if their directories can be watched.
+		var polled, watched []string
+		for _, g := range patterns {
+			if pattern, ok := recursivePattern(g); ok {
+				watched = append(watched, pattern)
+			} else if pattern, ok := flatPattern(g); ok {
+				watched = append(watched, pattern)
+			} else {
+				polled = append(polled, g)
+			}
+		}
+		if len(watched) > 0 && (args.Args.Backend == "poll" || args.Args.Recheck == "interval") {
+			polled = patterns
+		} else if len(watched) > 0 {
+			watcher, err = newRecursiveWatcher(watched, runFiles)
+			if err != nil {
+				// Fall back to checking every interval
+				fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Could not watch directories:", err.Error()))
+				polled = patterns
+			}
+		}
+
+		// Closed when all sources have ended
+		ended = make(chan struct{})
+
 		// Follow periodically if follow specified
 		// Code will exit below if follow is set
 		go func() {
+			runFiles(files)
+			// Alerts count lines from here on, not those printed before
+			// following
+			output.StartAlerts(config.Current.Notify)
+
+			// Drop privileges once the files given have been opened
+			if args.Args.Sandbox != "" {
+				if err := dropPrivileges(args.Args.Sandbox, sandboxWritable()); err != nil {
+					fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Could not drop privileges:", err.Error()+". Exiting."))
+					os.Exit(1)
+				}
+			}
+
+			// With --exit-on-eof stop once every source has been read to its
+			// end. Command sources alone end when their commands exit.
+			// Sockets have no end so are only stopped with --exit-on-eof.
+			if args.Args.ExitOnEOF || len(patterns)+len(sockets)+fdSockets == 0 {
+				runMutex.Lock()
+				followed := append([]*output.FollowedFile{}, followedFiles...)
+				commands := append([]*output.FollowedCommand{}, followedCommands...)
+				runMutex.Unlock()
+				for _, ff := range followed {
+					ff.StopAtEOF()
+				}
+				for _, fc := range commands {
+					<-fc.Done()
+				}
+				close(ended)
+				return
+			}
+
 			// If there were glob arguments check for new ever few seconds
-			if len(args.Args.Files) > 0 {
-				for {
-					files, err = expandGlobs(args.Args.Files)
-					if err != nil {
-						panic(err)
-					}
-					runFiles(files)
-					time.Sleep(time.Duration(interval) * time.Second)
+			if len(polled) == 0 {
+				return
+			}
+			for {
+				time.Sleep(time.Duration(interval) * time.Second)
+				files, err := expandGlobs(polled)
+				if err != nil {
+					panic(err)
 				}
-			} else {
-				// If no glob patterns don't bother checking ever interval seconds
 				runFiles(files)
-				return
 			}
 		}()
 	}
 
 	// Wait to exit if files being followed
 	if follow {
-		// fmt.Printf("active files %+v", activeFiles)
-		c := make(chan os.Signal)
-		signal.Notify(c, os.Interrupt)
+		if args.Args.StallWarning > 0 {
+			go watchStalls(args.Args.StallWarning)
+		}
+		if args.Args.MetricsAddr != "" {
+			go func() {
+				err := metrics.Serve(args.Args.MetricsAddr, metricsTLS, metricsAccess)
+				fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Metrics server stopped:", err.Error()))
+			}()
+		}
 
-		<-c
+		// SIGUSR2 writes the lines kept with --ring to a file
+		if args.Args.Ring > 0 {
+			ringDump := make(chan os.Signal, 1)
+			notifyRing(ringDump)
+			go func() {
+				for range ringDump {
+					path, count, err := output.DumpRing(args.Args.RingDir, time.Now())
+					if err != nil {
+						fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, "Could not write lines kept:", err.Error()))
+						continue
+					}
+					fmt.Fprintf(os.Stderr, "Wrote the last %d %s to %s\n", count, util.Pluralize("line", "lines", count), path)
+				}
+			}()
+		}
+
+		// SIGUSR1 prints the summary so far without stopping
+		dump := make(chan os.Signal, 1)
+		notifyDump(dump)
+		go func() {
+			for range dump {
+				printSummary()
+			}
+		}()
+
+		// Pressing c copies the most recent match and space pauses printing
+		restoreTerminal := func() {}
+		if args.Args.CopyMatch || args.Args.NoScrollInterrupt {
+			restoreTerminal = watchKeys(args.Args.CopyMatch, args.Args.NoScrollInterrupt)
+		}
+
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+		var sig os.Signal
+		select {
+		case sig = <-c:
+		case <-ended:
+		}
+		restoreTerminal()
+		// A second signal exits straight away if stopping is held up, such
+		// as by a source that doesn't stop or output that isn't being read
+		go func() {
+			sig := <-c
+			fmt.Fprintln(os.Stderr, "Exiting without waiting for lines to be printed")
+			os.Exit(signalStatus(sig))
+		}()
+		// Stop checking for new files and stop following existing ones so
+		// that lines already read are printed before exiting.
+		runMutex.Lock()
+		if watcher != nil {
+			watcher.Close()
+		}
+		for _, ff := range followedFiles {
+			ff.Stop()
+		}
+		for _, fc := range followedCommands {
+			fc.Stop()
+		}
+		for _, fs := range followedSockets {
+			fs.Stop()
+		}
+		output.Close()
+		copyMatch()
+		failed := printSummary()
+		if printValidation() || failed || len(unreadable) > 0 {
+			os.Exit(1)
+		}
+		if sig != nil {
+			os.Exit(signalStatus(sig))
+		}
 	}
 }
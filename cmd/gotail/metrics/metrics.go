@@ -0,0 +1,400 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	Metrics are kept per source (a followed file or command) and exposed in the
+	Prometheus text format. No client library is used as only counters and a
+	gauge are needed.
+*/
+
+// Source counts for a followed file or command
+type Source struct {
+	lines    uint64 // lines read
+	bytes    uint64 // bytes read, not counting newlines
+	matched  uint64 // lines printed after filtering
+	dropped  uint64 // lines read but filtered out
+	shed     uint64 // bytes dropped from buffers to stay under --max-memory
+	invalid  uint64 // lines with JSON that couldn't be parsed
+	restarts uint64 // times reading the source failed and was restarted
+	up       int32  // 1 while the source is being followed
+	offset   int64  // for files, the offset read up to
+	known    int32  // 1 once offset is set, as sources that aren't files have none
+
+	lastActivity int64 // unix nanoseconds when a line was last read
+
+	hitsMutex sync.Mutex
+	hits      map[string]uint64 // lines printed matching each pattern
+}
+
+var sourcesMutex sync.Mutex
+var sources = map[string]*Source{}
+
+// For get the counts for a source, creating them on first use
+func For(name string) *Source {
+	sourcesMutex.Lock()
+	defer sourcesMutex.Unlock()
+
+	s, ok := sources[name]
+	if !ok {
+		s = new(Source)
+		sources[name] = s
+	}
+
+	return s
+}
+
+// Line count a line read from the source and whether it was printed
+func (s *Source) Line(length int, printed bool) {
+	atomic.StoreInt64(&s.lastActivity, time.Now().UnixNano())
+	atomic.AddUint64(&s.lines, 1)
+	atomic.AddUint64(&s.bytes, uint64(length))
+	if printed {
+		atomic.AddUint64(&s.matched, 1)
+	} else {
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+// SetUp set whether the source is being followed. Starting to follow counts
+// as activity.
+func (s *Source) SetUp(up bool) {
+	var v int32
+	if up {
+		v = 1
+		atomic.StoreInt64(&s.lastActivity, time.Now().UnixNano())
+	}
+	atomic.StoreInt32(&s.up, v)
+}
+
+// Lines the number of lines read
+func (s *Source) Lines() uint64 {
+	return atomic.LoadUint64(&s.lines)
+}
+
+// Matched the number of lines printed after filtering
+func (s *Source) Matched() uint64 {
+	return atomic.LoadUint64(&s.matched)
+}
+
+// Bytes the number of bytes read, not counting newlines
+func (s *Source) Bytes() uint64 {
+	return atomic.LoadUint64(&s.bytes)
+}
+
+// Dropped the number of lines read but filtered out
+func (s *Source) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Hit count a printed line matching pattern
+func (s *Source) Hit(pattern string) {
+	s.hitsMutex.Lock()
+	defer s.hitsMutex.Unlock()
+
+	if s.hits == nil {
+		s.hits = map[string]uint64{}
+	}
+	s.hits[pattern]++
+}
+
+// Hits the number of printed lines matching each pattern with any matches
+func (s *Source) Hits() map[string]uint64 {
+	s.hitsMutex.Lock()
+	defer s.hitsMutex.Unlock()
+
+	hits := make(map[string]uint64, len(s.hits))
+	for pattern, n := range s.hits {
+		hits[pattern] = n
+	}
+
+	return hits
+}
+
+// SetOffset set the offset in a file that has been read up to
+func (s *Source) SetOffset(offset int64) {
+	atomic.StoreInt64(&s.offset, offset)
+	atomic.StoreInt32(&s.known, 1)
+}
+
+// Offset the offset in a file that has been read up to, and whether there is
+// one, as sources that aren't files have none
+func (s *Source) Offset() (offset int64, ok bool) {
+	return atomic.LoadInt64(&s.offset), atomic.LoadInt32(&s.known) == 1
+}
+
+// InvalidJSON count a line with JSON that couldn't be parsed
+func (s *Source) InvalidJSON() {
+	atomic.AddUint64(&s.invalid, 1)
+}
+
+// Shed count bytes dropped from buffers to stay under the memory limit
+func (s *Source) Shed(n int) {
+	atomic.AddUint64(&s.shed, uint64(n))
+}
+
+// ShedBytes the number of bytes dropped from buffers
+func (s *Source) ShedBytes() uint64 {
+	return atomic.LoadUint64(&s.shed)
+}
+
+// Restart count a restart of reading the source after it failed
+func (s *Source) Restart() {
+	atomic.AddUint64(&s.restarts, 1)
+}
+
+// Restarts the number of times reading the source was restarted
+func (s *Source) Restarts() uint64 {
+	return atomic.LoadUint64(&s.restarts)
+}
+
+// Up whether the source is being followed
+func (s *Source) Up() bool {
+	return atomic.LoadInt32(&s.up) == 1
+}
+
+// LastActivity when a line was last read or following started
+func (s *Source) LastActivity() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&s.lastActivity))
+}
+
+// Counts for lines forwarded with --forward, written once forwarding starts
+var (
+	forwarding     int32
+	forwardSent    uint64
+	forwardDropped uint64
+	forwardQueued  int64
+)
+
+// ForwardSent count a line forwarded
+func ForwardSent() {
+	atomic.StoreInt32(&forwarding, 1)
+	atomic.AddUint64(&forwardSent, 1)
+}
+
+// ForwardDropped count lines dropped as they couldn't be forwarded or queued
+func ForwardDropped(n int) {
+	atomic.StoreInt32(&forwarding, 1)
+	atomic.AddUint64(&forwardDropped, uint64(n))
+}
+
+// SetForwardQueued set the bytes of lines queued to be forwarded
+func SetForwardQueued(bytes int64) {
+	atomic.StoreInt32(&forwarding, 1)
+	atomic.StoreInt64(&forwardQueued, bytes)
+}
+
+// Each call f for each source
+func Each(f func(name string, s *Source)) {
+	sourcesMutex.Lock()
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sourcesMutex.Unlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		f(name, For(name))
+	}
+}
+
+// escape escape a label value
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// Write write all metrics in the Prometheus text format
+func Write(w io.Writer) {
+	sourcesMutex.Lock()
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sourcesMutex.Unlock()
+	sort.Strings(names)
+
+	var metrics = []struct {
+		name, kind, help string
+		value            func(s *Source) uint64
+	}{
+		{"gotail_lines_total", "counter", "Lines read from a source.", func(s *Source) uint64 { return atomic.LoadUint64(&s.lines) }},
+		{"gotail_bytes_total", "counter", "Bytes read from a source.", func(s *Source) uint64 { return atomic.LoadUint64(&s.bytes) }},
+		{"gotail_matched_total", "counter", "Lines printed after filtering.", func(s *Source) uint64 { return atomic.LoadUint64(&s.matched) }},
+		{"gotail_dropped_total", "counter", "Lines filtered out and not printed.", func(s *Source) uint64 { return atomic.LoadUint64(&s.dropped) }},
+		{"gotail_shed_bytes_total", "counter", "Bytes dropped from buffers to stay under the memory limit.", func(s *Source) uint64 { return atomic.LoadUint64(&s.shed) }},
+		{"gotail_json_errors_total", "counter", "Lines with JSON that could not be parsed.", func(s *Source) uint64 { return atomic.LoadUint64(&s.invalid) }},
+		{"gotail_restarts_total", "counter", "Times reading a source failed and was restarted.", func(s *Source) uint64 { return atomic.LoadUint64(&s.restarts) }},
+		{"gotail_follower_up", "gauge", "Whether a source is being followed.", func(s *Source) uint64 { return uint64(atomic.LoadInt32(&s.up)) }},
+	}
+
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s{path=\"%s\"} %d\n", m.name, escape(name), m.value(For(name)))
+		}
+	}
+
+	var followed int
+	for _, name := range names {
+		if For(name).Up() {
+			followed++
+		}
+	}
+	fmt.Fprintf(w, "# HELP gotail_followed_sources Sources being followed.\n# TYPE gotail_followed_sources gauge\ngotail_followed_sources %d\n", followed)
+
+	if atomic.LoadInt32(&forwarding) == 1 {
+		fmt.Fprintf(w, "# HELP gotail_forward_sent_total Lines forwarded.\n# TYPE gotail_forward_sent_total counter\ngotail_forward_sent_total %d\n", atomic.LoadUint64(&forwardSent))
+		fmt.Fprintf(w, "# HELP gotail_forward_dropped_total Lines dropped as they could not be forwarded or queued.\n# TYPE gotail_forward_dropped_total counter\ngotail_forward_dropped_total %d\n", atomic.LoadUint64(&forwardDropped))
+		fmt.Fprintf(w, "# HELP gotail_forward_queued_bytes Bytes of lines queued to be forwarded.\n# TYPE gotail_forward_queued_bytes gauge\ngotail_forward_queued_bytes %d\n", atomic.LoadInt64(&forwardQueued))
+	}
+}
+
+// TLSConfig get the TLS settings for serving with the certificate and key in
+// certFile and keyFile. If clientCAFile is given clients must present a
+// certificate signed by a CA in it.
+func TLSConfig(certFile, keyFile, clientCAFile string) (config *tls.Config, err error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("metrics TLS certificate: %v", err)
+	}
+	config = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("metrics client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("metrics client CA: no certificates in %s", clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return
+}
+
+// Access who can fetch metrics. The zero value lets anyone who can connect.
+type Access struct {
+	Token   string       // if set, needed as a bearer token or basic auth password
+	Allowed []*net.IPNet // if set, the networks clients must connect from
+}
+
+// ParseAllowed parse networks given in CIDR form, such as 10.0.0.0/8, or as
+// single addresses
+func ParseAllowed(values []string) (allowed []*net.IPNet, err error) {
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			allowed = append(allowed, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", value)
+		}
+		allowed = append(allowed, network)
+	}
+
+	return
+}
+
+// permits check whether r may fetch metrics, returning the status to refuse
+// it with if not
+func (a Access) permits(r *http.Request) (status int, ok bool) {
+	if len(a.Allowed) > 0 {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		ip := net.ParseIP(host)
+		if err != nil || ip == nil {
+			return http.StatusForbidden, false
+		}
+		var allowed bool
+		for _, network := range a.Allowed {
+			if network.Contains(ip) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return http.StatusForbidden, false
+		}
+	}
+	if a.Token != "" {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if _, password, ok := r.BasicAuth(); ok {
+			given = password
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(a.Token)) != 1 {
+			return http.StatusUnauthorized, false
+		}
+	}
+
+	return http.StatusOK, true
+}
+
+// handlers served alongside /metrics, added with Handle
+var handlers = map[string]http.HandlerFunc{}
+
+// Handle serve handler at pattern alongside /metrics, to the same clients. It
+// must be called before Serve.
+func Handle(pattern string, handler http.HandlerFunc) {
+	handlers[pattern] = handler
+}
+
+// guard refuse requests access doesn't permit before they reach handler
+func (a Access) guard(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if status, ok := a.permits(r); !ok {
+			if status == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", `Basic realm="gotail"`)
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// Serve serve metrics at /metrics on addr, along with anything added with
+// Handle, to clients access permits, over TLS if tlsConfig is set. It only
+// returns on error.
+func Serve(addr string, tlsConfig *tls.Config, access Access) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", access.guard(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		Write(w)
+	}))
+	for pattern, handler := range handlers {
+		mux.HandleFunc(pattern, access.guard(handler))
+	}
+
+	if tlsConfig == nil {
+		return http.ListenAndServe(addr, mux)
+	}
+	server := &http.Server{Addr: addr, Handler: mux, TLSConfig: tlsConfig}
+
+	return server.ListenAndServeTLS("", "")
+}
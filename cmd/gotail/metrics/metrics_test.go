@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestWrite(t *testing.T) {
+	is := is.New(t)
+
+	s := For(`/var/log/"app".log`)
+	s.SetUp(true)
+	s.Line(10, true)
+	s.Line(5, false)
+	s.Restart()
+
+	var b bytes.Buffer
+	Write(&b)
+	out := b.String()
+
+	is.True(strings.Contains(out, "# TYPE gotail_lines_total counter\n"))
+	is.True(strings.Contains(out, `gotail_lines_total{path="/var/log/\"app\".log"} 2`))
+	is.True(strings.Contains(out, `gotail_bytes_total{path="/var/log/\"app\".log"} 15`))
+	is.True(strings.Contains(out, `gotail_matched_total{path="/var/log/\"app\".log"} 1`))
+	is.True(strings.Contains(out, `gotail_dropped_total{path="/var/log/\"app\".log"} 1`))
+	is.True(strings.Contains(out, `gotail_shed_bytes_total{path="/var/log/\"app\".log"} 0`))
+	is.True(strings.Contains(out, `gotail_restarts_total{path="/var/log/\"app\".log"} 1`))
+	is.True(strings.Contains(out, `gotail_follower_up{path="/var/log/\"app\".log"} 1`))
+	is.True(strings.Contains(out, `gotail_json_errors_total{path="/var/log/\"app\".log"} 0`))
+	is.True(strings.Contains(out, "gotail_followed_sources 1\n"))
+	is.True(!strings.Contains(out, "gotail_forward_sent_total"))
+
+	// Forwarding counts are written once lines are forwarded
+	ForwardSent()
+	ForwardDropped(2)
+	SetForwardQueued(100)
+	b.Reset()
+	Write(&b)
+	out = b.String()
+	is.True(strings.Contains(out, "gotail_forward_sent_total 1\n"))
+	is.True(strings.Contains(out, "gotail_forward_dropped_total 2\n"))
+	is.True(strings.Contains(out, "gotail_forward_queued_bytes 100\n"))
+}
+
+func TestOffset(t *testing.T) {
+	is := is.New(t)
+
+	s := For("command")
+	_, ok := s.Offset()
+	is.True(!ok)
+
+	s = For("/var/log/offset.log")
+	s.SetOffset(1024)
+	offset, ok := s.Offset()
+	is.True(ok)
+	is.Equal(offset, int64(1024))
+}
+
+func TestTLSConfig(t *testing.T) {
+	is := is.New(t)
+
+	// Write a self-signed certificate and its key
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	is.NoErr(err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	is.NoErr(err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	is.NoErr(err)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	is.NoErr(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	is.NoErr(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	config, err := TLSConfig(certFile, keyFile, "")
+	is.NoErr(err)
+	is.Equal(len(config.Certificates), 1)
+	is.Equal(config.ClientAuth, tls.NoClientCert)
+
+	config, err = TLSConfig(certFile, keyFile, certFile)
+	is.NoErr(err)
+	is.Equal(config.ClientAuth, tls.RequireAndVerifyClientCert)
+
+	_, err = TLSConfig(certFile, keyFile, keyFile)
+	is.True(err != nil) // no certificates in the CA file
+	_, err = TLSConfig(keyFile, keyFile, "")
+	is.True(err != nil)
+}
+
+func TestAccess(t *testing.T) {
+	is := is.New(t)
+
+	allowed, err := ParseAllowed([]string{"10.0.0.0/8", "192.168.1.5"})
+	is.NoErr(err)
+	_, err = ParseAllowed([]string{"10.0.0.0/33"})
+	is.True(err != nil)
+
+	access := Access{Token: "s3cret", Allowed: allowed}
+	for _, test := range []struct {
+		remote, auth string
+		status       int
+	}{
+		{"10.1.2.3:4000", "Bearer s3cret", http.StatusOK},
+		{"192.168.1.5:4000", "Basic " + base64.StdEncoding.EncodeToString([]byte("prometheus:s3cret")), http.StatusOK},
+		{"10.1.2.3:4000", "Bearer wrong", http.StatusUnauthorized},
+		{"10.1.2.3:4000", "", http.StatusUnauthorized},
+		{"192.168.1.6:4000", "Bearer s3cret", http.StatusForbidden},
+	} {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		r.RemoteAddr = test.remote
+		if test.auth != "" {
+			r.Header.Set("Authorization", test.auth)
+		}
+		status, _ := access.permits(r)
+		is.Equal(status, test.status)
+	}
+
+	// Handlers added with Handle are refused in the same way
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/lines", nil)
+	r.RemoteAddr = "10.1.2.3:4000"
+	access.guard(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("request not refused")
+	})(w, r)
+	is.Equal(w.Code, http.StatusUnauthorized)
+}
@@ -0,0 +1,57 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/imarsman/gotail/cmd/gotail/metrics"
+)
+
+/*
+	A followed file whose permissions change so that it can no longer be
+	opened, which is found when it is reopened after rotation or truncation,
+	is kept rather than dropped or restarted over and over. That access was
+	denied is reported once, the source is marked down, and the file is
+	checked until it can be opened again, when it is followed from where it
+	was read up to.
+*/
+
+// accessInterval how often a file that can't be opened is checked
+const accessInterval = time.Second
+
+// denied check whether path can't be opened for lack of permission
+func denied(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return os.IsPermission(err)
+	}
+	file.Close()
+
+	return false
+}
+
+// waitForAccess wait until path can be opened if permission to open it is
+// denied, reporting on stderr when access is lost and when it is back. It
+// gets false if stop is closed while waiting. A nil stop is never closed.
+func waitForAccess(path string, m *metrics.Source, stop <-chan struct{}) bool {
+	if !denied(path) {
+		return true
+	}
+	fmt.Fprintln(os.Stderr, Colour(BrightRed, fmt.Sprintf("Permission denied reading %s, following it again once it can be read", path)))
+	m.SetUp(false)
+
+	ticker := time.NewTicker(accessInterval)
+	defer ticker.Stop()
+	for denied(path) {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return false
+		}
+	}
+	fmt.Fprintln(os.Stderr, Colour(BrightGreen, fmt.Sprintf("%s can be read again, following it", path)))
+	m.SetUp(true)
+
+	return true
+}
@@ -0,0 +1,140 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/imarsman/gotail/internal/config"
+	"github.com/imarsman/gotail/internal/input"
+	"github.com/imarsman/gotail/internal/util"
+)
+
+/*
+	A rule in the config file with a count and a window is an alert, raised
+	when more lines than the count match it within the window. Only lines read
+	while following are counted, so the lines printed when gotail starts
+	don't raise alerts for what happened before. An alert is written to stderr
+	and sent to the webhook and command set under notify in the config file.
+	It is raised again only once matches have fallen back to the count.
+*/
+
+// alertState the recent matches of an alert rule
+type alertState struct {
+	mutex   sync.Mutex
+	count   int
+	window  time.Duration
+	matches []time.Time // times of the last count+1 matches, oldest first
+	raised  bool
+}
+
+// alertsOn 1 once StartAlerts has been called
+var alertsOn int32
+
+// alertNotify where alerts are sent as well as stderr, set by StartAlerts
+var alertNotify *config.Notify
+
+// alertClient the client alerts are posted to webhooks with
+var alertClient = &http.Client{Timeout: 10 * time.Second}
+
+// alertEvent an alert as it is posted to a webhook
+type alertEvent struct {
+	Rule   string `json:"rule"`
+	Count  int    `json:"count"`
+	Window string `json:"window"`
+	Time   string `json:"time"`
+	Line   string `json:"line"`
+}
+
+// StartAlerts start counting lines that match alert rules, sending alerts to
+// notify as well as stderr. It is called once following has begun.
+func StartAlerts(notify *config.Notify) {
+	alertNotify = notify
+	atomic.StoreInt32(&alertsOn, 1)
+}
+
+// match count a match of the rule at now, getting whether more lines than
+// the count have now matched within the window for the first time since
+// matches fell back to the count
+func (a *alertState) match(now time.Time) (raise bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.matches = append(a.matches, now)
+	if len(a.matches) > a.count+1 {
+		a.matches = a.matches[1:]
+	}
+	over := len(a.matches) > a.count && now.Sub(a.matches[0]) <= a.window
+	raise = over && !a.raised
+	a.raised = over
+
+	return
+}
+
+// checkAlert count a line matching the alert rule r, raising an alert if the
+// rule has now matched too often
+func checkAlert(r rule, line *Line) {
+	if atomic.LoadInt32(&alertsOn) == 0 {
+		return
+	}
+	now := time.Now()
+	if !r.alert.match(now) {
+		return
+	}
+
+	event := alertEvent{
+		Rule:   r.name,
+		Count:  r.alert.count,
+		Window: r.alert.window.String(),
+		Time:   now.Format(time.RFC3339),
+		Line:   line.Text,
+	}
+	fmt.Fprintln(os.Stderr, Colour(BrightRed, fmt.Sprintf("Alert %s: more than %d %s matched in %s", event.Rule, event.Count, util.Pluralize("line", "lines", event.Count), event.Window)))
+	if alertNotify == nil {
+		return
+	}
+	if alertNotify.Webhook != "" {
+		go postAlert(alertNotify.Webhook, event)
+	}
+	if alertNotify.Command != "" {
+		go runAlert(alertNotify.Command, event)
+	}
+}
+
+// postAlert post event to url as a JSON object
+func postAlert(url string, event alertEvent) {
+	b, _ := json.Marshal(event)
+	resp, err := alertClient.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, Colour(BrightRed, "Could not send alert:", err.Error()))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		fmt.Fprintln(os.Stderr, Colour(BrightRed, "Could not send alert:", resp.Status))
+	}
+}
+
+// runAlert run command with the system shell, giving it event in
+// GOTAIL_ALERT_* environment variables
+func runAlert(command string, event alertEvent) {
+	args := input.ShellCommand(command)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"GOTAIL_ALERT_RULE="+event.Rule,
+		"GOTAIL_ALERT_COUNT="+strconv.Itoa(event.Count),
+		"GOTAIL_ALERT_WINDOW="+event.Window,
+		"GOTAIL_ALERT_TIME="+event.Time,
+		"GOTAIL_ALERT_LINE="+event.Line,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		fmt.Fprintln(os.Stderr, Colour(BrightRed, "Alert command failed:", err.Error(), string(bytes.TrimSpace(out))))
+	}
+}
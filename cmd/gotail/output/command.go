@@ -0,0 +1,242 @@
+package output
+
+import (
+	"io"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/imarsman/gotail/cmd/gotail/metrics"
+	"github.com/imarsman/gotail/internal/config"
+	"github.com/imarsman/gotail/internal/input"
+)
+
+// FollowedCommand a command whose output is followed, such as tail run inside
+// a container, or another stream such as standard input. Lines are printed
+// along with those of followed files.
+type FollowedCommand struct {
+	Name     string    // used in place of a path in headers
+	Cmd      *exec.Cmd // nil for a stream that isn't a command
+	Source   *config.Source
+	Format   Format
+	Metrics  *metrics.Source
+	done     chan struct{} // closed when the command has ended
+	stop     chan struct{} // closed to stop reading
+	stopOnce sync.Once
+	err      error // set from Wait before done is closed
+	stopped  int32 // 1 if ended by Stop
+}
+
+// NewFollowedCommand start command and print its output lines as they arrive.
+// Compressed output is decompressed as it is read. Lines the command writes
+// to its standard error are printed as errors.
+func NewFollowedCommand(name string, command []string) (fc *FollowedCommand, err error) {
+	fc = &FollowedCommand{}
+	fc.Name = name
+	fc.Cmd = exec.Command(command[0], command[1:]...)
+	fc.Source = config.ForPath(name)
+	fc.Format = FormatFor(nil)
+	fc.Metrics = metrics.For(name)
+	fc.done = make(chan struct{})
+	fc.stop = make(chan struct{})
+
+	stdout, err := fc.Cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := fc.Cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = fc.Cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	// Both pipes must be read to their end before waiting for the command
+	errorsDone := make(chan struct{})
+	go func() {
+		defer close(errorsDone)
+		fc.readErrors(stderr)
+	}()
+
+	go func() {
+		defer close(fc.done)
+
+		fc.Metrics.SetUp(true)
+		defer fc.Metrics.SetUp(false)
+
+		err := fc.read(stdout)
+		if err != nil {
+			outputPrinter.print(fc.Name, Colour(BrightRed, err.Error()))
+			// Output is no longer being read so the command may never exit
+			fc.Cmd.Process.Kill()
+		}
+		<-errorsDone
+		fc.err = fc.Cmd.Wait()
+	}()
+
+	return
+}
+
+// NewFollowedReader print lines read from reader as they arrive, such as
+// standard input, until it ends. The name is used in place of a path.
+func NewFollowedReader(name string, reader io.Reader) (fc *FollowedCommand) {
+	fc = &FollowedCommand{}
+	fc.Name = name
+	fc.Source = config.ForPath(name)
+	fc.Format = FormatFor(nil)
+	fc.Metrics = metrics.For(name)
+	fc.done = make(chan struct{})
+	fc.stop = make(chan struct{})
+
+	go func() {
+		defer close(fc.done)
+
+		fc.Metrics.SetUp(true)
+		defer fc.Metrics.SetUp(false)
+
+		if err := fc.read(reader); err != nil {
+			outputPrinter.print(fc.Name, Colour(BrightRed, err.Error()))
+			fc.err = err
+		}
+	}()
+
+	return
+}
+
+// readErrors print the lines the command writes to its standard error, so
+// that the reason a command fails is shown along with its output
+func (fc *FollowedCommand) readErrors(stderr io.Reader) {
+	scanner := input.NewScanner(fc.Name, stderr)
+	for scanner.Scan() {
+		outputPrinter.print(fc.Name, Colour(BrightRed, scanner.Text()))
+	}
+}
+
+// sniffWait how long to wait for more of the first lines of a command's output
+// before detecting its format from the lines there are
+const sniffWait = 500 * time.Millisecond
+
+// read print lines from the command's output until it ends or reading is
+// stopped. Lines are read separately as a read from a stream that isn't a
+// command can't be interrupted. Unless a format is given with the format hint
+// the first lines are held until it is detected from them, as it is for
+// files.
+func (fc *FollowedCommand) read(stdout io.Reader) error {
+	lines := make(chan string)
+	var scanErr error // set before lines is closed
+	go func() {
+		defer close(lines)
+		reader, err := input.Decompress(stdout, fc.Source.Compression)
+		if err != nil {
+			scanErr = err
+			return
+		}
+		if closer, ok := reader.(io.Closer); ok {
+			defer closer.Close()
+		}
+		scanner := input.NewScanner(fc.Name, fc.Source.NewReader(reader))
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-fc.stop:
+				return
+			}
+		}
+		scanErr = scanner.Err()
+	}()
+
+	sniffing := options.FormatHint == "" || options.FormatHint == "auto"
+	var sniffed []string
+	detect := func() {
+		if !sniffing {
+			return
+		}
+		sniffing = false
+		fc.Format = FormatFor(sniffed)
+		for _, text := range sniffed {
+			fc.printLine(text)
+		}
+		sniffed = nil
+	}
+	timer := time.NewTimer(sniffWait)
+	defer timer.Stop()
+
+	// A line that panics when printed is skipped and reading goes on
+	var err error
+	supervise(fc.Name, fc.Metrics, fc.stop, func() error {
+		for {
+			select {
+			case text, ok := <-lines:
+				if !ok {
+					detect()
+					err = scanErr
+					return nil
+				}
+				if sniffing {
+					sniffed = append(sniffed, text)
+					if len(sniffed) == SniffLines {
+						detect()
+					}
+					continue
+				}
+				fc.printLine(text)
+			case <-timer.C:
+				detect()
+			case <-fc.stop:
+				detect()
+				return nil
+			}
+		}
+	})
+
+	return err
+}
+
+// printLine print a line of the command's output
+func (fc *FollowedCommand) printLine(text string) {
+	output, err := GetOutput(fc.Name, fc.Source, fc.Format, text)
+	fc.Metrics.Line(len(text), err == nil)
+	if err != nil {
+		return
+	}
+	outputPrinter.print(fc.Name, output)
+}
+
+// Done closed when the command has ended and its output has been sent for
+// printing
+func (fc *FollowedCommand) Done() <-chan struct{} {
+	return fc.done
+}
+
+// Err the error the command ended with, if any. Commands ended with Stop have
+// no error.
+func (fc *FollowedCommand) Err() error {
+	<-fc.done
+	if atomic.LoadInt32(&fc.stopped) == 1 {
+		return nil
+	}
+	return fc.err
+}
+
+// Stop end the command and wait for output already read to be sent for printing
+func (fc *FollowedCommand) Stop() (err error) {
+	select {
+	case <-fc.done:
+		// Already ended by itself
+		return
+	default:
+	}
+	atomic.StoreInt32(&fc.stopped, 1)
+	fc.stopOnce.Do(func() {
+		close(fc.stop)
+	})
+	if fc.Cmd != nil {
+		fc.Cmd.Process.Kill()
+	}
+	<-fc.done
+
+	return
+}
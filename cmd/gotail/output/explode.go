@@ -0,0 +1,60 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/imarsman/gotail/internal/config"
+)
+
+// explodeArray split text holding only a JSON array into its elements, each as
+// compact JSON with keys kept in order. ok is false if text isn't an array.
+func explodeArray(text string) (elements []string, ok bool) {
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "[") {
+		return nil, false
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal([]byte(trimmed), &raw); err != nil {
+		return nil, false
+	}
+
+	elements = make([]string, 0, len(raw))
+	var buf bytes.Buffer
+	for _, r := range raw {
+		buf.Reset()
+		if err := json.Compact(&buf, r); err != nil {
+			return nil, false
+		}
+		elements = append(elements, buf.String())
+	}
+
+	return elements, true
+}
+
+// explodeOutput run each element of an array line through the pipeline,
+// joining the output of those kept. Elements have the line number of the line
+// they are from.
+func explodeOutput(path string, source *config.Source, format Format, elements []string) (output string, err error) {
+	number := peekLineNumber(path)
+
+	var kept []string
+	for _, element := range elements {
+		if number > 0 {
+			SetLineNumber(path, number)
+		}
+		if out, ok := pipeline.Run(path, source, format, element); ok {
+			kept = append(kept, out)
+		}
+	}
+	if number > 0 {
+		SetLineNumber(path, number+1)
+	}
+	if len(kept) == 0 {
+		return "", errors.New("line filtered out")
+	}
+
+	return strings.Join(kept, "\n"), nil
+}
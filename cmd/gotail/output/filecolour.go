@@ -0,0 +1,50 @@
+package output
+
+import "sync"
+
+/*
+	With --file-colours each source is given a colour of its own for its
+	headers, taken in turn from a palette as sources are first printed, so
+	that interleaved output from several files is easy to tell apart. A colour
+	set for a source in the config file is used instead. With --file-bar a bar
+	in the source's colour is printed before each followed line as well.
+*/
+
+// filePalette colours given in turn to sources. Red is left out as it marks
+// errors and flagged lines.
+var filePalette = []int{BrightBlue, BrightGreen, BrightYellow, BrightMagenta, BrightCyan, BrightWhite}
+
+// fileColours the colour given to each source, nil unless SetFileColours has
+// been called
+var fileColours map[string]int
+var fileColoursMutex sync.Mutex
+
+// fileBar whether a bar in the source's colour is printed before followed
+// lines
+var fileBar bool
+
+// fileBarText the bar printed before followed lines with --file-bar
+const fileBarText = "┃ "
+
+// SetFileColours give each source a colour of its own for its headers and,
+// with bar set, a bar printed before each followed line. It must be called
+// before any lines are printed.
+func SetFileColours(bar bool) {
+	fileColours = make(map[string]int)
+	fileBar = bar
+}
+
+// fileColour get the colour given to path, giving it the next colour in the
+// palette if it has none yet
+func fileColour(path string) int {
+	fileColoursMutex.Lock()
+	defer fileColoursMutex.Unlock()
+
+	colour, ok := fileColours[path]
+	if !ok {
+		colour = filePalette[len(fileColours)%len(filePalette)]
+		fileColours[path] = colour
+	}
+
+	return colour
+}
@@ -0,0 +1,166 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Format the kind of lines a source contains
+type Format int
+
+const (
+	// FormatPlain lines with no recognized structure
+	FormatPlain Format = iota
+	// FormatJSON lines that are JSON objects
+	FormatJSON
+	// FormatLogfmt lines of key=value pairs
+	FormatLogfmt
+	// FormatAccess web server access log lines in common or combined format
+	FormatAccess
+)
+
+// SniffLines the number of non-empty lines examined when detecting format
+const SniffLines = 10
+
+var reLogfmt = regexp.MustCompile(`^\s*([\w.\-]+=("[^"]*"|\S*)\s*){2,}$`)
+var reLogfmtKey = regexp.MustCompile(`(^|\s)([\w.\-]+)=`)
+var reAccess = regexp.MustCompile(`^\S+ \S+ \S+ \[[^\]]+\] "[^"]*" (\d{3}) `)
+var reJSONKey = regexp.MustCompile(`"([^"\\]|\\.)*"\s*:`)
+
+func (f Format) String() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatLogfmt:
+		return "logfmt"
+	case FormatAccess:
+		return "access"
+	default:
+		return "plain"
+	}
+}
+
+// ParseFormat get a format from its name. The name auto is not a format and
+// is handled by FormatFor.
+func ParseFormat(name string) (f Format, err error) {
+	switch strings.ToLower(name) {
+	case "json":
+		f = FormatJSON
+	case "logfmt":
+		f = FormatLogfmt
+	case "access":
+		f = FormatAccess
+	case "plain":
+		f = FormatPlain
+	default:
+		err = fmt.Errorf("unknown format %q", name)
+	}
+
+	return
+}
+
+// lineFormat classify a single line
+func lineFormat(line string) Format {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+		return FormatJSON
+	}
+	if reAccess.MatchString(line) {
+		return FormatAccess
+	}
+	if reLogfmt.MatchString(line) {
+		return FormatLogfmt
+	}
+
+	return FormatPlain
+}
+
+// DetectFormat classify a source by its first non-empty lines. A format is
+// chosen if more than half of the lines examined have it.
+func DetectFormat(lines []string) Format {
+	counts := map[Format]int{}
+	examined := 0
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		counts[lineFormat(line)]++
+		examined++
+		if examined == SniffLines {
+			break
+		}
+	}
+
+	for f, count := range counts {
+		if count*2 > examined {
+			return f
+		}
+	}
+
+	return FormatPlain
+}
+
+// FormatFor get the format for a source using the format hint in the options
+// if it is set and detection otherwise.
+func FormatFor(lines []string) Format {
+	if options.FormatHint != "" && options.FormatHint != "auto" {
+		f, err := ParseFormat(options.FormatHint)
+		if err == nil {
+			return f
+		}
+	}
+
+	return DetectFormat(lines)
+}
+
+// statusColour get the colour for an HTTP status code
+func statusColour(status string) int {
+	switch status[0] {
+	case '2':
+		return BrightGreen
+	case '3':
+		return BrightBlue
+	case '4':
+		return BrightYellow
+	case '5':
+		return BrightRed
+	default:
+		return NoColour
+	}
+}
+
+// Highlight colour parts of a line according to the format of its source.
+// Lines that don't have the format are returned unchanged.
+func (f Format) Highlight(line string) string {
+	if !useColour {
+		return line
+	}
+
+	switch f {
+	case FormatJSON:
+		// Indented JSON output is already coloured
+		if options.JSON {
+			return line
+		}
+		return reJSONKey.ReplaceAllStringFunc(line, func(key string) string {
+			return Colour(BrightBlue, key)
+		})
+	case FormatLogfmt:
+		return reLogfmtKey.ReplaceAllStringFunc(line, func(key string) string {
+			// Keep the leading space uncoloured
+			space := key[:len(key)-len(strings.TrimLeft(key, " \t"))]
+			return space + Colour(BrightBlue, strings.TrimLeft(key, " \t"))
+		})
+	case FormatAccess:
+		loc := reAccess.FindStringSubmatchIndex(line)
+		if loc == nil {
+			return line
+		}
+		status := line[loc[2]:loc[3]]
+		return line[:loc[2]] + Colour(statusColour(status), status) + line[loc[3]:]
+	default:
+		return line
+	}
+}
@@ -0,0 +1,286 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imarsman/gotail/cmd/gotail/metrics"
+)
+
+/*
+	With --forward every line that would be printed is also written to a socket
+	as a JSON object like those of --output ndjson, one per line for streams and
+	one per datagram for udp and unixgram. Lines are forwarded before JSON is
+	formatted or colour added so that they are as read, less anything filtered
+	out. If the connection is lost it is made again in the background, waiting
+	longer after each failure. Until then lines are dropped, with a warning, or
+	with --forward-queue kept in a file of limited size and sent once the
+	connection is back. Lines queued when gotail exits are sent the next time
+	it runs with the same queue file.
+*/
+
+// forwardDialTimeout how long to wait to connect to the forward address
+const forwardDialTimeout = 5 * time.Second
+
+// The shortest and longest waits between attempts to connect again
+const (
+	forwardMinBackoff = 500 * time.Millisecond
+	forwardMaxBackoff = 30 * time.Second
+)
+
+// forwarder the connection lines are forwarded on
+type forwarder struct {
+	mutex   sync.Mutex
+	network string
+	address string
+	conn    net.Conn   // nil while the connection is down
+	queue   *diskQueue // nil if lines aren't kept while the connection is down
+	only    bool       // forward lines instead of printing them
+	warned  bool       // whether the current outage has been warned about
+	retry   bool       // whether the connection is being made again
+	closed  bool
+	stop    chan struct{} // closed to stop waiting to connect again
+}
+
+// forward set with SetForward, nil if lines aren't forwarded
+var forward *forwarder
+
+// ParseForward get the network and address of a --forward value given as
+// tcp://host:port, udp://host:port, unix:///path, or unixgram:///path
+func ParseForward(value string) (network, address string, err error) {
+	for _, network := range []string{"tcp", "udp", "unix", "unixgram"} {
+		prefix := network + "://"
+		if strings.HasPrefix(value, prefix) && len(value) > len(prefix) {
+			return network, value[len(prefix):], nil
+		}
+	}
+
+	return "", "", fmt.Errorf("invalid --forward address %q, expected tcp://, udp://, unix://, or unixgram://", value)
+}
+
+// SetForward forward lines to addr, as well as printing them or, if only is
+// true, instead of printing them. The first connection is made now so that a
+// wrong address is found at once. It must be called before any lines are
+// processed.
+func SetForward(addr string, only bool) error {
+	network, address, err := ParseForward(addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout(network, address, forwardDialTimeout)
+	if err != nil {
+		return fmt.Errorf("could not connect to --forward address: %v", err)
+	}
+	forward = &forwarder{network: network, address: address, conn: conn, only: only, stop: make(chan struct{})}
+
+	return nil
+}
+
+// SetForwardQueue keep lines that can't be forwarded in the file at path, up to
+// max bytes of them, rather than dropping them. When it is full the newest
+// line is dropped, or the oldest lines if dropOldest is true. Lines left in
+// the file by an earlier run are sent first. It must be called after
+// SetForward and before any lines are processed.
+func SetForwardQueue(path string, max int64, dropOldest bool) error {
+	queue, err := openQueue(path, max, dropOldest)
+	if err != nil {
+		return fmt.Errorf("could not open --forward-queue: %v", err)
+	}
+	forward.queue = queue
+	metrics.SetForwardQueued(queue.pending())
+	// Lines left by an earlier run are sent on a new connection in the
+	// background, with new lines queued behind them
+	if queue.pending() > 0 {
+		forward.disconnect(nil)
+	}
+
+	return nil
+}
+
+// frame get a record as it is sent, ended with a newline over streams
+func (f *forwarder) frame(record []byte) []byte {
+	if f.network == "tcp" || f.network == "unix" {
+		return append(record, '\n')
+	}
+
+	return record
+}
+
+// send forward a record, queueing it or dropping it if the connection is down
+// or lines queued earlier are still to be sent
+func (f *forwarder) send(record []byte) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return
+	}
+	if f.conn != nil && (f.queue == nil || f.queue.pending() == 0) {
+		_, err := f.conn.Write(f.frame(record))
+		if err == nil {
+			metrics.ForwardSent()
+			return
+		}
+		f.disconnect(err)
+	}
+	if f.queue == nil {
+		metrics.ForwardDropped(1)
+		return
+	}
+	dropped, err := f.queue.push(record)
+	if err != nil {
+		f.warn(err)
+		dropped = 1
+	}
+	metrics.ForwardDropped(dropped)
+	metrics.SetForwardQueued(f.queue.pending())
+}
+
+// disconnect close the connection after err, warning about it if it isn't
+// nil, and start connecting again in the background unless that has already
+// started. f.mutex must be held.
+func (f *forwarder) disconnect(err error) {
+	if err != nil {
+		f.warn(err)
+	}
+	if f.conn != nil {
+		f.conn.Close()
+		f.conn = nil
+	}
+	if f.retry {
+		return
+	}
+	f.retry = true
+	go f.reconnect()
+}
+
+// reconnect connect again, waiting longer after each failure, then send any
+// lines queued while the connection was down
+func (f *forwarder) reconnect() {
+	backoff := forwardMinBackoff
+	for {
+		conn, err := net.DialTimeout(f.network, f.address, forwardDialTimeout)
+		f.mutex.Lock()
+		if f.closed {
+			if conn != nil {
+				conn.Close()
+			}
+			f.mutex.Unlock()
+			return
+		}
+		if err == nil {
+			f.conn = conn
+			if err = f.drain(); err == nil {
+				f.retry = false
+				if f.warned {
+					fmt.Fprintln(os.Stderr, Colour(BrightGreen, "Forwarding to "+f.address+" resumed"))
+					f.warned = false
+				}
+				f.mutex.Unlock()
+				return
+			}
+			f.conn.Close()
+			f.conn = nil
+		}
+		f.warn(err)
+		f.mutex.Unlock()
+
+		select {
+		case <-f.stop:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > forwardMaxBackoff {
+			backoff = forwardMaxBackoff
+		}
+	}
+}
+
+// drain send the lines queued while the connection was down. f.mutex must be
+// held, so that new lines wait until those before them have been sent.
+func (f *forwarder) drain() error {
+	if f.queue == nil {
+		return nil
+	}
+	defer metrics.SetForwardQueued(f.queue.pending())
+
+	for f.queue.pending() > 0 {
+		record, err := f.queue.peek()
+		if err != nil {
+			return err
+		}
+		if _, err = f.conn.Write(f.frame(record)); err != nil {
+			return err
+		}
+		metrics.ForwardSent()
+		if err = f.queue.pop(len(record)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// warn say once for each outage that lines can't be forwarded. f.mutex must
+// be held.
+func (f *forwarder) warn(err error) {
+	if f.warned {
+		return
+	}
+	f.warned = true
+	action := "dropping them"
+	if f.queue != nil {
+		action = "queueing them"
+	}
+	fmt.Fprintln(os.Stderr, Colour(BrightRed, "Could not forward lines, "+action+" until "+f.address+" can be reached again: "+err.Error()))
+}
+
+// close stop connecting again and close the connection and queue
+func (f *forwarder) close() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.closed = true
+	close(f.stop)
+	if f.conn != nil {
+		f.conn.Close()
+		f.conn = nil
+	}
+	if f.queue != nil {
+		f.queue.close()
+	}
+}
+
+// stage send the line as a JSON object, dropping it from what is printed if
+// lines are only forwarded
+func (f *forwarder) stage(line *Line) bool {
+	r := record{
+		File:       line.Path,
+		Host:       line.Host,
+		LineNumber: line.Number,
+		Text:       line.Text,
+		Note:       line.Note,
+	}
+	if !line.Time.IsZero() {
+		r.Timestamp = line.Time.Format(time.RFC3339Nano)
+		r.TimeSource = line.Origin
+	}
+	b, err := json.Marshal(r)
+	if err == nil {
+		f.send(b)
+	}
+
+	return !f.only
+}
+
+// stopForward close the connection lines are forwarded on
+func stopForward() {
+	if forward != nil {
+		forward.close()
+	}
+}
@@ -0,0 +1,58 @@
+package output
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// hashLength the number of hex characters kept from each hash
+const hashLength = 16
+
+// fieldHasher replaces the values of fields with stable hashes so that lines
+// can be counted and compared without exposing the values.
+type fieldHasher struct {
+	key      []byte
+	jsonRe   *regexp.Regexp // matches "field": value
+	logfmtRe *regexp.Regexp // matches field=value
+}
+
+func newFieldHasher(key string, fields []string) *fieldHasher {
+	quoted := make([]string, 0, len(fields))
+	for _, f := range fields {
+		quoted = append(quoted, regexp.QuoteMeta(f))
+	}
+	names := strings.Join(quoted, "|")
+
+	h := new(fieldHasher)
+	h.key = []byte(key)
+	h.jsonRe = regexp.MustCompile(`("(?:` + names + `)"\s*:\s*)("(?:[^"\\]|\\.)*"|[^,}\]\s]+)`)
+	h.logfmtRe = regexp.MustCompile(`((?:^|\s)(?:` + names + `)=)("[^"]*"|\S*)`)
+
+	return h
+}
+
+// hash get the truncated HMAC-SHA256 of value as hex
+func (h *fieldHasher) hash(value string) string {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil))[:hashLength]
+}
+
+// replace replace the values of hashed fields in line. Quotes around values
+// are not part of what is hashed so that quoted and unquoted values match.
+func (h *fieldHasher) replace(line string) string {
+	line = h.jsonRe.ReplaceAllStringFunc(line, func(match string) string {
+		parts := h.jsonRe.FindStringSubmatch(match)
+		return parts[1] + `"` + h.hash(strings.Trim(parts[2], `"`)) + `"`
+	})
+	line = h.logfmtRe.ReplaceAllStringFunc(line, func(match string) string {
+		parts := h.logfmtRe.FindStringSubmatch(match)
+		return parts[1] + h.hash(strings.Trim(parts[2], `"`))
+	})
+
+	return line
+}
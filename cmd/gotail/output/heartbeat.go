@@ -0,0 +1,112 @@
+package output
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/imarsman/gotail/cmd/gotail/metrics"
+)
+
+// statsRecord a record written between line records with the counts for a
+// source, so that something reading the output can tell gotail is keeping up
+type statsRecord struct {
+	Type        string  `json:"type"`
+	File        string  `json:"file"`
+	Time        string  `json:"time"`
+	Up          bool    `json:"up"`
+	Lines       uint64  `json:"lines"`
+	Bytes       uint64  `json:"bytes"`
+	Matched     uint64  `json:"matched"`
+	Dropped     uint64  `json:"dropped"`
+	ShedBytes   uint64  `json:"shed_bytes,omitempty"`
+	Offset      *int64  `json:"offset,omitempty"`
+	LagBytes    *int64  `json:"lag_bytes,omitempty"`
+	IdleSeconds float64 `json:"idle_seconds"`
+}
+
+// heartbeats stop and done for writing stats records, if they are written
+var heartbeats struct {
+	stop chan struct{} // closed to stop writing records
+	done chan struct{} // closed once records have stopped
+}
+
+// lagFor get the bytes written to a followed file that haven't been read yet.
+// ok is false for sources that aren't files, which have no lag.
+func lagFor(name string, s *metrics.Source) (lag int64, ok bool) {
+	offset, ok := s.Offset()
+	if !ok {
+		return 0, false
+	}
+	fi, err := os.Stat(name)
+	if err != nil || !fi.Mode().IsRegular() {
+		return 0, false
+	}
+	// A file truncated or rotated since it was read has no lag
+	if lag = fi.Size() - offset; lag < 0 {
+		lag = 0
+	}
+
+	return lag, true
+}
+
+// statsFor get the stats record for a source at now
+func statsFor(name string, s *metrics.Source, now time.Time) statsRecord {
+	r := statsRecord{
+		Type:        "stats",
+		File:        name,
+		Time:        now.Format(time.RFC3339Nano),
+		Up:          s.Up(),
+		Lines:       s.Lines(),
+		Bytes:       s.Bytes(),
+		Matched:     s.Matched(),
+		Dropped:     s.Dropped(),
+		ShedBytes:   s.ShedBytes(),
+		IdleSeconds: now.Sub(s.LastActivity()).Seconds(),
+	}
+	if offset, ok := s.Offset(); ok {
+		r.Offset = &offset
+	}
+	if lag, ok := lagFor(name, s); ok {
+		r.LagBytes = &lag
+	}
+
+	return r
+}
+
+// StartHeartbeats write a stats record for each source every interval, in
+// with the line records. It must be called before any lines are processed.
+func StartHeartbeats(every time.Duration) {
+	heartbeats.stop = make(chan struct{})
+	heartbeats.done = make(chan struct{})
+
+	go func() {
+		defer close(heartbeats.done)
+
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-heartbeats.stop:
+				return
+			case now := <-ticker.C:
+				metrics.Each(func(name string, s *metrics.Source) {
+					data, err := json.Marshal(statsFor(name, s, now))
+					if err != nil {
+						return
+					}
+					outputPrinter.print(name, string(data))
+				})
+			}
+		}
+	}()
+}
+
+// stopHeartbeats stop writing stats records and wait for any being written
+func stopHeartbeats() {
+	if heartbeats.stop == nil {
+		return
+	}
+	close(heartbeats.stop)
+	<-heartbeats.done
+}
@@ -0,0 +1,118 @@
+package output
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// highlight a regex whose matches are coloured
+type highlight struct {
+	re     *regexp.Regexp
+	colour int
+}
+
+// highlights set with SetHighlights
+var highlights []highlight
+
+// reEscape ANSI colour sequences already in a line, which highlights must not
+// match inside
+var reEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// SetHighlights colour the parts of lines matching regexes given as REGEX or
+// COLOUR:REGEX, where COLOUR is a colour name as for headers. Matches are
+// bright yellow if no colour is given. Patterns are checked as for SetMatch,
+// with a warning returned for each that is slow. It must be called before any
+// lines are processed.
+func SetHighlights(specs []string) (warnings []string, err error) {
+	highlights = highlights[:0]
+	for _, spec := range specs {
+		h := highlight{colour: BrightYellow}
+		pattern := spec
+		if i := strings.IndexByte(spec, ':'); i > 0 {
+			if colour, ok := colourNames[strings.ToLower(spec[:i])]; ok {
+				h.colour, pattern = colour, spec[i+1:]
+			}
+		}
+		if pattern == "" {
+			return nil, fmt.Errorf("invalid --highlight %q, expected REGEX or COLOUR:REGEX", spec)
+		}
+
+		re, warning, err := compileTimed("--highlight", pattern)
+		if err != nil {
+			return nil, err
+		}
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
+		h.re = re
+		highlights = append(highlights, h)
+	}
+
+	return
+}
+
+// highlightMatchStage colour the parts of lines matching highlights. Text in
+// ANSI sequences added by earlier stages is left alone.
+func highlightMatchStage(line *Line) bool {
+	line.Text = applyHighlights(line.Text, highlights)
+
+	return true
+}
+
+// applyHighlights colour the parts of text outside ANSI sequences that match
+// hs. Where matches overlap the highlight given first is used.
+func applyHighlights(text string, hs []highlight) string {
+	var matched bool
+	for _, h := range hs {
+		if h.re.MatchString(text) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return text
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, loc := range reEscape.FindAllStringIndex(text, -1) {
+		paintMatches(&sb, text[last:loc[0]], hs)
+		sb.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	paintMatches(&sb, text[last:], hs)
+
+	return sb.String()
+}
+
+// paintMatches write text, which has no ANSI sequences, to sb with the
+// matches of hs coloured
+func paintMatches(sb *strings.Builder, text string, hs []highlight) {
+	// The colour of each byte, -1 if it isn't matched. Highlights are applied
+	// last to first so that earlier ones take precedence.
+	colours := make([]int, len(text))
+	for i := range colours {
+		colours[i] = -1
+	}
+	for i := len(hs) - 1; i >= 0; i-- {
+		for _, loc := range hs[i].re.FindAllStringIndex(text, -1) {
+			for j := loc[0]; j < loc[1]; j++ {
+				colours[j] = hs[i].colour
+			}
+		}
+	}
+
+	for start := 0; start < len(text); {
+		end := start + 1
+		for end < len(text) && colours[end] == colours[start] {
+			end++
+		}
+		if colours[start] < 0 {
+			sb.WriteString(text[start:end])
+		} else {
+			sb.WriteString(paint(colours[start], text[start:end]))
+		}
+		start = end
+	}
+}
@@ -0,0 +1,39 @@
+package output
+
+import (
+	"regexp"
+
+	"github.com/imarsman/gotail/cmd/gotail/metrics"
+)
+
+// hitPatterns the --match and --highlight patterns, in the order given, whose
+// printed lines are counted for each source by HitStage
+func hitPatterns() (res []*regexp.Regexp) {
+	if lineMatch != nil {
+		res = append(res, lineMatch)
+	}
+	for _, h := range highlights {
+		res = append(res, h.re)
+	}
+
+	return
+}
+
+// HitStage count the lines matching each of res for the source they are from,
+// for the summary. A line matching several patterns counts for each.
+func HitStage(res []*regexp.Regexp) Stage {
+	return func(line *Line) bool {
+		var counter *metrics.Source
+		for _, re := range res {
+			if !re.MatchString(line.Text) {
+				continue
+			}
+			if counter == nil {
+				counter = metrics.For(line.Path)
+			}
+			counter.Hit(re.String())
+		}
+
+		return true
+	}
+}
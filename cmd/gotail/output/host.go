@@ -0,0 +1,111 @@
+package output
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/imarsman/gotail/internal/config"
+)
+
+// sshValueFlags ssh options that take a value, which must be skipped to find
+// the destination
+const sshValueFlags = "BbcDEeFIiJLlmOopQRSWw"
+
+var (
+	hosts      = map[string]string{} // host for each path, looked up once
+	hostWidth  int                   // length of the longest host, used to align the column
+	hostsMutex sync.Mutex
+	localHost  string // name of this machine, used for local sources
+)
+
+func init() {
+	localHost, _ = os.Hostname()
+	if i := strings.IndexByte(localHost, '.'); i > 0 {
+		localHost = localHost[:i]
+	}
+}
+
+// HostFor get the host lines from path come from. The host set in the config
+// file is used first, then the destination of an ssh command source, and
+// otherwise the name of this machine.
+func HostFor(path string) string {
+	hostsMutex.Lock()
+	defer hostsMutex.Unlock()
+
+	host, ok := hosts[path]
+	if ok {
+		return host
+	}
+
+	host = config.ForPath(path).Host
+	if host == "" {
+		host = sshHost(path)
+	}
+	if host == "" {
+		host = localHost
+	}
+	hosts[path] = host
+	if n := utf8.RuneCountInString(host); n > hostWidth {
+		hostWidth = n
+	}
+
+	return host
+}
+
+// sshHost get the host a command line such as "ssh -p 2222 me@web1 tail -F
+// /var/log/app.log" connects to, or an empty string if it isn't an ssh command
+func sshHost(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) < 2 || filepath.Base(fields[0]) != "ssh" {
+		return ""
+	}
+
+	for i := 1; i < len(fields); i++ {
+		field := fields[i]
+		if strings.HasPrefix(field, "-") && len(field) > 1 {
+			// A value is either joined to the flag or the next field
+			if len(field) == 2 && strings.IndexByte(sshValueFlags, field[1]) >= 0 {
+				i++
+			}
+			continue
+		}
+
+		host := strings.TrimPrefix(field, "ssh://")
+		if j := strings.LastIndexByte(host, '@'); j >= 0 {
+			host = host[j+1:]
+		}
+		if j := strings.IndexByte(host, ':'); j >= 0 && strings.HasPrefix(field, "ssh://") {
+			host = host[:j]
+		}
+		return host
+	}
+
+	return ""
+}
+
+// hostColumn get host padded to the width of the longest host seen so that
+// lines from different hosts line up
+func hostColumn(path, host string) string {
+	hostsMutex.Lock()
+	width := hostWidth
+	hostsMutex.Unlock()
+
+	padded := host + strings.Repeat(" ", width-utf8.RuneCountInString(host))
+	return Colour(HeaderColour(path), padded) + " "
+}
+
+// hostStage prefix lines with their host. It is run last so that the column
+// comes before any note.
+func hostStage(line *Line) bool {
+	text := line.Text
+	if line.Note != "" {
+		text = Colour(BrightRed, "["+line.Note+"]") + " " + text
+		line.Note = ""
+	}
+	line.Text = hostColumn(line.Path, line.Host) + text
+
+	return true
+}
@@ -0,0 +1,65 @@
+package output
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+/*
+	Line numbers printed with -N are left aligned in a column as wide as the
+	largest number expected, and at least three wide, followed by a separator.
+	The column is widened, but never narrowed, when followed lines outgrow it.
+	Numbers can start from something other than 1, as with cat and nl, which
+	moves every number of a source by the same amount, including those of a
+	head starting at a line given with +N.
+*/
+
+var (
+	numberWidth     int64 = 3   // width of the line number column
+	numberStart           = 1   // number printed for the first line of a source
+	numberSeparator       = " " // printed between a line number and its line
+)
+
+// SetLineNumbers set the number printed for the first line of a source and
+// the text printed between line numbers and lines. It must be called before
+// any lines are printed.
+func SetLineNumbers(start int, separator string) {
+	numberStart = start
+	numberSeparator = separator
+}
+
+// WidenLineNumbers make the line number column wide enough for the numbers of
+// lines up to last, counting from 1
+func WidenLineNumbers(last int) {
+	widen(int64(len(strconv.Itoa(last + numberStart - 1))))
+}
+
+// widen make the line number column at least width wide, getting its width
+func widen(width int64) int64 {
+	for {
+		current := atomic.LoadInt64(&numberWidth)
+		if width <= current || atomic.CompareAndSwapInt64(&numberWidth, current, width) {
+			return atomic.LoadInt64(&numberWidth)
+		}
+	}
+}
+
+// LineNumber get the line number printed before the line numbered number
+// counting from 1, along with the separator after it
+func LineNumber(number int) string {
+	return string(appendLineNumber(nil, number))
+}
+
+// appendLineNumber append the line number printed before the line numbered
+// number counting from 1, padded to the width of the column and followed by
+// the separator
+func appendLineNumber(buf []byte, number int) []byte {
+	start := len(buf)
+	buf = strconv.AppendInt(buf, int64(number+numberStart-1), 10)
+	width := widen(int64(len(buf) - start))
+	for int64(len(buf)-start) < width {
+		buf = append(buf, ' ')
+	}
+
+	return append(buf, numberSeparator...)
+}
@@ -0,0 +1,51 @@
+package output
+
+import "sync/atomic"
+
+/*
+	Buffers that grow while following, such as lines waiting to be joined into
+	a record and the matches counted for --summary-every, take the bytes they
+	hold from a budget shared by all sources. When --max-memory is set and the
+	budget is used up the oldest data is shed instead of the buffer growing, and
+	the bytes shed are counted for the source.
+*/
+
+// memoryBudget bytes held in growing buffers and the most they can hold
+type memoryBudget struct {
+	limit int64 // 0 for no limit
+	used  int64
+}
+
+// budget the budget shared by buffers for this run
+var budget memoryBudget
+
+// SetMaxMemory set the most bytes that growing buffers can hold, or 0 for no
+// limit. It must be called before any lines are processed.
+func SetMaxMemory(limit int64) {
+	budget = memoryBudget{limit: limit}
+}
+
+// take take n bytes from the budget, returning false if that would go over
+// the limit
+func (b *memoryBudget) take(n int) bool {
+	for {
+		used := atomic.LoadInt64(&b.used)
+		if b.limit > 0 && used+int64(n) > b.limit {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&b.used, used, used+int64(n)) {
+			return true
+		}
+	}
+}
+
+// force take n bytes from the budget even if that goes over the limit, for
+// data that can't be shed such as a single line
+func (b *memoryBudget) force(n int) {
+	atomic.AddInt64(&b.used, int64(n))
+}
+
+// give return n bytes to the budget
+func (b *memoryBudget) give(n int) {
+	atomic.AddInt64(&b.used, -int64(n))
+}
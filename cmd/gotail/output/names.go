@@ -0,0 +1,109 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/imarsman/gotail/internal/config"
+)
+
+// alias a name given with --alias for paths matching pattern
+type alias struct {
+	pattern string
+	name    string
+}
+
+var aliases []alias
+
+// shortenPath used to shorten paths without an alias or label
+var shortenPath = func(path string) string {
+	return path
+}
+
+// SetAliases set names to show in headers from PATH=NAME specs. The path may
+// be a glob pattern. Relative paths are made absolute to match followed files.
+func SetAliases(specs []string) error {
+	aliases = aliases[:0]
+	for _, spec := range specs {
+		i := strings.LastIndex(spec, "=")
+		if i < 1 || i == len(spec)-1 {
+			return fmt.Errorf("invalid alias %q, expected PATH=NAME", spec)
+		}
+		pattern := spec[:i]
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid alias %q: %v", spec, err)
+		}
+		if abs, err := filepath.Abs(pattern); err == nil {
+			pattern = abs
+		}
+		aliases = append(aliases, alias{pattern: pattern, name: spec[i+1:]})
+	}
+
+	return nil
+}
+
+// SetShortNames set how paths without an alias or label are shortened. The
+// mode is "none", "base" for the base name, or "prefix" to trim the directory
+// shared by paths.
+func SetShortNames(mode string, paths []string) error {
+	switch mode {
+	case "", "none":
+		shortenPath = func(path string) string {
+			return path
+		}
+	case "base":
+		shortenPath = filepath.Base
+	case "prefix":
+		dir := commonDir(paths)
+		shortenPath = func(path string) string {
+			if dir == "" {
+				return path
+			}
+			return strings.TrimPrefix(path, dir)
+		}
+	default:
+		return fmt.Errorf("invalid --short-names %q, expected none, base, or prefix", mode)
+	}
+
+	return nil
+}
+
+// commonDir get the directory, ending in a separator, that all paths are in
+func commonDir(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	dir := filepath.Dir(paths[0]) + string(os.PathSeparator)
+	for _, path := range paths[1:] {
+		for !strings.HasPrefix(path, dir) {
+			parent := filepath.Dir(strings.TrimSuffix(dir, string(os.PathSeparator)))
+			if parent+string(os.PathSeparator) == dir || parent == "." {
+				return ""
+			}
+			dir = strings.TrimSuffix(parent, string(os.PathSeparator)) + string(os.PathSeparator)
+		}
+	}
+
+	return dir
+}
+
+// SourceName get the name to show for path in headers. An alias given with
+// --alias is used first, then a label from the config file, and otherwise the
+// path shortened as set with --short-names. Standard input is given as -.
+func SourceName(path string) string {
+	for _, a := range aliases {
+		if ok, _ := filepath.Match(a.pattern, path); ok {
+			return a.name
+		}
+	}
+	if label := config.ForPath(path).Label; label != "" {
+		return label
+	}
+	if path == "-" {
+		return "standard input"
+	}
+
+	return shortenPath(path)
+}
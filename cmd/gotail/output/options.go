@@ -0,0 +1,51 @@
+package output
+
+import (
+	"time"
+
+	"github.com/nxadm/tail/watch"
+)
+
+// Options settings for how lines are processed and printed. The command sets
+// them from its arguments; the zero value prints lines as they are.
+type Options struct {
+	FormatHint    string        // json, logfmt, access, or plain to skip format detection
+	ExplodeArray  bool          // run each element of a line holding a JSON array as a line
+	JSON          bool          // format and colourize JSON in lines
+	JSONOnly      bool          // print only lines with JSON, and only the JSON
+	KeepKeyOrder  bool          // with JSON, indent JSON keeping its keys in the order given
+	ValidateJSON  bool          // print only lines without valid JSON, as where they are and why
+	SchemaInvalid bool          // with a schema set, keep only lines that don't conform
+	CheckOrder    bool          // flag lines whose timestamps are out of order
+	ClockJump     time.Duration // with CheckOrder, the largest forward jump not flagged
+	Since         time.Time     // if set, drop lines with an earlier timestamp
+	Until         time.Time     // if set, drop lines with a later timestamp
+	HashFields    []string      // JSON or logfmt fields whose values are hashed
+	HashKey       string        // key for hashes of HashFields
+	CopyMatch     bool          // keep the last line printed for LastMatch
+	Truncate      int           // if set, cut lines longer than this many characters
+	Wrap          int           // if set, break lines longer than this many characters
+	HostColumn    bool          // prefix lines with their host
+	PrefixName    bool          // prefix lines with the name of their source in place of headers
+	Poll          bool          // poll followed files for changes rather than be notified
+	RateCapacity  uint16        // lines a followed file can send in a burst, 1000 if not set
+	RateInterval  time.Duration // time for each line once the burst is used, 1ms if not set
+	Output        string        // OutputText or OutputNDJSON
+	Canonical     bool          // with OutputText, print lines so that runs can be compared
+	FallbackTime  string        // with OutputNDJSON, time for lines without one: FallbackReceived or FallbackMtime
+}
+
+// options the options for this run
+var options Options
+
+// SetPollInterval set how often polled files are checked for changes. It must
+// be called before any files are followed.
+func SetPollInterval(interval time.Duration) {
+	watch.POLL_DURATION = interval
+}
+
+// SetOptions set the options for this run. It must be called before any lines
+// are processed.
+func SetOptions(opts Options) {
+	options = opts
+}
@@ -0,0 +1,40 @@
+package output
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// OrderStage flag lines whose timestamp is earlier than that of the line
+// before from the same source, or later by more than jump. Either is often a
+// sign of clock skew or buffered writers. Lines without a timestamp are left
+// alone.
+func OrderStage(jump time.Duration) Stage {
+	var mutex sync.Mutex
+	last := map[string]time.Time{}
+
+	return func(line *Line) bool {
+		t, ok := line.timestamp()
+		if !ok {
+			return true
+		}
+
+		mutex.Lock()
+		previous, seen := last[line.Path]
+		last[line.Path] = t
+		mutex.Unlock()
+		if !seen {
+			return true
+		}
+
+		switch gap := t.Sub(previous); {
+		case gap < 0:
+			line.Flag(fmt.Sprintf("out of order by %s", -gap))
+		case jump > 0 && gap > jump:
+			line.Flag(fmt.Sprintf("clock jump of %s", gap))
+		}
+
+		return true
+	}
+}
@@ -4,17 +4,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/TylerBrock/colorjson"
-	"github.com/fatih/color"
-	"github.com/imarsman/gotail/cmd/gotail/util"
-	"github.com/imarsman/gotail/cmd/internal/args"
-	"github.com/jwalton/gchalk"
+	"github.com/imarsman/gotail/cmd/gotail/metrics"
+	"github.com/imarsman/gotail/internal/config"
+	"github.com/imarsman/gotail/internal/input"
 	"github.com/nxadm/tail"
 
 	"github.com/nxadm/tail/ratelimiter"
@@ -28,161 +28,127 @@ func init() {
 	outputPrinter = newLinePrinter()
 }
 
-var reJSON = `(?P<PREFIX>[^\{]*)(?P<JSON>[\{].*$)`
-var compRegEx = regexp.MustCompile(reJSON)
+var lastMatch atomic.Value // most recent matching line, kept for --copy-match
+
+// LastMatch get the most recent line to match, or an empty string if none have
+func LastMatch() string {
+	line, _ := lastMatch.Load().(string)
+	return line
+}
 
 type jsonLine struct {
 	prefix string
 	json   string
 }
 
-// colourize print output with colour highlighting if the -c/--colour flag is used
-// Currently messes up piping
-func colourize(output string) (colourOutput string) {
-	var obj interface{}
-	json.Unmarshal([]byte(output), &obj)
-	// obj = expandInterfaceToMatch(obj)
-
-	f := colorjson.NewFormatter()
-	f.Indent = 2
-	f.KeyColor = color.New(color.FgHiBlue)
-
-	s, err := f.Marshal(obj)
-	if err != nil {
-		fmt.Println(err)
+// getContent split a line into a prefix and a JSON object starting at the
+// first opening brace. A byte scan is used as it is much cheaper than a regular
+// expression and this is called for every line.
+func getContent(input string) (ok bool, jl jsonLine) {
+	i := strings.IndexByte(input, '{')
+	if i == -1 {
 		return
 	}
-
-	return string(s)
-}
-
-func getParamMap(re *regexp.Regexp, input string) (ok bool, paramsMap map[string]string) {
-	matches := re.FindStringSubmatch(input)
-
-	paramsMap = make(map[string]string)
-	for i, name := range re.SubexpNames() {
-		if i > 0 && i <= len(matches) {
-			paramsMap[name] = matches[i]
-		}
+	if !json.Valid([]byte(input[i:])) {
+		return
 	}
 	ok = true
+	jl.prefix = strings.TrimSpace(input[:i])
+	jl.json = input[i:]
+
 	return
 }
 
-func getContent(input string) (ok bool, jl jsonLine) {
-	gotParams, matches := getParamMap(compRegEx, input)
-	if !gotParams {
-		return
+// levelColour get the colour to use for a log level
+func levelColour(level string) int {
+	switch strings.ToLower(level) {
+	case "fatal", "panic", "critical", "crit", "error", "err":
+		return BrightRed
+	case "warn", "warning":
+		return BrightYellow
+	case "info", "notice":
+		return BrightGreen
+	case "debug", "trace":
+		return BrightBlue
+	default:
+		return NoColour
 	}
+}
 
-	if len(matches) == 0 {
+// getLevel get the value of the level field from a JSON object
+func getLevel(source *config.Source, input string) (level string) {
+	if source.LevelField == "" {
 		return
 	}
-	isJSON := json.Valid([]byte(matches[`JSON`]))
-	if !isJSON {
+	var obj map[string]interface{}
+	if json.Unmarshal([]byte(input), &obj) != nil {
 		return
 	}
-	ok = true
-	jl.prefix = strings.TrimSpace(matches[`PREFIX`])
-	jl.json = matches[`JSON`]
+	if v, ok := obj[source.LevelField]; ok {
+		level = fmt.Sprint(v)
+	}
 
 	return
 }
 
-// expandInterfaceToMatch take interface and expand to match JSON or YAML interface structures
-func expandInterfaceToMatch(i interface{}) interface{} {
-	switch x := i.(type) {
-	case map[interface{}]interface{}:
-		m2 := map[string]interface{}{}
-		for k, v := range x {
-			m2[k.(string)] = expandInterfaceToMatch(v)
-		}
-		return m2
-	case []interface{}:
-		for i, v := range x {
-			x[i] = expandInterfaceToMatch(v)
+// GetOutput get output from a log line by running it through the pipeline for
+// this run. The path is the file or other source the line came from, source
+// holds config file settings for it, and format is the format detected for it.
+// An error is returned if the line is not to be printed.
+func GetOutput(path string, source *config.Source, format Format, input string) (output string, err error) {
+	pipelineOnce.Do(func() {
+		if pipeline == nil {
+			pipeline = NewPipeline(options)
 		}
-	}
-	return i
-}
+	})
 
-// IndentJSON read json in then write it out indented
-func IndentJSON(input string) (result string, err error) {
-	var obj interface{}
-	err = json.Unmarshal([]byte(input), &obj)
-	if err != nil {
-		fmt.Println(gchalk.Red(err.Error()))
-		os.Exit(1)
+	// Each element of an array of events is a line of its own
+	if options.ExplodeArray {
+		if elements, ok := explodeArray(input); ok {
+			return explodeOutput(path, source, format, elements)
+		}
 	}
-	obj = expandInterfaceToMatch(obj)
 
-	bytes, err := json.MarshalIndent(&obj, "", "  ")
-	if err != nil {
-		return
+	output, ok := pipeline.Run(path, source, format, input)
+	if !ok {
+		err = errors.New("line filtered out")
 	}
-	result = strings.TrimSpace(string(bytes))
 
 	return
 }
 
-// GetOutput get output from a log line consisting of the timestamp prefix and potentially JSON payload
-func GetOutput(input string) (output string, err error) {
-	if !util.CheckMatch(input) {
-		err = errors.New("no match found")
-
-		return
-	}
-	ok, jl := getContent(input)
-	if ok {
-		var json string
-		var err error
-		if args.Args.JSON && !args.Args.NoColour {
-			json, err = IndentJSON(jl.json)
-			if err != nil {
-
-			}
-		} else {
-			json = jl.json
-		}
-
-		if args.Args.NoColour {
-			if args.Args.JSON {
-				json, err = IndentJSON(json)
-				if err != nil {
-
-				}
-				output = fmt.Sprintf("%s, %s", jl.prefix, json)
-			} else {
-				output = fmt.Sprintf("%s, %s", jl.prefix, json)
-			}
-		} else {
-			if args.Args.JSON {
-				output = fmt.Sprintf("%s %s", jl.prefix, colourize(fmt.Sprintf("%s", json)))
-			} else {
-				output = fmt.Sprintf("%s, %s", jl.prefix, json)
-			}
-		}
-	} else {
-		if args.Args.JSONOnly {
-			err = errors.New("line is not JSON and JSON only flag used")
-			return
+// WriteLines write the lines read from path to w as they are printed for a
+// tail, detecting their format from the lines themselves
+func WriteLines(w io.Writer, path string, lines []string) {
+	source := config.ForPath(path)
+	format := FormatFor(lines)
+	for _, line := range lines {
+		text, err := GetOutput(path, source, format, line)
+		if err != nil {
+			continue
 		}
-		output = fmt.Sprintf("%s", input)
+		fmt.Fprintln(w, text)
 	}
-
-	return
 }
 
 // a message to be sent when following a file
 type msg struct {
-	path string
-	line string
+	path   string
+	line   string
+	number int    // line number to print before the line, or 0 for none
+	anchor string // PATH:OFFSET of where the line starts in its file, if known
+	raw    bool   // print as a block of its own, such as a summary
 }
 
 // linePrinter a printer is a central place for printing new lines.
 type linePrinter struct {
 	currentPath string
 	messages    chan (msg)
+	pause       chan bool     // sent true to pause printing and false to resume it
+	expire      chan struct{} // sent to note repeats that have waited long enough
+	done        chan struct{} // closed when all messages have been printed
+	sticky      *stickyHeader // set when the current source is kept in a header
+	squash      *squasher     // set when repeated lines are counted
 }
 
 // NewLinePrinter get new printer instance properly instantiated
@@ -200,28 +166,123 @@ func newLinePrinter() *linePrinter {
 	// initialize to empty string
 	outputPrinter.setPath("")
 	outputPrinter.messages = make(chan (msg))
+	outputPrinter.pause = make(chan bool)
+	outputPrinter.expire = make(chan struct{})
+	outputPrinter.done = make(chan struct{})
 
 	// Print messages in goroutine to avoid exposing messages channel which has
 	// its own locking behaviour. Use of a channel avoids worries about race
 	// condition with incoming path compared to printer path. Previous code
 	// tried atomic values for path and a mutex instead of a channel.
 	go func() {
-		for m := range outputPrinter.messages {
-			if outputPrinter.getPath() == m.path {
-				fmt.Println(m.line)
-				continue
+		defer close(outputPrinter.done)
+
+		// Only this goroutine prints so one buffer can be reused for every
+		// line, avoiding allocation by fmt.
+		var buf []byte
+		note := func(notes []msg) {
+			for _, n := range notes {
+				// Keep stdout to JSON objects when lines are written as them
+				if Records() {
+					os.Stderr.WriteString(n.line + "\n")
+					continue
+				}
+				buf = outputPrinter.write(buf[:0], n)
+			}
+		}
+		write := func(m msg) {
+			if squash := outputPrinter.squash; squash != nil && !m.raw {
+				repeated, notes := squash.add(m, time.Now())
+				if repeated {
+					return
+				}
+				note(notes)
+			}
+			buf = outputPrinter.write(buf[:0], m)
+		}
+		var pause pauser
+		for {
+			select {
+			case m, ok := <-outputPrinter.messages:
+				if !ok {
+					pause.release(write)
+					if outputPrinter.squash != nil {
+						note(outputPrinter.squash.expired(time.Now(), true))
+					}
+					return
+				}
+				if pause.paused {
+					pause.hold(m)
+					continue
+				}
+				write(m)
+			case pause.paused = <-outputPrinter.pause:
+				if !pause.paused {
+					pause.release(write)
+				}
+			case <-outputPrinter.expire:
+				if !pause.paused {
+					note(outputPrinter.squash.expired(time.Now(), false))
+				}
 			}
-			// Print out a header and set new value for the path.
-			outputPrinter.setPath(m.path)
-			fmt.Println()
-			fmt.Println(Colour(BrightBlue, fmt.Sprintf("==> %s <==", m.path)))
-			fmt.Println(m.line)
 		}
 	}()
 
 	return outputPrinter
 }
 
+// write print m, using buf to build what is printed, and return buf for
+// reuse
+func (p *linePrinter) write(buf []byte, m msg) []byte {
+	if m.raw {
+		// Print a header again before the next followed line
+		p.setPath("")
+		buf = append(buf, '\n')
+		buf = append(buf, m.line...)
+		os.Stdout.Write(buf)
+		return buf
+	}
+	if p.getPath() != m.path && followHeaders && !Records() {
+		// Print out a header and set new value for the path.
+		p.setPath(m.path)
+		buf = append(buf, '\n')
+		name := SourceName(m.path)
+		buf = append(buf, Colour(HeaderColour(m.path), "==> "+name+" <==")...)
+		buf = append(buf, '\n')
+		if p.sticky != nil {
+			buf = append(buf, p.sticky.draw(name)...)
+		}
+	}
+	if fileBar && useColour {
+		buf = append(buf, Colour(HeaderColour(m.path), fileBarText)...)
+	}
+	if m.number > 0 {
+		buf = appendLineNumber(buf, m.number)
+	}
+	buf = append(buf, m.line...)
+	buf = append(buf, '\n')
+	os.Stdout.Write(buf)
+	if ring != nil {
+		ring.add(m)
+	}
+	if stream != nil {
+		stream.publish(m)
+	}
+
+	return buf
+}
+
+var followHeaders = true // whether headers are printed between followed lines
+
+// SetFollowHeaders set whether a header is printed before followed lines from
+// a different source than the line before, and the source of the last line
+// printed before following began. It must be called before any followed lines
+// are printed.
+func SetFollowHeaders(show bool, lastPath string) {
+	followHeaders = show
+	outputPrinter.setPath(lastPath)
+}
+
 func (p *linePrinter) setPath(path string) {
 	p.currentPath = path
 }
@@ -238,22 +299,117 @@ func (p *linePrinter) print(path, line string) {
 	p.messages <- m
 }
 
+// printNumbered print a line from a followed file with its line number and
+// anchor
+func (p *linePrinter) printNumbered(path, line string, number int, anchor string) {
+	p.messages <- msg{path: path, line: line, number: number, anchor: anchor}
+}
+
+// printBlock print text between followed lines. When lines are written as
+// JSON objects the text goes to stderr so that stdout holds only objects.
+func (p *linePrinter) printBlock(text string) {
+	if Records() {
+		os.Stderr.WriteString(text)
+		return
+	}
+	p.messages <- msg{line: text, raw: true}
+}
+
+// close stop accepting messages and wait for those already sent to be printed
+func (p *linePrinter) close() {
+	close(p.messages)
+	<-p.done
+	if p.sticky != nil {
+		os.Stdout.WriteString(p.sticky.reset())
+	}
+}
+
+// Close wait for followed file lines already received to be printed. Followed
+// files must be stopped first as no lines can be printed afterward.
+func Close() {
+	stopSummaries()
+	stopHeartbeats()
+	outputPrinter.close()
+	stopForward()
+	stopStream()
+}
+
 // FollowedFile a file being tailed (followed).
 // Uses the tail library which has undoubtedly taken many hours to get working
 // well.
 type FollowedFile struct {
-	Path string
-	Tail *tail.Tail
-	ch   chan struct{}
+	Path       string
+	Tail       *tail.Tail // nil while waiting to restart after the tail failed
+	Source     *config.Source
+	Format     Format // set before unlocking to highlight new lines
+	Metrics    *metrics.Source
+	LineNumber int // set before unlocking to number new lines from this line number
+	byName     bool
+	decoder    *config.Decoder
+	ch         chan struct{}
+	unlockOnce sync.Once
+	done       chan struct{} // closed when all lines have been sent for printing
+	mutex      sync.Mutex    // held to replace Tail or stop following
+	stopped    bool          // set by Stop and StopAtEOF
+	stop       chan struct{} // closed by Stop and StopAtEOF
 }
 
-// Unlock channel for file by writing to channel
+// Unlock channel for file by closing it
 func (ff *FollowedFile) Unlock() {
-	ff.ch <- *new(struct{})
+	ff.unlockOnce.Do(func() {
+		close(ff.ch)
+	})
 }
 
-// NewFollowedFileForPath create a new file that will start tailing
-func NewFollowedFileForPath(path string) (ff *FollowedFile, err error) {
+// Done closed when the file is no longer followed and its lines have been
+// sent for printing
+func (ff *FollowedFile) Done() <-chan struct{} {
+	return ff.done
+}
+
+// StopAtEOF stop following the file once its end is reached and wait for its
+// lines to be sent for printing
+func (ff *FollowedFile) StopAtEOF() {
+	if tf := ff.stopping(); tf != nil {
+		tf.StopAtEOF()
+		tf.Cleanup()
+	}
+	ff.Unlock()
+	<-ff.done
+}
+
+// Stop stop following the file, remove its watches, and wait for lines already
+// read to be sent for printing.
+func (ff *FollowedFile) Stop() (err error) {
+	if tf := ff.stopping(); tf != nil {
+		err = tf.Stop()
+		tf.Cleanup()
+	}
+	// Release the file if it is still waiting for initial output
+	ff.Unlock()
+	<-ff.done
+
+	return
+}
+
+// stopping mark the file as stopped so that its tail isn't restarted, getting
+// the tail to stop if there is one
+func (ff *FollowedFile) stopping() *tail.Tail {
+	ff.mutex.Lock()
+	defer ff.mutex.Unlock()
+
+	if !ff.stopped {
+		ff.stopped = true
+		close(ff.stop)
+	}
+
+	return ff.Tail
+}
+
+// NewFollowedFileForPath create a new file that will start tailing. If byName
+// is true the file at path is reopened when it is rotated, otherwise the open
+// file is followed until it is renamed or removed.
+func NewFollowedFileForPath(path string, byName bool) (ff *FollowedFile, err error) {
 	fi, err := os.Stat(path)
 	if err != nil {
 		return nil, err
@@ -261,20 +417,7 @@ func NewFollowedFileForPath(path string) (ff *FollowedFile, err error) {
 
 	// get the length of the file im bytes for SeekInfo.
 	size := fi.Size()
-	// Set seek location in bytes, with reference to start of file.
-	si := tail.SeekInfo{Offset: size, Whence: 0}
-
-	// Use leaky bucket algorithm to rate limit output. Implemented by tail
-	// package. The size is the bucket capacity before rate limiting begins.
-	// After that, the leak interval kicks in. If the size is too small a spurt
-	// of new lines will cause the tail package to cease tailing for a period of
-	// time. Initially the size was set to 10 and that was insufficient.
-	lb := ratelimiter.NewLeakyBucket(1000, 1*time.Millisecond)
-
-	// Set up a new tailfile with no logging
-	tf, err := tail.TailFile(path, tail.Config{
-		Follow: true, RateLimiter: lb, ReOpen: true, Location: &si, Logger: tail.DiscardingLogger},
-	)
+	tf, err := tailFile(path, size, byName)
 	if err != nil {
 		return
 	}
@@ -282,24 +425,280 @@ func NewFollowedFileForPath(path string) (ff *FollowedFile, err error) {
 	ff = &FollowedFile{}
 	ff.Tail = tf
 	ff.Path = path
+	ff.byName = byName
+	ff.Source = config.ForPath(path)
+	ff.decoder = ff.Source.NewDecoder()
+	ff.Metrics = metrics.For(path)
+	ff.Metrics.SetOffset(size)
 
 	// make channel to use to wait for initial lines to be tailed
 	ff.ch = make(chan struct{})
+	ff.done = make(chan struct{})
+	ff.stop = make(chan struct{})
 
 	// Using anonymous function to avoid having this called separately
 	go func() {
+		defer close(ff.done)
 		// Wait for initial output to be done in main.
 		<-ff.ch
 
-		// Range over lines that come in, actually a channel of line structs
-		for line := range ff.Tail.Lines {
-			output, err := GetOutput(line.Text)
+		ff.Metrics.SetUp(true)
+		defer ff.Metrics.SetUp(false)
+
+		supervise(ff.Path, ff.Metrics, ff.stop, ff.follow)
+	}()
+
+	return
+}
+
+// tailFile start tailing the file at path from offset
+func tailFile(path string, offset int64, byName bool) (*tail.Tail, error) {
+	// Set seek location in bytes, with reference to start of file.
+	si := tail.SeekInfo{Offset: offset, Whence: 0}
+
+	// Use leaky bucket algorithm to rate limit output. Implemented by tail
+	// package. The size is the bucket capacity before rate limiting begins.
+	// After that, the leak interval kicks in. If the size is too small a spurt
+	// of new lines will cause the tail package to cease tailing for a period of
+	// time. Initially the size was set to 10 and that was insufficient.
+	capacity, interval := options.RateCapacity, options.RateInterval
+	if capacity == 0 {
+		capacity = 1000
+	}
+	if interval == 0 {
+		interval = time.Millisecond
+	}
+	lb := ratelimiter.NewLeakyBucket(capacity, interval)
+
+	// Set up a new tailfile with no logging
+	return tail.TailFile(path, tail.Config{
+		Follow: true, RateLimiter: lb, ReOpen: byName, Location: &si, Logger: tail.DiscardingLogger,
+		Poll: options.Poll},
+	)
+}
+
+// follow print the lines of the file until its tail ends, getting the error
+// it ended with unless it was stopped. A tail that ended with an error is
+// started again from the offset read up to, or from the start of the file if
+// it is now shorter. One that ended because the file can no longer be opened
+// is started again once it can be, without counting as an error.
+func (ff *FollowedFile) follow() error {
+	for {
+		ff.mutex.Lock()
+		restart := ff.Tail == nil
+		ff.mutex.Unlock()
+		if restart && !waitForAccess(ff.Path, ff.Metrics, ff.stop) {
+			return nil
+		}
+
+		ff.mutex.Lock()
+		if ff.stopped {
+			ff.mutex.Unlock()
+			return nil
+		}
+		if ff.Tail == nil {
+			var offset int64
+			fi, err := os.Stat(ff.Path)
 			if err != nil {
-				continue
+				ff.mutex.Unlock()
+				return err
+			}
+			if read, _ := ff.Metrics.Offset(); read <= fi.Size() {
+				offset = read
+			}
+			if ff.Tail, err = tailFile(ff.Path, offset, ff.byName); err != nil {
+				ff.mutex.Unlock()
+				return err
+			}
+		}
+		tf := ff.Tail
+		ff.mutex.Unlock()
+
+		switch {
+		case ff.Source.IsMultiline():
+			ff.followRecords(tf.Lines)
+		case ff.Source.IsUTF16():
+			ff.followUTF16(tf.Lines)
+		default:
+			// Range over lines that come in, actually a channel of line structs
+			for line := range tf.Lines {
+				ff.Metrics.SetOffset(line.SeekInfo.Offset)
+				for _, text := range ff.decoder.Lines(line.Text) {
+					ff.printRecord(input.CutLine(ff.Path, text), lineStart(line))
+				}
+			}
+		}
+
+		err := tf.Wait()
+		ff.mutex.Lock()
+		if ff.stopped || err == nil {
+			ff.mutex.Unlock()
+			return nil
+		}
+		// The tail's watch was removed as it ended, and removing it again with
+		// Cleanup would leave the next tail of the file without one
+		ff.Tail = nil
+		ff.mutex.Unlock()
+
+		// The tail package doesn't keep the error it couldn't open the file
+		// with, so the file is checked again
+		if !denied(ff.Path) {
+			return err
+		}
+	}
+}
+
+// multilineFlushInterval how long to wait for continuation lines before
+// printing the last record received
+const multilineFlushInterval = 500 * time.Millisecond
+
+// decoderFlushInterval how long to wait for more lines before printing a
+// UTF-16 line held back by the decoder
+const decoderFlushInterval = 100 * time.Millisecond
+
+// followUTF16 print the lines of a UTF-16 file. The decoder holds back the
+// last line received until the next one comes, so it is flushed when no new
+// lines have arrived for a short time.
+func (ff *FollowedFile) followUTF16(tailLines <-chan *tail.Line) {
+	// The lines of a UTF-16 file aren't where the newline bytes the tail
+	// package splits on are, so they have no anchors
+	print := func(lines []string) {
+		for _, text := range lines {
+			ff.printRecord(input.CutLine(ff.Path, text), -1)
+		}
+	}
+
+	timer := time.NewTimer(decoderFlushInterval)
+	for {
+		select {
+		case line, ok := <-tailLines:
+			if !ok {
+				print(ff.decoder.Flush())
+				return
+			}
+			ff.Metrics.SetOffset(line.SeekInfo.Offset)
+			print(ff.decoder.Lines(line.Text))
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
 			}
-			outputPrinter.print(ff.Path, output)
+			timer.Reset(decoderFlushInterval)
+		case <-timer.C:
+			print(ff.decoder.Flush())
+			timer.Reset(decoderFlushInterval)
 		}
+	}
+}
+
+// lineStart get the offset in its file a line from the tail package starts at.
+// The tail package gives the offset after the line, which it takes only the
+// newline from.
+func lineStart(line *tail.Line) int64 {
+	start := line.SeekInfo.Offset - int64(len(line.Text)) - 1
+	if start < 0 {
+		return 0
+	}
+
+	return start
+}
+
+// printRecord print a line or joined record for the followed file, which
+// starts at offset start in the file, or -1 if that isn't known. When lines
+// are numbered each line read is counted, including those not printed.
+func (ff *FollowedFile) printRecord(record string, start int64) {
+	number := ff.LineNumber
+	if number > 0 {
+		ff.LineNumber += strings.Count(record, "\n") + 1
+	}
+	output, err := GetOutput(ff.Path, ff.Source, ff.Format, record)
+	ff.Metrics.Line(len(record), err == nil)
+	if err != nil {
+		return
+	}
+	var anchor string
+	if start >= 0 {
+		anchor = ff.Path + ":" + strconv.FormatInt(start, 10)
+	}
+	outputPrinter.printNumbered(ff.Path, output, number, anchor)
+}
+
+// followRecords join continuation lines onto their record before printing. A
+// record is printed when the next one starts or when no new lines have arrived
+// for a short time. If the record would take more memory than is left its
+// oldest lines are shed.
+func (ff *FollowedFile) followRecords(tailLines <-chan *tail.Line) {
+	var lines []string
+	var size int    // bytes in lines taken from the memory budget
+	var start int64 // where the first line of the record starts in the file
+	// A record not printed because of a panic gives back its memory
+	defer func() {
+		budget.give(size)
 	}()
+	flush := func() {
+		if len(lines) > 0 {
+			ff.printRecord(strings.Join(lines, "\n"), start)
+			lines = lines[:0]
+			budget.give(size)
+			size = 0
+		}
+	}
+	add := func(text string) {
+		for !budget.take(len(text)) {
+			if len(lines) == 0 {
+				budget.force(len(text))
+				break
+			}
+			budget.give(len(lines[0]))
+			size -= len(lines[0])
+			ff.Metrics.Shed(len(lines[0]))
+			lines = lines[1:]
+		}
+		size += len(text)
+		lines = append(lines, text)
+	}
 
-	return
+	// Join a decoded line onto the record it belongs to. Like those of
+	// followUTF16, records from UTF-16 files have no anchors.
+	join := func(decoded []string, lineStart int64) {
+		for _, text := range decoded {
+			text = input.CutLine(ff.Path, text)
+			if ff.Source.StartsRecord(text) {
+				flush()
+			}
+			if len(lines) == 0 {
+				start = lineStart
+				if ff.Source.IsUTF16() {
+					start = -1
+				}
+			}
+			add(text)
+		}
+	}
+
+	timer := time.NewTimer(multilineFlushInterval)
+	for {
+		select {
+		case line, ok := <-tailLines:
+			if !ok {
+				join(ff.decoder.Flush(), -1)
+				flush()
+				return
+			}
+			ff.Metrics.SetOffset(line.SeekInfo.Offset)
+			join(ff.decoder.Lines(line.Text), lineStart(line))
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(multilineFlushInterval)
+		case <-timer.C:
+			join(ff.decoder.Flush(), -1)
+			flush()
+			timer.Reset(multilineFlushInterval)
+		}
+	}
 }
@@ -1,12 +1,29 @@
 package output
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/imarsman/gotail/cmd/gotail/metrics"
+	"github.com/imarsman/gotail/cmd/gotail/schema"
+	"github.com/imarsman/gotail/internal/config"
+	"github.com/jwalton/gchalk"
 	"github.com/matryer/is"
+	"github.com/nxadm/tail"
 )
 
 //                Tests and benchmarks
@@ -111,3 +128,1199 @@ func BenchmarkPrintLinesWithNoPathChange(b *testing.B) {
 	// Re-enable stdout
 	os.Stdout = origOut
 }
+
+func TestDetectFormat(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(DetectFormat([]string{`{"level":"info","msg":"started"}`, `{"level":"warn","msg":"slow"}`}), FormatJSON)
+	is.Equal(DetectFormat([]string{`level=info msg="started server" port=8080`, `level=warn msg=slow`}), FormatLogfmt)
+	is.Equal(DetectFormat([]string{`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`}), FormatAccess)
+	is.Equal(DetectFormat([]string{`Nov 19 21:19:20 c1 nomad[18222]: request complete`, ``}), FormatPlain)
+	is.Equal(DetectFormat([]string{}), FormatPlain)
+}
+
+func TestDatagramLines(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(datagramLines(&config.Source{}, []byte("one\ntwo\n")), []string{"one", "two"})
+	is.Equal(datagramLines(&config.Source{}, []byte("one\r\ntwo")), []string{"one", "two"})
+	is.Equal(datagramLines(&config.Source{}, []byte("single")), []string{"single"})
+}
+
+func TestStickyHeader(t *testing.T) {
+	is := is.New(t)
+
+	// An fd that is not a terminal keeps the size already known
+	h := &stickyHeader{top: true, fd: -1, rows: 24, cols: 20}
+	is.Equal(string(h.draw("/var/log/a-long-path.log")), "\x1b7\x1b[1;1H\x1b[2K\x1b[7m ==> /var/log/a-long\x1b[0m\x1b8")
+	is.Equal(h.region(), "\x1b[2;24r\x1b[24;1H")
+
+	h.top = false
+	is.Equal(h.region(), "\x1b[1;23r\x1b[23;1H")
+	is.Equal(h.reset(), "\x1b7\x1b[24;1H\x1b[2K\x1b8\x1b[r\x1b[24;1H")
+
+	is.True(SetStickyHeader("middle") != nil)
+}
+
+func TestSourceName(t *testing.T) {
+	is := is.New(t)
+
+	current := config.Current
+	defer func() { config.Current = current }()
+	config.Current = &config.Config{Sources: []*config.Source{{Path: "api.log", Colour: "cyan", Label: "API"}}}
+
+	is.Equal(SourceName("/var/log/api.log"), "API")
+	is.Equal(HeaderColour("/var/log/api.log"), BrightCyan)
+	is.Equal(SourceName("/var/log/db.log"), "/var/log/db.log")
+	is.Equal(HeaderColour("/var/log/db.log"), BrightBlue)
+	is.Equal(SourceName("-"), "standard input")
+}
+
+func TestFollowedReaderStop(t *testing.T) {
+	is := is.New(t)
+
+	// Nothing is written so reading blocks until the reader is stopped
+	r, w := io.Pipe()
+	defer w.Close()
+	fc := NewFollowedReader("-", r)
+
+	stopped := make(chan struct{})
+	go func() {
+		fc.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("reader was not stopped")
+	}
+	is.NoErr(fc.Err())
+}
+
+func TestFollowedReaderFormat(t *testing.T) {
+	is := is.New(t)
+
+	fc := NewFollowedReader("-", strings.NewReader("a=1 b=2\nc=3 d=4\n"))
+	<-fc.Done()
+	is.NoErr(fc.Err())
+	is.Equal(fc.Format, FormatLogfmt)
+}
+
+func TestAliases(t *testing.T) {
+	is := is.New(t)
+
+	defer SetAliases(nil)
+	defer SetShortNames("none", nil)
+
+	is.NoErr(SetAliases([]string{"/var/log/myapp/very/long/path.log=app", "/var/log/db/*.log=db"}))
+	is.Equal(SourceName("/var/log/myapp/very/long/path.log"), "app")
+	is.Equal(SourceName("/var/log/db/postgres.log"), "db")
+	is.True(SetAliases([]string{"no-name"}) != nil)
+
+	is.NoErr(SetShortNames("base", nil))
+	is.Equal(SourceName("/var/log/nginx/access.log"), "access.log")
+
+	is.NoErr(SetShortNames("prefix", []string{"/var/log/nginx/access.log", "/var/log/app/api.log"}))
+	is.Equal(SourceName("/var/log/nginx/access.log"), "nginx/access.log")
+	is.Equal(SourceName("/tmp/other.log"), "/tmp/other.log")
+	is.True(SetShortNames("tiny", nil) != nil)
+}
+
+func TestCommonDir(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(commonDir([]string{"/var/log/a/x.log", "/var/log/a/y.log"}), "/var/log/a/")
+	is.Equal(commonDir([]string{"/var/log/a/x.log", "/var/log/b/y.log"}), "/var/log/")
+	is.Equal(commonDir([]string{"a/x.log", "b/y.log"}), "")
+	is.Equal(commonDir(nil), "")
+}
+
+func TestFieldHasher(t *testing.T) {
+	is := is.New(t)
+
+	h := newFieldHasher("secret", []string{"user", "ip"})
+	hashed := h.hash("alice")
+	is.Equal(len(hashed), hashLength)
+
+	is.Equal(h.replace(`{"user":"alice","ip":"10.0.0.1","status":200}`),
+		`{"user":"`+hashed+`","ip":"`+h.hash("10.0.0.1")+`","status":200}`)
+	is.Equal(h.replace(`level=info user=alice msg="logged in"`), `level=info user=`+hashed+` msg="logged in"`)
+	is.Equal(h.replace(`level=info user="alice"`), `level=info user=`+hashed)
+	// Field names that only end with a hashed name are left alone
+	is.Equal(h.replace(`superuser=alice`), `superuser=alice`)
+}
+
+func TestNewPipeline(t *testing.T) {
+	is := is.New(t)
+
+	source := config.ForPath("")
+	h := newFieldHasher("secret", []string{"user"})
+
+	// The zero value leaves lines as they are
+	output, ok := NewPipeline(Options{}).Run("", source, FormatPlain, "user=alice")
+	is.True(ok)
+	is.Equal(output, "user=alice")
+	// apart from giving lines with JSON as a prefix and the JSON without -j
+	output, _ = NewPipeline(Options{}).Run("", source, FormatPlain, `Nov 19 21:19:19 c1 app: {"level":"info"}`)
+	is.Equal(output, `Nov 19 21:19:19 c1 app:, {"level":"info"}`)
+
+	p := NewPipeline(Options{HashFields: []string{"user"}, HashKey: "secret"})
+	output, _ = p.Run("", source, FormatLogfmt, "user=alice")
+	is.Equal(output, "user="+h.hash("alice"))
+}
+
+// BenchmarkGetOutput benchmark getting output for a plain line and a JSON line
+func BenchmarkGetOutput(b *testing.B) {
+	source := config.ForPath("")
+	plain := `Nov 19 21:19:20 c1 nomad[18222]:     2022-11-19T21:19:20.354Z [DEBUG] http: request complete: method=GET path=/v1/allocations?`
+	jsonLine := `Nov 19 21:19:19 c1 nomad-firehose: {"Name":"997b2ae0","NodeID":"84cb91a8","TaskState":"running","TaskFailed":false}`
+
+	b.SetBytes(bechmarkBytesPerOp)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		GetOutput("", source, FormatPlain, plain)
+		GetOutput("", source, FormatPlain, jsonLine)
+	}
+}
+
+func TestGetContent(t *testing.T) {
+	is := is.New(t)
+
+	ok, jl := getContent(`Nov 19 21:19:19 c1 app: {"level":"info"}`)
+	is.True(ok)
+	is.Equal(jl.prefix, "Nov 19 21:19:19 c1 app:")
+	is.Equal(jl.json, `{"level":"info"}`)
+
+	ok, _ = getContent(`Nov 19 21:19:19 c1 app: started {pid 12}`)
+	is.True(!ok)
+	ok, _ = getContent(`no braces at all`)
+	is.True(!ok)
+}
+
+func TestPipeline(t *testing.T) {
+	is := is.New(t)
+
+	source := config.ForPath("")
+	p := Pipeline{MatchStage(regexp.MustCompile(`error`)), JSONStage(false, true, false, false)}
+
+	output, ok := p.Run("", source, FormatPlain, `app: {"msg":"error"}`)
+	is.True(ok)
+	is.Equal(output, `app:, {"msg":"error"}`)
+
+	// Not matched
+	_, ok = p.Run("", source, FormatPlain, `app: {"msg":"ok"}`)
+	is.True(!ok)
+
+	// Not JSON with JSON only
+	_, ok = p.Run("", source, FormatPlain, `app: error`)
+	is.True(!ok)
+}
+
+func TestSchemaStage(t *testing.T) {
+	is := is.New(t)
+
+	s, err := schema.Parse([]byte(`{"required": ["level"]}`))
+	is.NoErr(err)
+	source := config.ForPath("")
+
+	flag := Pipeline{SchemaStage(s, false)}
+	output, ok := flag.Run("", source, FormatPlain, `app: {"level":"info"}`)
+	is.True(ok)
+	is.Equal(output, `app: {"level":"info"}`)
+	output, ok = flag.Run("", source, FormatPlain, `app: {"msg":"x"}`)
+	is.True(ok)
+	is.Equal(output, Colour(BrightRed, "[schema /: missing required property level]")+` app: {"msg":"x"}`)
+
+	invalid := Pipeline{SchemaStage(s, true)}
+	_, ok = invalid.Run("", source, FormatPlain, `app: {"level":"info"}`)
+	is.True(!ok)
+	_, ok = invalid.Run("", source, FormatPlain, `app: not json`)
+	is.True(!ok)
+	_, ok = invalid.Run("", source, FormatPlain, `app: {"msg":"x"}`)
+	is.True(ok)
+}
+
+func TestOrderStage(t *testing.T) {
+	is := is.New(t)
+
+	source := config.ForPath("")
+	p := Pipeline{OrderStage(time.Hour)}
+
+	output, _ := p.Run("a", source, FormatPlain, `2022-11-19T21:19:20Z started`)
+	is.Equal(output, `2022-11-19T21:19:20Z started`)
+	// Another source has its own order
+	output, _ = p.Run("b", source, FormatPlain, `2022-11-19 20:00:00 other`)
+	is.Equal(output, `2022-11-19 20:00:00 other`)
+
+	output, _ = p.Run("a", source, FormatPlain, `{"ts":"2022-11-19T21:19:18Z","msg":"late"}`)
+	is.Equal(output, Colour(BrightRed, "[out of order by 2s]")+` {"ts":"2022-11-19T21:19:18Z","msg":"late"}`)
+	output, _ = p.Run("a", source, FormatPlain, `127.0.0.1 - - [19/Nov/2022:23:19:18 +0000] "GET / HTTP/1.1" 200 1`)
+	is.Equal(output, Colour(BrightRed, "[clock jump of 2h0m0s]")+` 127.0.0.1 - - [19/Nov/2022:23:19:18 +0000] "GET / HTTP/1.1" 200 1`)
+
+	// Lines without a timestamp are left alone
+	output, _ = p.Run("a", source, FormatPlain, `no time here`)
+	is.Equal(output, `no time here`)
+
+	// A configured layout is used even when the time is shorter than it
+	dated := &config.Source{TimeFormat: "January 2 2006 15:04:05"}
+	output, _ = p.Run("c", dated, FormatPlain, `May 19 2022 21:19:20 started`)
+	is.Equal(output, `May 19 2022 21:19:20 started`)
+	output, _ = p.Run("c", dated, FormatPlain, `May 19 2022 21:19:18 late`)
+	is.Equal(output, Colour(BrightRed, "[out of order by 2s]")+` May 19 2022 21:19:18 late`)
+}
+
+func TestScriptStage(t *testing.T) {
+	is := is.New(t)
+
+	path := filepath.Join(t.TempDir(), "filter.lua")
+	err := os.WriteFile(path, []byte(`
+function process(line, meta)
+  if line:find("healthcheck") then
+    return nil
+  end
+  if line:find("error") then
+    return line, "error from " .. meta.path
+  end
+  return line:gsub("password=%S+", "password=***")
+end
+`), 0644)
+	is.NoErr(err)
+
+	stage, err := ScriptStage(path)
+	is.NoErr(err)
+	p := Pipeline{stage}
+	source := config.ForPath("")
+
+	_, ok := p.Run("app.log", source, FormatPlain, "GET /healthcheck")
+	is.True(!ok)
+	output, ok := p.Run("app.log", source, FormatPlain, "login password=hunter2")
+	is.True(ok)
+	is.Equal(output, "login password=***")
+	output, _ = p.Run("app.log", source, FormatPlain, "an error")
+	is.Equal(output, Colour(BrightRed, "[error from app.log]")+" an error")
+
+	_, err = ScriptStage(filepath.Join(t.TempDir(), "missing.lua"))
+	is.True(err != nil)
+}
+
+func TestWindowSummary(t *testing.T) {
+	is := is.New(t)
+
+	w := &windowStats{errors: map[string]int{}, matches: map[string]int{}, match: regexp.MustCompile(`timeout|refused`)}
+	source := config.ForPath("")
+	p := Pipeline{w.stage}
+	for _, text := range []string{"level=error msg=timeout", "level=info msg=refused", "ERROR: timeout", "fine"} {
+		p.Run("a.log", source, FormatPlain, text)
+	}
+
+	errors, matches := w.reset()
+	is.Equal(errors, map[string]int{"a.log": 2})
+	is.Equal(matches, map[string]int{"timeout": 2, "refused": 1})
+	is.Equal(len(w.errors), 0)
+
+	summary := summarize(2*time.Second, map[string]uint64{"a.log": 4, "b.log": 0}, map[string]int64{"a.log": 0, "b.log": 3 << 20}, errors, matches)
+	is.Equal(summary, Colour(BrightBlue, "==> summary of the last 2s <==")+"\n"+
+		Colour(BrightRed, "a.log: 2.0 lines/s, 2 errors")+"\n"+
+		"b.log: 0.0 lines/s, 3.0MiB behind\n"+
+		`top matches: "timeout" 2, "refused" 1`+"\n")
+}
+
+func TestSetMatch(t *testing.T) {
+	is := is.New(t)
+	defer func() { lineMatch = nil }()
+	is.Equal(len(probeLines[1]), 4096)
+
+	// Set the limits rather than depend on the speed of the machine
+	defer func(slow, tooSlow time.Duration) { slowMatch, tooSlowMatch = slow, tooSlow }(slowMatch, tooSlowMatch)
+	slowMatch, tooSlowMatch = time.Hour, time.Hour
+	warning, err := SetMatch(`error|timeout`)
+	is.NoErr(err)
+	is.Equal(warning, "")
+	is.True(LineMatch().MatchString("a timeout"))
+
+	_, err = SetMatch(`(unclosed`)
+	is.True(err != nil)
+
+	// Make any pattern look slow
+	slowMatch = 0
+	warning, err = SetMatch(`(.*a){20}`)
+	is.NoErr(err)
+	is.True(strings.Contains(warning, "may slow following"))
+
+	tooSlowMatch = 0
+	_, err = SetMatch(`(.*a){20}`)
+	is.True(strings.Contains(err.Error(), "too slow"))
+}
+
+func TestSetExcludes(t *testing.T) {
+	is := is.New(t)
+	defer func() { lineExcludes = nil }()
+	defer func(slow time.Duration) { slowMatch = slow }(slowMatch)
+	slowMatch = time.Hour
+
+	warnings, err := SetExcludes([]string{`debug`, `^#`})
+	is.NoErr(err)
+	is.Equal(len(warnings), 0)
+
+	stage := ExcludeStage(lineExcludes)
+	is.True(stage(&Line{Text: "an error"}))
+	is.True(!stage(&Line{Text: "a debug line"}))
+	is.True(!stage(&Line{Text: "# a comment"}))
+
+	_, err = SetExcludes([]string{`(unclosed`})
+	is.True(err != nil)
+}
+
+func TestHostFor(t *testing.T) {
+	is := is.New(t)
+
+	tests := []struct {
+		command, host string
+	}{
+		{"ssh web1 tail -F /var/log/app.log", "web1"},
+		{"ssh -p 2222 -i key me@web2 tail -F app.log", "web2"},
+		{"/usr/bin/ssh -oBatchMode=yes ssh://me@web3:2222 cat app.log", "web3"},
+		{"tail -F /var/log/app.log", ""},
+		{"ssh", ""},
+	}
+	for _, test := range tests {
+		is.Equal(sshHost(test.command), test.host)
+	}
+
+	is.Equal(HostFor("ssh web1 tail -F app.log"), "web1")
+	is.Equal(HostFor("/var/log/app.log"), localHost)
+}
+
+func TestCanonicalStage(t *testing.T) {
+	is := is.New(t)
+
+	source := config.ForPath("app.log")
+	output, ok := Pipeline{CanonicalStage(false)}.Run("app.log", source, FormatPlain, "INFO {\"b\": 2, \"a\": 1}\r")
+	is.True(ok)
+	is.Equal(output, `INFO {"a":1,"b":2}`)
+	output, _ = Pipeline{CanonicalStage(false)}.Run("app.log", source, FormatPlain, "plain {\r")
+	is.Equal(output, "plain {")
+
+	output, ok = Pipeline{CanonicalStage(true)}.Run("app.log", source, FormatPlain, "INFO {\"b\": 2, \"a\": 1}")
+	is.True(ok)
+	is.Equal(output, `{"a":1,"b":2}`)
+	_, ok = Pipeline{CanonicalStage(true)}.Run("app.log", source, FormatPlain, "plain")
+	is.True(!ok)
+}
+
+func TestNameStage(t *testing.T) {
+	is := is.New(t)
+	defer func() { nameWidth = 0 }()
+
+	source := config.ForPath("api.log")
+	p := Pipeline{func(line *Line) bool { line.Flag("late"); return true }, nameStage}
+	output, _ := p.Run("api.log", source, FormatPlain, "text")
+	is.Equal(output, "api.log | "+Colour(BrightRed, "[late]")+" text")
+
+	// Names are padded to the longest seen
+	Pipeline{nameStage}.Run("worker.log", source, FormatPlain, "text")
+	output, _ = Pipeline{nameStage}.Run("api.log", source, FormatPlain, "text")
+	is.Equal(output, "api.log    | text")
+
+	PadNames([]string{"a-much-longer.log"})
+	output, _ = Pipeline{nameStage}.Run("api.log", source, FormatPlain, "text")
+	is.Equal(output, "api.log           | text")
+}
+
+func TestHostStage(t *testing.T) {
+	is := is.New(t)
+
+	hostsMutex.Lock()
+	hosts["ssh a tail -F x"], hosts["ssh bbb tail -F x"] = "a", "bbb"
+	width := hostWidth
+	hostWidth = 3
+	hostsMutex.Unlock()
+	defer func() { hostWidth = width }()
+
+	source := config.ForPath("")
+	p := Pipeline{func(line *Line) bool { line.Flag("late"); return true }, hostStage}
+	output, _ := p.Run("ssh a tail -F x", source, FormatPlain, "text")
+	is.Equal(output, Colour(HeaderColour("ssh a tail -F x"), "a  ")+" "+Colour(BrightRed, "[late]")+" text")
+	output, _ = Pipeline{hostStage}.Run("ssh bbb tail -F x", source, FormatPlain, "text")
+	is.Equal(output, Colour(HeaderColour("ssh bbb tail -F x"), "bbb")+" text")
+}
+
+func TestRecordStage(t *testing.T) {
+	is := is.New(t)
+
+	mode, err := ParseOutput("json")
+	is.NoErr(err)
+	is.Equal(mode, OutputNDJSON)
+	_, err = ParseOutput("xml")
+	is.True(err != nil)
+
+	source := config.ForPath("")
+	SetLineNumber("app.log", 40)
+	p := Pipeline{numberStage, MatchStage(regexp.MustCompile(`^[^#]`)), func(line *Line) bool { line.Flag("late"); return true }, recordStage}
+	// Dropped lines are still counted
+	_, dropped := p.Run("app.log", source, FormatPlain, "# comment")
+	is.True(!dropped)
+
+	output, ok := p.Run("app.log", source, FormatPlain, "2022-11-19T21:19:20Z started")
+	is.True(ok)
+	is.Equal(output, `{"file":"app.log","line_number":41,"timestamp":"2022-11-19T21:19:20Z","text":"2022-11-19T21:19:20Z started","note":"late"}`)
+	output, _ = p.Run("app.log", source, FormatPlain, "no time")
+	is.Equal(output, `{"file":"app.log","line_number":42,"text":"no time","note":"late"}`)
+
+	// Sources without a known line number leave it out
+	output, _ = p.Run("other.log", source, FormatPlain, "x")
+	is.Equal(output, `{"file":"other.log","text":"x","note":"late"}`)
+}
+
+// benchmarkJSON a JSON line of the kind the JSON stage handles
+const benchmarkJSON = `Nov 19 21:19:19 c1 nomad-firehose: {"Name":"997b2ae0","NodeID":"84cb91a8","TaskState":"running","TaskFailed":false,"TaskEvent":{"Type":"Started","Time":1668892759600613277,"Details":{}}}`
+
+// BenchmarkColour benchmark colouring a header
+// Before joining only when needed: 96.06 ns/op    40 B/op    2 allocs/op
+// After:                           12.33 ns/op     0 B/op    0 allocs/op
+func BenchmarkColour(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Colour(BrightBlue, "==> /var/log/app.log <==")
+	}
+}
+
+// BenchmarkJSONStage benchmark the JSON stage indenting without colour
+// Before: 6724 ns/op    27.66 MB/s    2168 B/op    36 allocs/op
+// After:  1124 ns/op   165.44 MB/s     608 B/op     3 allocs/op
+func BenchmarkJSONStage(b *testing.B) {
+	p := Pipeline{JSONStage(true, false, false, true)}
+	source := config.ForPath("")
+	b.SetBytes(int64(len(benchmarkJSON)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.Run("", source, FormatPlain, benchmarkJSON)
+	}
+}
+
+func BenchmarkTimestamp(b *testing.B) {
+	source := config.ForPath("")
+	text := `127.0.0.1 - - [19/Nov/2022:23:19:18 +0000] "GET / HTTP/1.1" 200 1`
+	b.SetBytes(int64(len(text)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sourceTime("bench.log", source, text)
+	}
+}
+
+func TestHighlights(t *testing.T) {
+	is := is.New(t)
+	defer func() { highlights = nil }()
+
+	_, err := SetHighlights([]string{"red:ERROR", "WARN|slow", "cyan:o", "http://[a-z]+"})
+	is.NoErr(err)
+	is.Equal(highlights[0].colour, BrightRed)
+	is.Equal(highlights[1].colour, BrightYellow)
+	// A prefix that isn't a colour is part of the pattern
+	is.Equal(highlights[3].re.String(), "http://[a-z]+")
+
+	is.Equal(applyHighlights("ERROR slow", highlights), paint(BrightRed, "ERROR")+" "+paint(BrightYellow, "slow"))
+	// Sequences from earlier stages are left alone
+	is.Equal(applyHighlights("\x1b[94mo\x1b[39m ok", highlights), "\x1b[94m"+paint(BrightCyan, "o")+"\x1b[39m "+paint(BrightCyan, "o")+"k")
+	is.Equal(applyHighlights("fine", highlights), "fine")
+
+	_, err = SetHighlights([]string{"red:"})
+	is.True(err != nil)
+	_, err = SetHighlights([]string{"("})
+	is.True(err != nil)
+}
+
+func TestRules(t *testing.T) {
+	is := is.New(t)
+	defer func() { rules = nil }()
+
+	configured := []*config.Rule{{Name: "oom", Match: "OOM", Colour: "red"}}
+	_, err := SetRules(configured, []string{"slow=took \\d{4,}ms", "web=GET"})
+	is.NoErr(err)
+	is.Equal(rules[0].colour, BrightRed)
+	is.True(rules[1].colour != rules[2].colour)
+
+	p := Pipeline{ruleStage, ruleLabelStage}
+	output, _ := p.Run("rules.log", config.ForPath("rules.log"), FormatPlain, "GET /report took 5230ms")
+	is.Equal(output, Colour(rules[1].colour, "[slow]")+" "+Colour(rules[2].colour, "[web]")+" GET /report took 5230ms")
+	output, _ = p.Run("rules.log", config.ForPath("rules.log"), FormatPlain, "fine")
+	is.Equal(output, "fine")
+
+	_, err = SetRules(configured, []string{"oom=kill"})
+	is.True(err != nil)
+	_, err = SetRules(nil, []string{"=GET"})
+	is.True(err != nil)
+	_, err = SetRules(nil, []string{"web="})
+	is.True(err != nil)
+}
+
+func TestFileColours(t *testing.T) {
+	is := is.New(t)
+	defer func() { fileColours, fileBar = nil, false }()
+
+	is.Equal(HeaderColour("a.log"), BrightBlue)
+
+	// Colours are given in turn and kept for each file
+	SetFileColours(false)
+	is.Equal(HeaderColour("a.log"), filePalette[0])
+	is.Equal(HeaderColour("b.log"), filePalette[1])
+	is.Equal(HeaderColour("a.log"), filePalette[0])
+	for i := 0; i < len(filePalette); i++ {
+		HeaderColour(fmt.Sprintf("%d.log", i))
+	}
+	is.Equal(HeaderColour("c.log"), filePalette[(len(filePalette)+2)%len(filePalette)])
+}
+
+func TestSetColour(t *testing.T) {
+	is := is.New(t)
+	level := gchalk.GetLevel()
+	defer func() {
+		useColour = false
+		gchalk.SetLevel(level)
+	}()
+
+	is.NoErr(SetColour("always"))
+	is.True(useColour)
+	is.NoErr(SetColour("never"))
+	is.True(!useColour)
+	// Test output isn't a terminal
+	is.NoErr(SetColour("auto"))
+	is.True(!useColour)
+	is.True(SetColour("sometimes") != nil)
+}
+
+func TestAlerts(t *testing.T) {
+	is := is.New(t)
+
+	a := &alertState{count: 2, window: time.Minute}
+	now := time.Now()
+	is.True(!a.match(now))
+	is.True(!a.match(now.Add(time.Second)))
+	// The third match within a minute raises the alert, once
+	is.True(a.match(now.Add(2 * time.Second)))
+	is.True(!a.match(now.Add(3 * time.Second)))
+	// Matches falling back to the count rearm it
+	is.True(!a.match(now.Add(2 * time.Minute)))
+	is.True(!a.match(now.Add(2*time.Minute + time.Second)))
+	is.True(a.match(now.Add(2*time.Minute + 2*time.Second)))
+
+	// Alerts are sent to the webhook
+	received := make(chan alertEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event alertEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		received <- event
+	}))
+	defer server.Close()
+	defer func() { rules, alertsOn, alertNotify = nil, 0, nil }()
+
+	configured := []*config.Rule{{Name: "5xx", Match: " 5\\d\\d ", Count: 1}}
+	_, err := SetRules(configured, nil)
+	is.NoErr(err)
+	rules[0].alert.window = time.Minute
+	StartAlerts(&config.Notify{Webhook: server.URL})
+	p := Pipeline{ruleStage}
+	p.Run("web.log", config.ForPath("web.log"), FormatPlain, `"GET /" 502 12`)
+	p.Run("web.log", config.ForPath("web.log"), FormatPlain, `"GET /" 503 12`)
+	event := <-received
+	is.Equal(event.Rule, "5xx")
+	is.Equal(event.Line, `"GET /" 503 12`)
+}
+
+func TestSupervise(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(restartWait(1), restartDelay)
+	is.Equal(restartWait(3), 4*restartDelay)
+	is.Equal(restartWait(100), maxRestartDelay)
+
+	// A panic and an error are restarted, and counted, until reading ends
+	m := metrics.For("supervised.log")
+	var runs int
+	supervise("supervised.log", m, nil, func() error {
+		runs++
+		switch runs {
+		case 1:
+			panic("bad line")
+		case 2:
+			return errors.New("read failed")
+		}
+		return nil
+	})
+	is.Equal(runs, 3)
+	is.Equal(m.Restarts(), uint64(2))
+
+	// Closing stop ends the wait to restart
+	stop := make(chan struct{})
+	close(stop)
+	runs = 0
+	supervise("stopped.log", metrics.For("stopped.log"), stop, func() error {
+		runs++
+		return errors.New("read failed")
+	})
+	is.Equal(runs, 1)
+}
+
+func TestWaitForAccess(t *testing.T) {
+	is := is.New(t)
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	is.NoErr(os.WriteFile(path, []byte("a\n"), 0644))
+	is.True(!denied(path))
+	is.True(!denied(path + ".missing"))
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("permissions don't deny access")
+	}
+
+	is.NoErr(os.Chmod(path, 0))
+	is.True(denied(path))
+	m := metrics.For(path)
+	m.SetUp(true)
+	stop := make(chan struct{})
+	done := make(chan bool)
+	go func() { done <- waitForAccess(path, m, stop) }()
+
+	time.Sleep(accessInterval / 2)
+	is.True(!m.Up()) // the source is down while access is denied
+	is.NoErr(os.Chmod(path, 0644))
+	is.True(<-done)
+	is.True(m.Up())
+
+	// Closing stop ends the wait
+	is.NoErr(os.Chmod(path, 0))
+	close(stop)
+	is.True(!waitForAccess(path, m, stop))
+}
+
+func TestFallbackTime(t *testing.T) {
+	is := is.New(t)
+	defer SetOptions(Options{})
+
+	_, err := ParseFallbackTime("later")
+	is.True(err != nil)
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	os.WriteFile(path, []byte("x\n"), 0644)
+	modified := time.Date(2022, 11, 19, 21, 19, 20, 0, time.UTC)
+	os.Chtimes(path, modified, modified)
+
+	SetOptions(Options{FallbackTime: FallbackMtime})
+	source := config.ForPath("")
+	p := Pipeline{numberStage, recordStage}
+	output, _ := p.Run(path, source, FormatPlain, "no time")
+	is.Equal(output, `{"file":"`+path+`","timestamp":"`+modified.Local().Format(time.RFC3339Nano)+`","timestamp_source":"mtime","text":"no time"}`)
+	// Lines with a timestamp keep it, taken as local time without a zone
+	output, _ = p.Run(path, source, FormatPlain, "2021-01-02 03:04:05 started")
+	started := time.Date(2021, 1, 2, 3, 4, 5, 0, time.Local).Format(time.RFC3339Nano)
+	is.Equal(output, `{"file":"`+path+`","timestamp":"`+started+`","text":"2021-01-02 03:04:05 started"}`)
+
+	// Sources that aren't files use the time lines are received
+	_, origin := fallbackTime("echo hi", FallbackMtime)
+	is.Equal(origin, FallbackReceived)
+	when, _ := fallbackTime("echo hi", "")
+	is.True(when.IsZero())
+}
+
+func TestMemoryBudget(t *testing.T) {
+	is := is.New(t)
+	defer SetMaxMemory(0)
+
+	SetMaxMemory(10)
+	is.True(budget.take(6))
+	is.True(!budget.take(6))
+	budget.give(6)
+	is.True(budget.take(6))
+	budget.give(6)
+
+	// Matches not yet counted are shed once the budget is used up
+	w := &windowStats{errors: map[string]int{}, matches: map[string]int{}, match: regexp.MustCompile(`id=\d+`)}
+	is.True(w.stage(&Line{Path: "memory.log", Text: "id=1234"}))
+	is.True(w.stage(&Line{Path: "memory.log", Text: "id=1234"}))
+	is.True(w.stage(&Line{Path: "memory.log", Text: "id=5678"}))
+	_, matches := w.reset()
+	is.Equal(matches, map[string]int{"id=1234": 2})
+	is.Equal(metrics.For("memory.log").ShedBytes(), uint64(7))
+	is.Equal(budget.used, int64(0))
+}
+
+func TestPauser(t *testing.T) {
+	is := is.New(t)
+	defer SetMaxMemory(0)
+
+	// Held lines are released in order and their bytes given back
+	var p pauser
+	p.hold(msg{path: "pause.log", line: "one"})
+	p.hold(msg{path: "pause.log", line: "two"})
+	var printed []string
+	print := func(m msg) { printed = append(printed, m.line) }
+	p.release(print)
+	is.Equal(printed, []string{"one", "two"})
+	is.Equal(budget.used, int64(0))
+
+	// The oldest held lines are dropped once the budget is used up
+	SetMaxMemory(8)
+	printed = nil
+	p.hold(msg{path: "paused.log", line: "first"})
+	p.hold(msg{path: "paused.log", line: "second"})
+	is.Equal(p.dropped, 1)
+	is.Equal(metrics.For("paused.log").ShedBytes(), uint64(5))
+	p.release(print)
+	is.Equal(printed, []string{"second"})
+	is.Equal(p.dropped, 0)
+	is.Equal(budget.used, int64(0))
+}
+
+func TestSquasher(t *testing.T) {
+	is := is.New(t)
+
+	s := &squasher{timeout: time.Second, last: make(map[string]*repeat)}
+	now := time.Now()
+	repeated, notes := s.add(msg{path: "a.log", line: "refused"}, now)
+	is.True(!repeated)
+	is.Equal(len(notes), 0)
+	repeated, _ = s.add(msg{path: "a.log", line: "refused"}, now)
+	is.True(repeated)
+	repeated, _ = s.add(msg{path: "a.log", line: "refused"}, now)
+	is.True(repeated)
+
+	// Lines from other sources don't end a run of repeats
+	repeated, _ = s.add(msg{path: "b.log", line: "refused"}, now)
+	is.True(!repeated)
+
+	repeated, notes = s.add(msg{path: "a.log", line: "connected"}, now)
+	is.True(!repeated)
+	is.Equal(notes, []msg{{path: "a.log", line: "… repeated 2 times"}})
+
+	// Repeats are noted once the timeout passes and the line is forgotten
+	s.add(msg{path: "a.log", line: "connected"}, now)
+	is.Equal(len(s.expired(now, false)), 0)
+	is.Equal(s.expired(now.Add(time.Second), false), []msg{{path: "a.log", line: "… repeated 1 time"}})
+	repeated, _ = s.add(msg{path: "a.log", line: "connected"}, now)
+	is.True(!repeated)
+}
+
+func TestParseTimeBound(t *testing.T) {
+	is := is.New(t)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		value string
+		t     time.Time
+	}{
+		{"1h", now.Add(-time.Hour)},
+		{"09:30", time.Date(2024, 5, 1, 9, 30, 0, 0, time.Local)},
+		{"2024-04-30", time.Date(2024, 4, 30, 0, 0, 0, 0, time.Local)},
+		{"2024-04-30 08:15", time.Date(2024, 4, 30, 8, 15, 0, 0, time.Local)},
+		{"2024-04-30T08:15:00Z", time.Date(2024, 4, 30, 8, 15, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		got, err := ParseTimeBound(test.value, now)
+		is.NoErr(err)
+		is.True(got.Equal(test.t))
+	}
+
+	_, err := ParseTimeBound("yesterday", now)
+	is.True(err != nil)
+}
+
+func TestTimestamp(t *testing.T) {
+	is := is.New(t)
+	defer func() { lastParsers = map[string]int{} }()
+
+	source := &config.Source{}
+	line := &Line{Path: "access.log", Source: source, Text: `127.0.0.1 - - [19/Nov/2022:23:19:18 +0000] "GET / HTTP/1.1" 200 1`}
+	ts, ok := line.timestamp()
+	is.True(ok)
+	is.True(ts.Equal(time.Date(2022, 11, 19, 23, 19, 18, 0, time.UTC)))
+	// The parser that found it, for the access log layout after the format
+	// and JSON parsers, is tried first for the next line from the source
+	is.Equal(lastParsers["access.log"], 5)
+
+	// A line in another form is still parsed, and its parser tried first
+	ts, ok = sourceTime("access.log", source, `{"ts": 1668899958}`)
+	is.True(ok)
+	is.Equal(ts.Unix(), int64(1668899958))
+	is.Equal(lastParsers["access.log"], 1)
+
+	// The time is kept with the line until its text changes
+	line.parsed.t = time.Time{}
+	ts, _ = line.timestamp()
+	is.True(ts.IsZero())
+	line.Text = "2022-11-19 20:00:00 changed"
+	ts, ok = line.timestamp()
+	is.True(ok)
+	is.Equal(ts.Hour(), 20)
+
+	_, ok = sourceTime("access.log", source, "no time here")
+	is.True(!ok)
+}
+
+func TestTimeStage(t *testing.T) {
+	is := is.New(t)
+
+	since := time.Date(2024, 5, 1, 9, 30, 0, 0, time.Local)
+	until := time.Date(2024, 5, 1, 10, 30, 0, 0, time.Local)
+	stage := TimeStage(since, until)
+	source := &config.Source{}
+
+	var kept []string
+	for _, text := range []string{
+		"  continuation with nothing before",
+		"2024-05-01 09:00:00 INFO start",
+		"2024-05-01 10:00:00 ERROR boom",
+		"  at frame",
+		"2024-05-01 11:00:00 INFO later",
+		"  at another frame",
+	} {
+		if stage(&Line{Path: "app.log", Source: source, Text: text}) {
+			kept = append(kept, text)
+		}
+	}
+	is.Equal(kept, []string{"2024-05-01 10:00:00 ERROR boom", "  at frame"})
+}
+
+func TestAppendLineNumber(t *testing.T) {
+	is := is.New(t)
+
+	defer func() {
+		numberWidth = 3
+		SetLineNumbers(1, " ")
+	}()
+
+	is.Equal(string(appendLineNumber(nil, 7)), fmt.Sprintf("%-3d ", 7))
+	// The column is widened for the numbers expected
+	WidenLineNumbers(1200)
+	is.Equal(LineNumber(7), "7    ")
+	// and by numbers that outgrow it, without narrowing again
+	is.Equal(string(appendLineNumber([]byte("x"), 12345)), "x12345 ")
+	is.Equal(LineNumber(8), "8     ")
+
+	numberWidth = 3
+	SetLineNumbers(0, "\t")
+	is.Equal(LineNumber(1), "0  \t")
+	WidenLineNumbers(1000)
+	is.Equal(LineNumber(1000), "999\t")
+}
+
+func TestStatsFor(t *testing.T) {
+	is := is.New(t)
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	is.NoErr(os.WriteFile(path, []byte("one\ntwo\n"), 0644))
+
+	s := metrics.For(path)
+	s.SetUp(true)
+	s.Line(3, true)
+	s.Line(3, false)
+	s.SetOffset(4)
+	now := time.Now()
+
+	r := statsFor(path, s, now)
+	is.Equal(r.Type, "stats")
+	is.True(r.Up)
+	is.Equal(r.Lines, uint64(2))
+	is.Equal(r.Bytes, uint64(6))
+	is.Equal(r.Matched, uint64(1))
+	is.Equal(r.Dropped, uint64(1))
+	is.Equal(*r.Offset, int64(4))
+	is.Equal(*r.LagBytes, int64(4))
+
+	// Sources that aren't files have no offset or lag
+	r = statsFor("ssh web1 tail", metrics.For("ssh web1 tail"), now)
+	is.True(r.Offset == nil)
+	is.True(r.LagBytes == nil)
+}
+
+func TestWidthStages(t *testing.T) {
+	is := is.New(t)
+
+	line := &Line{Text: "abcdefghij"}
+	TruncateStage(4)(line)
+	is.Equal(line.Text, "abc…")
+
+	line = &Line{Text: "ééé"}
+	TruncateStage(3)(line)
+	is.Equal(line.Text, "ééé")
+
+	line = &Line{Text: "abcdefghij"}
+	WrapStage(4)(line)
+	is.Equal(line.Text, "abcd\nefgh\nij")
+
+	line = &Line{Text: "éééé"}
+	WrapStage(2)(line)
+	is.Equal(line.Text, "éé\néé")
+}
+
+func TestExplodeArray(t *testing.T) {
+	is := is.New(t)
+
+	elements, ok := explodeArray(` [{"b": 1, "a": 2}, "x", 3.50] `)
+	is.True(ok)
+	is.Equal(elements, []string{`{"b":1,"a":2}`, `"x"`, `3.50`})
+
+	_, ok = explodeArray(`{"a": [1, 2]}`)
+	is.True(!ok)
+	_, ok = explodeArray(`[not json`)
+	is.True(!ok)
+}
+
+func TestValidateStage(t *testing.T) {
+	is := is.New(t)
+
+	stage := ValidateStage(false)
+	checked, failed := ValidationCounts()
+
+	is.True(!stage(&Line{Path: "app.log", Text: `{"a": 1}`}))
+	is.True(!stage(&Line{Path: "app.log", Text: `2024-05-01 INFO {"a": [1, 2]}`}))
+	is.True(!stage(&Line{Path: "app.log", Text: "  "}))
+
+	line := &Line{Path: "app.log", Number: 7, Text: `{"a": }`}
+	is.True(stage(line))
+	is.True(strings.HasPrefix(line.Text, "app.log:7: invalid JSON: invalid character '}'"))
+
+	line = &Line{Path: "app.log", Text: "no payload"}
+	is.True(stage(line))
+	is.Equal(line.Text, "app.log: invalid JSON: no JSON found")
+
+	line = &Line{Path: "app.log", Text: "[1,"}
+	is.True(ValidateStage(true)(line))
+	is.Equal(line.Text, "[1,")
+	is.True(strings.HasPrefix(line.Note, "invalid JSON: "))
+
+	c, f := ValidationCounts()
+	is.Equal(c-checked, uint64(5))
+	is.Equal(f-failed, uint64(3))
+}
+
+func TestRing(t *testing.T) {
+	is := is.New(t)
+
+	SetRing(2)
+	defer func() { ring = nil }()
+	ring.add(msg{path: "a.log", line: "1"})
+	ring.add(msg{path: "a.log", line: "2"})
+	ring.add(msg{path: "b.log", line: "\x1b[31m3\x1b[0m", number: 7})
+
+	path, count, err := DumpRing(t.TempDir(), time.Date(2022, 11, 19, 21, 19, 20, 0, time.UTC))
+	is.NoErr(err)
+	is.Equal(count, 2)
+	is.Equal(filepath.Base(path), "gotail-20221119-211920.000.log")
+	b, err := os.ReadFile(path)
+	is.NoErr(err)
+	is.Equal(string(b), "==> a.log <==\n2\n\n==> b.log <==\n7   3\n")
+}
+
+func TestStream(t *testing.T) {
+	is := is.New(t)
+
+	s := &streamer{replay: 2, history: &ringBuffer{lines: make([]msg, 2)}, subscribers: map[*subscriber]bool{}}
+	s.publish(msg{path: "a.log", line: "one"})
+	s.publish(msg{path: "b.log", line: "two"})
+	s.publish(msg{path: "a.log", line: Colour(BrightRed, "three"), number: 3})
+
+	server := httptest.NewServer(http.HandlerFunc(s.serve))
+	defer server.Close()
+	defer s.close()
+
+	res, err := http.Get(server.URL + "?replay=x")
+	is.NoErr(err)
+	res.Body.Close()
+	is.Equal(res.StatusCode, http.StatusBadRequest)
+
+	// The lines kept for a file are sent before live ones
+	res, err = http.Get(server.URL + "?file=a.log")
+	is.NoErr(err)
+	defer res.Body.Close()
+	is.Equal(res.Header.Get("Content-Type"), "text/event-stream")
+	reader := bufio.NewReader(res.Body)
+	next := func() string {
+		line, err := reader.ReadString('\n')
+		is.NoErr(err)
+		blank, err := reader.ReadString('\n')
+		is.NoErr(err)
+		is.Equal(blank, "\n") // the end of the event
+		return strings.TrimSpace(line)
+	}
+	is.Equal(next(), `data: {"file":"a.log","line_number":3,"text":"three"}`)
+	s.publish(msg{path: "b.log", line: "four"})
+	s.publish(msg{path: "a.log", line: "five"})
+	is.Equal(next(), `data: {"file":"a.log","text":"five"}`)
+
+	// Nothing is replayed if none is asked for
+	res, err = http.Get(server.URL + "?replay=0")
+	is.NoErr(err)
+	defer res.Body.Close()
+	reader = bufio.NewReader(res.Body)
+	s.publish(msg{path: "b.log", line: "six"})
+	is.Equal(next(), `data: {"file":"b.log","text":"six"}`)
+}
+
+func TestStreamAnchors(t *testing.T) {
+	is := is.New(t)
+
+	// Lines from the tail package are anchored where they start
+	is.Equal(lineStart(&tail.Line{Text: "abc", SeekInfo: tail.SeekInfo{Offset: 10}}), int64(6))
+	is.Equal(lineStart(&tail.Line{Text: "", SeekInfo: tail.SeekInfo{Offset: 1}}), int64(0))
+
+	s := &streamer{replay: 1, history: &ringBuffer{lines: make([]msg, 3)}, subscribers: map[*subscriber]bool{}}
+	s.publish(msg{path: "a.log", line: "one", anchor: "a.log:0"})
+	s.publish(msg{path: "a.log", line: "two", anchor: "a.log:4"})
+	s.publish(msg{path: "a.log", line: "three", anchor: "a.log:8"})
+
+	server := httptest.NewServer(http.HandlerFunc(s.serve))
+	defer server.Close()
+	defer s.close()
+
+	res, err := http.Get(server.URL + "?from=a.log:99")
+	is.NoErr(err)
+	res.Body.Close()
+	is.Equal(res.StatusCode, http.StatusNotFound)
+
+	event := func(reader *bufio.Reader) (id, data string) {
+		line, err := reader.ReadString('\n')
+		is.NoErr(err)
+		id = strings.TrimPrefix(strings.TrimSpace(line), "id: ")
+		line, err = reader.ReadString('\n')
+		is.NoErr(err)
+		data = strings.TrimPrefix(strings.TrimSpace(line), "data: ")
+		reader.ReadString('\n')
+		return
+	}
+
+	// A link to a line starts at it, whatever is replayed otherwise
+	res, err = http.Get(server.URL + "?from=a.log:4")
+	is.NoErr(err)
+	defer res.Body.Close()
+	reader := bufio.NewReader(res.Body)
+	id, data := event(reader)
+	is.Equal(id, "a.log:4")
+	is.Equal(data, `{"file":"a.log","text":"two","anchor":"a.log:4"}`)
+	id, _ = event(reader)
+	is.Equal(id, "a.log:8")
+
+	// Reconnecting resumes after the last line received
+	r, err := http.NewRequest("GET", server.URL, nil)
+	is.NoErr(err)
+	r.Header.Set("Last-Event-ID", "a.log:0")
+	res, err = http.DefaultClient.Do(r)
+	is.NoErr(err)
+	defer res.Body.Close()
+	reader = bufio.NewReader(res.Body)
+	id, _ = event(reader)
+	is.Equal(id, "a.log:4")
+	id, _ = event(reader)
+	is.Equal(id, "a.log:8")
+}
+
+func TestForward(t *testing.T) {
+	is := is.New(t)
+
+	_, _, err := ParseForward("http://localhost:80")
+	is.True(err != nil)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	is.NoErr(err)
+	defer ln.Close()
+
+	is.NoErr(SetForward("tcp://"+ln.Addr().String(), true))
+	defer func() {
+		stopForward()
+		forward = nil
+	}()
+	conn, err := ln.Accept()
+	is.NoErr(err)
+	defer conn.Close()
+
+	line := &Line{Path: "app.log", Host: "web1", Number: 3, Text: "ok"}
+	is.True(!forward.stage(line)) // dropped from what is printed
+	got, err := bufio.NewReader(conn).ReadString('\n')
+	is.NoErr(err)
+	is.Equal(got, `{"file":"app.log","host":"web1","line_number":3,"text":"ok"}`+"\n")
+}
+
+func TestForwardQueue(t *testing.T) {
+	is := is.New(t)
+
+	// Lines left by an earlier run, the last cut short, are sent first
+	path := filepath.Join(t.TempDir(), "queue")
+	is.NoErr(os.WriteFile(path, []byte(`{"text":"a"}`+"\n"+`{"text":"b"}`+"\n"+`{"te`), 0600))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	is.NoErr(err)
+	defer ln.Close()
+
+	is.NoErr(SetForward("tcp://"+ln.Addr().String(), true))
+	defer func() {
+		stopForward()
+		forward = nil
+	}()
+	first, err := ln.Accept()
+	is.NoErr(err)
+	defer first.Close()
+	is.NoErr(SetForwardQueue(path, 1024, false))
+	conn, err := ln.Accept()
+	is.NoErr(err)
+	defer conn.Close()
+
+	forward.stage(&Line{Path: "app.log", Text: "c"})
+	reader := bufio.NewReader(conn)
+	for _, want := range []string{`{"text":"a"}`, `{"text":"b"}`, `{"file":"app.log","text":"c"}`} {
+		got, err := reader.ReadString('\n')
+		is.NoErr(err)
+		is.Equal(got, want+"\n")
+	}
+}
+
+func TestDiskQueue(t *testing.T) {
+	is := is.New(t)
+
+	path := filepath.Join(t.TempDir(), "queue")
+	q, err := openQueue(path, 8, false)
+	is.NoErr(err)
+	for _, test := range []struct {
+		record  string
+		dropped int
+	}{
+		{"aaa", 0},
+		{"bbb", 0},
+		{"c", 1}, // full, so the newest is dropped
+	} {
+		dropped, err := q.push([]byte(test.record))
+		is.NoErr(err)
+		is.Equal(dropped, test.dropped)
+	}
+	record, err := q.peek()
+	is.NoErr(err)
+	is.Equal(string(record), "aaa")
+	is.NoErr(q.pop(len(record)))
+	is.Equal(q.pending(), int64(4))
+
+	// or the oldest
+	q.dropOldest = true
+	dropped, err := q.push([]byte("cc"))
+	is.NoErr(err)
+	is.Equal(dropped, 0)
+	dropped, err = q.push([]byte("ddd"))
+	is.NoErr(err)
+	is.Equal(dropped, 1)
+
+	// Records not yet sent are kept when the queue is opened again
+	is.NoErr(q.close())
+	b, err := os.ReadFile(path)
+	is.NoErr(err)
+	is.Equal(string(b), "cc\nddd\n")
+	q, err = openQueue(path, 8, false)
+	is.NoErr(err)
+	defer q.close()
+	record, err = q.peek()
+	is.NoErr(err)
+	is.Equal(string(record), "cc")
+	is.Equal(q.pending(), int64(7))
+
+	// and emptied once they have all been sent
+	is.NoErr(q.pop(2))
+	is.NoErr(q.pop(3))
+	fi, err := os.Stat(path)
+	is.NoErr(err)
+	is.Equal(fi.Size(), int64(0))
+}
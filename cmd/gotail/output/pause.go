@@ -0,0 +1,68 @@
+package output
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/imarsman/gotail/cmd/gotail/metrics"
+	"github.com/imarsman/gotail/internal/util"
+)
+
+/*
+	With --no-scroll-interrupt printing can be paused while following, so that
+	lines already printed can be read or scrolled back through without new
+	lines taking the terminal back to the bottom. Terminals don't say when they
+	have been scrolled back, so a pause is asked for with a key rather than
+	detected. Lines that arrive while paused are held and printed when printing
+	resumes. They take from the --max-memory budget, and once it is used up the
+	oldest are dropped.
+*/
+
+// pauser the lines held while printing is paused. Only the printer goroutine
+// uses it.
+type pauser struct {
+	paused  bool
+	held    []msg
+	size    int // bytes in held taken from the memory budget
+	dropped int // lines dropped to stay within the budget
+}
+
+// SetPaused pause printing followed lines, or resume it, printing the lines
+// held while it was paused
+func SetPaused(paused bool) {
+	select {
+	case outputPrinter.pause <- paused:
+	case <-outputPrinter.done:
+	}
+}
+
+// hold keep m to print when printing resumes, dropping the oldest lines held
+// if there isn't memory for it
+func (p *pauser) hold(m msg) {
+	for !budget.take(len(m.line)) {
+		if len(p.held) == 0 {
+			budget.force(len(m.line))
+			break
+		}
+		oldest := p.held[0]
+		budget.give(len(oldest.line))
+		p.size -= len(oldest.line)
+		metrics.For(oldest.path).Shed(len(oldest.line))
+		p.held = p.held[1:]
+		p.dropped++
+	}
+	p.size += len(m.line)
+	p.held = append(p.held, m)
+}
+
+// release print the lines held with print, saying how many were dropped
+func (p *pauser) release(print func(m msg)) {
+	for _, m := range p.held {
+		print(m)
+	}
+	budget.give(p.size)
+	if p.dropped > 0 {
+		fmt.Fprintf(os.Stderr, "%d %s dropped while paused to stay under --max-memory\n", p.dropped, util.Pluralize("line", "lines", p.dropped))
+	}
+	p.held, p.size, p.dropped = nil, 0, 0
+}
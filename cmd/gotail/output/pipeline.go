@@ -0,0 +1,315 @@
+package output
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imarsman/gotail/cmd/gotail/metrics"
+	"github.com/imarsman/gotail/cmd/gotail/schema"
+	"github.com/imarsman/gotail/internal/config"
+	"github.com/imarsman/gotail/internal/util"
+)
+
+// Line a line being processed along with what is known about where it came
+// from. Stages change Text to change what is printed.
+type Line struct {
+	Path   string // the file or other source the line came from
+	Host   string // the machine the source is on
+	Source *config.Source
+	Format Format
+	Text   string
+	Note   string   // printed before the line, such as why it is flagged
+	Rules  []string // names of the rules the line matched
+	Number int      // line number in the source, 0 if not known
+	Time   time.Time
+	Origin string // where Time is from if not the line, such as FallbackReceived
+
+	parsed parsedTime // the timestamp found in Text, so it is only looked for once
+}
+
+// Flag add a note on why the line is flagged, printed before it
+func (l *Line) Flag(note string) {
+	if l.Note != "" {
+		l.Note += "; "
+	}
+	l.Note += note
+}
+
+// Stage a step in processing a line. A stage returns false to drop the line.
+type Stage func(line *Line) bool
+
+// Pipeline stages run in order for each line
+type Pipeline []Stage
+
+var pipeline Pipeline      // the pipeline used by GetOutput
+var pipelineOnce sync.Once // used to build the pipeline on first use
+
+// linePool reuses Line values, which would otherwise be allocated for every
+// line as stages take a pointer to them.
+var linePool = sync.Pool{
+	New: func() interface{} {
+		return new(Line)
+	},
+}
+
+// SetPipeline set the pipeline used by GetOutput. It must be called before
+// any lines are processed.
+func SetPipeline(p Pipeline) {
+	pipeline = p
+}
+
+// Run run text from path through each stage, stopping if a stage drops the line
+func (p Pipeline) Run(path string, source *config.Source, format Format, text string) (output string, ok bool) {
+	line := linePool.Get().(*Line)
+	defer linePool.Put(line)
+
+	line.Path, line.Source, line.Format, line.Text, line.Note = path, source, format, text, ""
+	line.Rules = line.Rules[:0]
+	line.Host, line.Number, line.Time, line.Origin = HostFor(path), 0, time.Time{}, ""
+	for _, stage := range p {
+		if !stage(line) {
+			return "", false
+		}
+	}
+	if line.Note != "" {
+		return Colour(BrightRed, "["+line.Note+"]") + " " + line.Text, true
+	}
+
+	return line.Text, true
+}
+
+// lineSchema the schema JSON in lines is checked against, if any
+var lineSchema *schema.Schema
+
+// SetSchema check the JSON in lines against s. It must be called before any
+// lines are processed.
+func SetSchema(s *schema.Schema) {
+	lineSchema = s
+}
+
+// NewPipeline build a pipeline from opts and the config for this run so that
+// they don't need to be checked for every line. The order of stages is
+// match, exclude, time window, validation, schema, order, script, rules,
+// pattern counts, summary counts, hash, copy, cut or wrap, forward, parse JSON,
+// colour, highlights, rule names, then the source name, host column or JSON
+// record.
+func NewPipeline(opts Options) (p Pipeline) {
+	records := opts.Output == OutputNDJSON
+	if records || opts.ValidateJSON || forward != nil {
+		p = append(p, numberStage)
+	}
+	if lineMatch != nil {
+		p = append(p, MatchStage(lineMatch))
+	}
+	if len(lineExcludes) > 0 {
+		p = append(p, ExcludeStage(lineExcludes))
+	}
+	if !opts.Since.IsZero() || !opts.Until.IsZero() {
+		p = append(p, TimeStage(opts.Since, opts.Until))
+	}
+	if opts.ValidateJSON {
+		p = append(p, ValidateStage(records))
+	}
+	if lineSchema != nil {
+		p = append(p, SchemaStage(lineSchema, opts.SchemaInvalid))
+	}
+	if opts.CheckOrder {
+		p = append(p, OrderStage(opts.ClockJump))
+	}
+	if lineScript != nil {
+		p = append(p, lineScript)
+	}
+	if len(rules) > 0 {
+		p = append(p, ruleStage)
+	}
+	// With a single --match every printed line matches, so counts are only
+	// kept once there are highlights
+	if len(highlights) > 0 {
+		p = append(p, HitStage(hitPatterns()))
+	}
+	if window != nil {
+		p = append(p, window.stage)
+	}
+	if len(opts.HashFields) > 0 {
+		p = append(p, newFieldHasher(opts.HashKey, opts.HashFields).stage)
+	}
+	if opts.CopyMatch {
+		p = append(p, copyStage)
+	}
+	// Lines are cut or broken before colour codes are added
+	if opts.Truncate > 0 {
+		p = append(p, TruncateStage(opts.Truncate))
+	}
+	if opts.Wrap > 0 {
+		p = append(p, WrapStage(opts.Wrap))
+	}
+	// Lines are forwarded as read, before JSON is formatted or colour added
+	if forward != nil {
+		p = append(p, forward.stage)
+	}
+
+	// Text output gives lines with JSON as "prefix, json". Records only look
+	// for JSON if it is to be formatted or used for the log level.
+	var levelField bool
+	for _, s := range config.Current.Sources {
+		if s.LevelField != "" {
+			levelField = true
+		}
+	}
+	switch {
+	case opts.Canonical:
+		p = append(p, CanonicalStage(opts.JSONOnly))
+	case !records || opts.JSON || opts.JSONOnly || levelField:
+		p = append(p, JSONStage(opts.JSON, opts.JSONOnly, useColour, opts.KeepKeyOrder))
+	}
+
+	if useColour {
+		p = append(p, highlightStage)
+		if len(highlights) > 0 {
+			p = append(p, highlightMatchStage)
+		}
+	}
+	if len(rules) > 0 && !records {
+		p = append(p, ruleLabelStage)
+	}
+	if opts.PrefixName && !records {
+		p = append(p, nameStage)
+	}
+	switch {
+	case records:
+		p = append(p, recordStage)
+	case opts.HostColumn:
+		p = append(p, hostStage)
+	}
+
+	return
+}
+
+// MatchStage drop lines that don't match re
+func MatchStage(re *regexp.Regexp) Stage {
+	return func(line *Line) bool {
+		return re.MatchString(line.Text)
+	}
+}
+
+// ExcludeStage drop lines that match any of res
+func ExcludeStage(res []*regexp.Regexp) Stage {
+	return func(line *Line) bool {
+		for _, re := range res {
+			if re.MatchString(line.Text) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// SchemaStage flag lines whose JSON does not conform to s. If invalidOnly is
+// true only lines with nonconforming JSON are kept.
+func SchemaStage(s *schema.Schema, invalidOnly bool) Stage {
+	return func(line *Line) bool {
+		ok, jl := getContent(line.Text)
+		if !ok {
+			return !invalidOnly
+		}
+		err := s.ValidateJSON(jl.json)
+		if err == nil {
+			return !invalidOnly
+		}
+		line.Flag("schema " + err.Error())
+
+		return true
+	}
+}
+
+// stage replace hashed field values
+func (h *fieldHasher) stage(line *Line) bool {
+	line.Text = h.replace(line.Text)
+	return true
+}
+
+// copyStage keep the line for --copy-match
+func copyStage(line *Line) bool {
+	lastMatch.Store(line.Text)
+	return true
+}
+
+// highlightStage colour parts of the line according to its format
+func highlightStage(line *Line) bool {
+	line.Text = line.Format.Highlight(line.Text)
+	return true
+}
+
+// CanonicalStage print lines the same way whenever they are read, for
+// comparing runs. A carriage return ending a line is dropped and JSON in a
+// line is written on one line with its keys sorted. If jsonOnly is true only
+// the JSON of lines with JSON is kept.
+func CanonicalStage(jsonOnly bool) Stage {
+	return func(line *Line) bool {
+		line.Text = strings.TrimSuffix(line.Text, "\r")
+		i := strings.IndexByte(line.Text, '{')
+		if i < 0 {
+			return !jsonOnly
+		}
+		json, err := util.CanonicalJSON(line.Text[i:])
+		if err != nil {
+			return !jsonOnly
+		}
+		if jsonOnly {
+			line.Text = json
+		} else {
+			line.Text = line.Text[:i] + json
+		}
+
+		return true
+	}
+}
+
+// JSONStage split lines into a prefix and JSON given as "prefix, json",
+// colouring the prefix by log level if the source has a level field. If
+// indent is true the JSON is indented, with keys in the order given if
+// keepOrder is true, and coloured if colour is true. If jsonOnly is true lines
+// without JSON are dropped.
+func JSONStage(indent, jsonOnly, colour, keepOrder bool) Stage {
+	return func(line *Line) bool {
+		ok, jl := getContent(line.Text)
+		if !ok {
+			// A brace with no valid JSON after it is counted as a parse
+			// failure when JSON is expected
+			expected := indent || jsonOnly || line.Source.LevelField != ""
+			if expected && strings.IndexByte(line.Text, '{') >= 0 {
+				metrics.For(line.Path).InvalidJSON()
+			}
+			return !jsonOnly
+		}
+
+		// Colour the prefix by log level if a level field is configured
+		if level := getLevel(line.Source, jl.json); level != "" {
+			if jl.prefix == "" {
+				jl.prefix = level
+			}
+			jl.prefix = Colour(levelColour(level), jl.prefix)
+		}
+
+		if !indent {
+			line.Text = jl.prefix + ", " + jl.json
+			return true
+		}
+		json, err := util.IndentJSON(jl.json, keepOrder)
+		if err != nil {
+			json = jl.json
+		}
+		if colour {
+			if coloured, err := util.ColourJSON(json); err == nil {
+				json = coloured
+			}
+			line.Text = jl.prefix + " " + json
+		} else {
+			line.Text = jl.prefix + ", " + json
+		}
+
+		return true
+	}
+}
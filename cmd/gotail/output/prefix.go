@@ -0,0 +1,67 @@
+package output
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+/*
+	With --prefix-filename every line is printed after the short name of its
+	source, as docker-compose logs does, rather than under headers. Lines from
+	many files interleaving quickly can then be told apart and searched with
+	grep. Names are padded to the longest seen so that lines stay aligned.
+*/
+
+var (
+	nameWidth      int // length of the longest name prefixed, used to align lines
+	nameWidthMutex sync.Mutex
+)
+
+// PadNames pad the names prefixed to lines to at least the longest name of
+// paths, so that lines from sources known at the start line up from the first
+func PadNames(paths []string) {
+	nameWidthMutex.Lock()
+	defer nameWidthMutex.Unlock()
+
+	for _, path := range paths {
+		if n := utf8.RuneCountInString(SourceName(path)); n > nameWidth {
+			nameWidth = n
+		}
+	}
+}
+
+// namePrefix get the name of path padded to the width of the longest name
+// seen and followed by a separator
+func namePrefix(path string) string {
+	name := SourceName(path)
+	n := utf8.RuneCountInString(name)
+
+	nameWidthMutex.Lock()
+	if n > nameWidth {
+		nameWidth = n
+	}
+	width := nameWidth
+	nameWidthMutex.Unlock()
+
+	// Colour would collapse the padding, so the name is painted as it is
+	prefix := name + strings.Repeat(" ", width-n) + " |"
+	if useColour {
+		prefix = paint(HeaderColour(path), prefix)
+	}
+
+	return prefix + " "
+}
+
+// nameStage prefix lines with the name of their source. It is run after
+// other stages so that the name comes before any note.
+func nameStage(line *Line) bool {
+	text := line.Text
+	if line.Note != "" {
+		text = Colour(BrightRed, "["+line.Note+"]") + " " + text
+		line.Note = ""
+	}
+	line.Text = namePrefix(line.Path) + text
+
+	return true
+}
@@ -2,9 +2,12 @@ package output
 
 import (
 	"fmt"
+	"os"
 	"strings"
 
+	"github.com/imarsman/gotail/internal/config"
 	"github.com/jwalton/gchalk"
+	"golang.org/x/term"
 )
 
 const (
@@ -16,26 +19,59 @@ const (
 	BrightBlue
 	// BrightRed bright red output colour
 	BrightRed
+	// BrightCyan bright cyan output colour
+	BrightCyan
+	// BrightMagenta bright magenta output colour
+	BrightMagenta
+	// BrightWhite bright white output colour
+	BrightWhite
 	// NoColour no output colour
 	NoColour // Can use to default to no colour output
 )
 
 var useColour bool
 
-// SetColour set whether or not to use colour output
-func SetColour(use bool) {
-	useColour = use
+// SetColour set when to use colour output: always, auto for when standard
+// output is a terminal, or never. Colour is forced on for always even when
+// the terminal library would leave it off, as when output is piped.
+func SetColour(mode string) error {
+	switch mode {
+	case "always":
+		useColour = true
+		if gchalk.GetLevel() == gchalk.LevelNone {
+			gchalk.SetLevel(gchalk.LevelBasic)
+		}
+	case "auto":
+		useColour = term.IsTerminal(int(os.Stdout.Fd()))
+	case "never":
+		useColour = false
+	default:
+		return fmt.Errorf("invalid colour mode %q, expected always, auto, or never", mode)
+	}
+
+	return nil
 }
 
 // Colour print in outputColour
 func Colour(colour int, input ...string) string {
-	str := fmt.Sprint(strings.Join(input, " "))
+	// Most calls have one string, which needs no joining
+	var str string
+	if len(input) == 1 {
+		str = input[0]
+	} else {
+		str = strings.Join(input, " ")
+	}
 	str = strings.Replace(str, "  ", " ", -1)
 
 	if !useColour {
 		return str
 	}
 
+	return paint(colour, str)
+}
+
+// paint colour str as it is
+func paint(colour int, str string) string {
 	// Choose colour for output or none
 	switch colour {
 	case BrightGreen:
@@ -46,7 +82,37 @@ func Colour(colour int, input ...string) string {
 		return gchalk.BrightBlue(str)
 	case BrightRed:
 		return gchalk.BrightRed(str)
+	case BrightCyan:
+		return gchalk.BrightCyan(str)
+	case BrightMagenta:
+		return gchalk.BrightMagenta(str)
+	case BrightWhite:
+		return gchalk.BrightWhite(str)
 	default:
 		return str
 	}
 }
+
+// colourNames colours that can be given by name in the config file
+var colourNames = map[string]int{
+	"green":   BrightGreen,
+	"yellow":  BrightYellow,
+	"blue":    BrightBlue,
+	"red":     BrightRed,
+	"cyan":    BrightCyan,
+	"magenta": BrightMagenta,
+	"white":   BrightWhite,
+	"none":    NoColour,
+}
+
+// HeaderColour get the colour for headers of path, set in the config file,
+// given to it with --file-colours, or bright blue by default
+func HeaderColour(path string) int {
+	if colour, ok := colourNames[strings.ToLower(config.ForPath(path).Colour)]; ok {
+		return colour
+	}
+	if fileColours != nil {
+		return fileColour(path)
+	}
+	return BrightBlue
+}
@@ -0,0 +1,170 @@
+package output
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+// diskQueue records waiting to be forwarded, kept in a file so that they
+// survive a restart. Records are appended one per line. The file is emptied
+// once they have all been sent, and rewritten without those sent once they
+// take up more of it than the limit on what is queued.
+type diskQueue struct {
+	file       *os.File
+	read       int64 // offset of the first record not yet sent
+	size       int64 // length of the file
+	max        int64 // the most bytes of records kept
+	dropOldest bool  // when full, drop the oldest records rather than the newest
+}
+
+// openQueue open the queue in the file at path, keeping the records already
+// in it
+func openQueue(path string, max int64, dropOldest bool) (*diskQueue, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// A record cut short when gotail last stopped is dropped
+	size := fi.Size()
+	buf := make([]byte, 4096)
+	for size > 0 {
+		start := size - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		n, err := file.ReadAt(buf[:size-start], start)
+		if err != nil && err != io.EOF {
+			file.Close()
+			return nil, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			size = start + int64(i) + 1
+			break
+		}
+		size = start
+	}
+	if size != fi.Size() {
+		if err = file.Truncate(size); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	return &diskQueue{file: file, size: size, max: max, dropOldest: dropOldest}, nil
+}
+
+// pending get the bytes of records not yet sent
+func (q *diskQueue) pending() int64 {
+	return q.size - q.read
+}
+
+// push add a record, which must not hold a newline, getting the number of
+// records dropped to keep within the limit
+func (q *diskQueue) push(record []byte) (dropped int, err error) {
+	n := int64(len(record)) + 1
+	if n > q.max {
+		return 1, nil
+	}
+	for q.pending()+n > q.max {
+		if !q.dropOldest {
+			return 1, nil
+		}
+		oldest, err := q.peek()
+		if err != nil {
+			return dropped, err
+		}
+		if err = q.pop(len(oldest)); err != nil {
+			return dropped, err
+		}
+		dropped++
+	}
+	if q.read > q.max {
+		if err = q.compact(); err != nil {
+			return
+		}
+	}
+
+	if _, err = q.file.WriteAt(append(record, '\n'), q.size); err != nil {
+		return
+	}
+	q.size += n
+
+	return
+}
+
+// peek get the oldest record not yet sent
+func (q *diskQueue) peek() ([]byte, error) {
+	var record []byte
+	buf := make([]byte, 4096)
+	for offset := q.read; ; {
+		n, err := q.file.ReadAt(buf, offset)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return append(record, buf[:i]...), nil
+		}
+		record = append(record, buf[:n]...)
+		offset += int64(n)
+		if err == io.EOF {
+			return nil, errors.New("queue file ends inside a record")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// pop remove the oldest record, of length n, once it has been sent
+func (q *diskQueue) pop(n int) error {
+	q.read += int64(n) + 1
+	if q.read < q.size {
+		return nil
+	}
+	q.read, q.size = 0, 0
+
+	return q.file.Truncate(0)
+}
+
+// compact rewrite the file with only the records not yet sent
+func (q *diskQueue) compact() error {
+	buf := make([]byte, 64*1024)
+	var written int64
+	for offset := q.read; offset < q.size; {
+		n, err := q.file.ReadAt(buf, offset)
+		if n > 0 {
+			if _, err := q.file.WriteAt(buf[:n], written); err != nil {
+				return err
+			}
+			offset += int64(n)
+			written += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := q.file.Truncate(written); err != nil {
+		return err
+	}
+	q.read, q.size = 0, written
+
+	return nil
+}
+
+// close close the file, leaving only the records not yet sent in it
+func (q *diskQueue) close() error {
+	if err := q.compact(); err != nil {
+		q.file.Close()
+		return err
+	}
+
+	return q.file.Close()
+}
@@ -0,0 +1,152 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Output modes for --output
+const (
+	OutputText   = "text"   // lines as they are, with headers
+	OutputNDJSON = "ndjson" // each line as a JSON object on a line of its own
+)
+
+// ParseOutput get the output mode for an --output value. json is taken as
+// ndjson as a line holding one object is valid JSON.
+func ParseOutput(value string) (string, error) {
+	switch value {
+	case "", OutputText:
+		return OutputText, nil
+	case "json", OutputNDJSON:
+		return OutputNDJSON, nil
+	}
+
+	return "", fmt.Errorf("invalid --output value %q, expected text, json, or ndjson", value)
+}
+
+// Times that can be given to lines without a timestamp of their own
+const (
+	FallbackReceived = "received" // when gotail read the line
+	FallbackMtime    = "mtime"    // when the file was last changed
+)
+
+// ParseFallbackTime check a --fallback-time value
+func ParseFallbackTime(value string) (string, error) {
+	switch value {
+	case "", "none":
+		return "", nil
+	case FallbackReceived, FallbackMtime:
+		return value, nil
+	}
+
+	return "", fmt.Errorf("invalid --fallback-time value %q, expected none, received, or mtime", value)
+}
+
+// Records check whether lines are written as JSON objects
+func Records() bool {
+	return options.Output == OutputNDJSON
+}
+
+// record a line written as a JSON object
+type record struct {
+	File       string   `json:"file"`
+	Host       string   `json:"host,omitempty"`
+	LineNumber int      `json:"line_number,omitempty"`
+	Timestamp  string   `json:"timestamp,omitempty"`
+	TimeSource string   `json:"timestamp_source,omitempty"`
+	Text       string   `json:"text"`
+	Note       string   `json:"note,omitempty"`
+	Rules      []string `json:"rules,omitempty"`
+	Anchor     string   `json:"anchor,omitempty"` // PATH:OFFSET of a streamed line
+}
+
+var (
+	lineNumbers      = map[string]int{} // number of the next line from each path
+	lineNumbersMutex sync.Mutex
+)
+
+// SetLineNumber set the number of the next line from path. Lines from sources
+// without a number set, or set to 0 as the number isn't known, are written
+// without one.
+func SetLineNumber(path string, number int) {
+	lineNumbersMutex.Lock()
+	defer lineNumbersMutex.Unlock()
+
+	lineNumbers[path] = number
+}
+
+// peekLineNumber get the number of the next line from path without using it
+func peekLineNumber(path string) int {
+	lineNumbersMutex.Lock()
+	defer lineNumbersMutex.Unlock()
+
+	return lineNumbers[path]
+}
+
+// numberStage number lines and get their timestamp before other stages drop
+// or change them
+func numberStage(line *Line) bool {
+	lineNumbersMutex.Lock()
+	if n := lineNumbers[line.Path]; n > 0 {
+		line.Number = n
+		lineNumbers[line.Path] = n + 1
+	}
+	lineNumbersMutex.Unlock()
+
+	if t, ok := line.timestamp(); ok {
+		line.Time = t
+		return true
+	}
+	line.Time, line.Origin = fallbackTime(line.Path, options.FallbackTime)
+
+	return true
+}
+
+// fallbackTime get the time to give a line from path without a timestamp and
+// where it is from, or a zero time if fallback is empty. A file's modification
+// time is when its last line was written, so it is exact for followed lines
+// and an upper bound for lines read before following. Sources that aren't
+// files use the time the line was received.
+func fallbackTime(path, fallback string) (t time.Time, source string) {
+	switch fallback {
+	case FallbackMtime:
+		if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() {
+			return fi.ModTime(), FallbackMtime
+		}
+		fallthrough
+	case FallbackReceived:
+		return time.Now(), FallbackReceived
+	}
+
+	return
+}
+
+// recordStage replace lines with a JSON object holding the line and what is
+// known about it. It is run last so that any note is part of the object.
+func recordStage(line *Line) bool {
+	r := record{
+		File:       line.Path,
+		LineNumber: line.Number,
+		Text:       line.Text,
+		Note:       line.Note,
+		Rules:      line.Rules,
+	}
+	if options.HostColumn {
+		r.Host = line.Host
+	}
+	if !line.Time.IsZero() {
+		r.Timestamp = line.Time.Format(time.RFC3339Nano)
+		r.TimeSource = line.Origin
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return false
+	}
+	line.Text, line.Note = string(b), ""
+
+	return true
+}
@@ -0,0 +1,126 @@
+package output
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Go regular expressions run in time linear in the length of the line so they
+// can't backtrack catastrophically, but large counted repetitions and nested
+// groups make each step slow enough that following falls behind. Patterns are
+// timed against a few long lines before use. The limits leave plenty of room
+// for slow machines and race detector builds, which run simple patterns
+// several times slower.
+var (
+	slowMatch    = 20 * time.Millisecond  // warn if a probe line takes longer than this
+	tooSlowMatch = 250 * time.Millisecond // refuse if a probe line takes longer than this
+)
+
+// probeRuns how many times each probe line is timed. The fastest run is
+// taken so that a pause for garbage collection or scheduling isn't counted.
+const probeRuns = 3
+
+// probeLine get a 4KB line of text repeated
+func probeLine(text string) string {
+	return strings.Repeat(text, 4096/len(text)+1)[:4096]
+}
+
+// probeLines long lines that don't end a match early, used to time patterns
+var probeLines = []string{
+	probeLine("a"),
+	probeLine("2022-11-19T21:19:20.354Z [DEBUG] http: request complete "),
+	probeLine(`{"level":"info","msg":"ok","n":12345} `),
+}
+
+// lineMatch the regex lines must match, if any
+var lineMatch *regexp.Regexp
+
+// SetMatch compile pattern and keep only lines that match it. An error is
+// returned if the pattern is invalid or too slow to check every line with,
+// and a warning if it is slow enough to hold up following busy sources. It
+// must be called before any lines are processed.
+func SetMatch(pattern string) (warning string, err error) {
+	re, warning, err := compileTimed("--match", pattern)
+	if err != nil {
+		return
+	}
+	lineMatch = re
+
+	return
+}
+
+// compileTimed compile pattern given with flag, timing it as described for
+// SetMatch
+func compileTimed(flag, pattern string) (re *regexp.Regexp, warning string, err error) {
+	re, err = regexp.Compile(pattern)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid %s pattern: %v", flag, err)
+	}
+
+	elapsed := timeMatch(re)
+	switch {
+	case elapsed > tooSlowMatch:
+		return nil, "", fmt.Errorf("%s pattern %s takes %v to check a 4KB line, which is too slow to use", flag, pattern, elapsed.Round(time.Millisecond))
+	case elapsed > slowMatch:
+		warning = fmt.Sprintf("%s pattern %s takes %v to check a 4KB line and may slow following", flag, pattern, elapsed.Round(time.Microsecond))
+	}
+
+	return
+}
+
+// lineExcludes regexes lines are dropped for matching
+var lineExcludes []*regexp.Regexp
+
+// SetExcludes compile patterns and drop lines that match any of them. Patterns
+// are checked as for SetMatch, with a warning returned for each that is slow.
+// It must be called before any lines are processed.
+func SetExcludes(patterns []string) (warnings []string, err error) {
+	lineExcludes = lineExcludes[:0]
+	for _, pattern := range patterns {
+		re, warning, err := compileTimed("--exclude", pattern)
+		if err != nil {
+			return nil, err
+		}
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
+		lineExcludes = append(lineExcludes, re)
+	}
+
+	return
+}
+
+// LineMatch get the regex set with SetMatch, or nil if none has been
+func LineMatch() *regexp.Regexp {
+	return lineMatch
+}
+
+// timeMatch get the longest time re takes to check one of the probe lines,
+// taking the fastest of a few runs for each line
+func timeMatch(re *regexp.Regexp) (longest time.Duration) {
+	for _, line := range probeLines {
+		var fastest time.Duration
+		for i := 0; i < probeRuns; i++ {
+			start := time.Now()
+			re.MatchString(line)
+			if elapsed := time.Since(start); i == 0 || elapsed < fastest {
+				fastest = elapsed
+			}
+			// A pattern too slow to use is not run again
+			if fastest > tooSlowMatch {
+				break
+			}
+		}
+		if fastest > longest {
+			longest = fastest
+		}
+		// No need to try more lines once a pattern is known to be unusable
+		if longest > tooSlowMatch {
+			break
+		}
+	}
+
+	return
+}
@@ -0,0 +1,96 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+/*
+	With --ring the last followed lines printed are kept so that, when
+	something interesting has already scrolled past, they can be written to a
+	file by sending gotail SIGUSR2. The file is named for the time it is written
+	and holds the lines without colour, under a header for each source as they
+	were printed.
+*/
+
+// ringBuffer the last followed lines printed
+type ringBuffer struct {
+	mutex sync.Mutex
+	lines []msg
+	next  int  // where the next line goes
+	full  bool // whether lines has wrapped around
+}
+
+// ring the lines kept, nil unless SetRing has been called
+var ring *ringBuffer
+
+// SetRing keep the last n followed lines printed so that they can be written
+// with DumpRing. It must be called before any lines are followed.
+func SetRing(n int) {
+	ring = &ringBuffer{lines: make([]msg, n)}
+}
+
+// add keep m, replacing the oldest line once the buffer is full
+func (r *ringBuffer) add(m msg) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.lines[r.next] = m
+	r.next++
+	if r.next == len(r.lines) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// snapshot get the lines kept, oldest first
+func (r *ringBuffer) snapshot() []msg {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.full {
+		return append([]msg(nil), r.lines[:r.next]...)
+	}
+
+	return append(append([]msg(nil), r.lines[r.next:]...), r.lines[:r.next]...)
+}
+
+// formatRing get lines as they were printed, without colour
+func formatRing(lines []msg) []byte {
+	var buf []byte
+	var path string
+	for i, m := range lines {
+		if m.path != path && !Records() {
+			path = m.path
+			if i > 0 {
+				buf = append(buf, '\n')
+			}
+			buf = append(buf, "==> "+SourceName(m.path)+" <==\n"...)
+		}
+		if m.number > 0 {
+			buf = appendLineNumber(buf, m.number)
+		}
+		buf = append(buf, reEscape.ReplaceAllString(m.line, "")...)
+		buf = append(buf, '\n')
+	}
+
+	return buf
+}
+
+// DumpRing write the lines kept by SetRing to a file in dir named for now,
+// returning its path and the number of lines written
+func DumpRing(dir string, now time.Time) (path string, count int, err error) {
+	if ring == nil {
+		return "", 0, fmt.Errorf("no lines are being kept")
+	}
+	lines := ring.snapshot()
+	path = filepath.Join(dir, "gotail-"+now.Format("20060102-150405.000")+".log")
+	if err = os.WriteFile(path, formatRing(lines), 0644); err != nil {
+		return "", 0, err
+	}
+
+	return path, len(lines), nil
+}
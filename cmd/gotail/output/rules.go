@@ -0,0 +1,120 @@
+package output
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/imarsman/gotail/internal/config"
+)
+
+/*
+	Rules are named regexes, given with --rule NAME=REGEX or in the config
+	file. Lines that match one or more rules are printed with the names of the
+	rules before them, so that it is clear which of several patterns fired.
+	Lines are matched as they are read, before JSON is formatted or colour is
+	added, and the names are printed in the rule's colour.
+*/
+
+// rule a named regex that lines are matched against
+type rule struct {
+	name   string
+	re     *regexp.Regexp
+	colour int
+	alert  *alertState // set for rules that raise alerts
+}
+
+// rules set with SetRules
+var rules []rule
+
+// ruleColours colours given in turn to rules without one
+var ruleColours = []int{BrightCyan, BrightMagenta, BrightYellow, BrightGreen, BrightBlue, BrightRed}
+
+// SetRules name lines matching rules from the config file and rules given as
+// NAME=REGEX. Rule names must be unique. Patterns are checked as for
+// SetMatch, with a warning returned for each that is slow. It must be called
+// before any lines are processed.
+func SetRules(configured []*config.Rule, specs []string) (warnings []string, err error) {
+	rules = rules[:0]
+	add := func(name, pattern, colour string, alert *alertState) error {
+		for _, r := range rules {
+			if r.name == name {
+				return fmt.Errorf("rule %q is given more than once", name)
+			}
+		}
+		re, warning, err := compileTimed("rule "+name, pattern)
+		if err != nil {
+			return err
+		}
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
+		r := rule{name: name, re: re, colour: ruleColours[len(rules)%len(ruleColours)], alert: alert}
+		if c, ok := colourNames[strings.ToLower(colour)]; ok {
+			r.colour = c
+		}
+		rules = append(rules, r)
+
+		return nil
+	}
+
+	for _, r := range configured {
+		var alert *alertState
+		if r.Count > 0 {
+			alert = &alertState{count: r.Count, window: r.WindowDuration()}
+		}
+		if err = add(r.Name, r.Match, r.Colour, alert); err != nil {
+			return nil, err
+		}
+	}
+	for _, spec := range specs {
+		i := strings.IndexByte(spec, '=')
+		if i < 1 || i == len(spec)-1 {
+			return nil, fmt.Errorf("invalid --rule %q, expected NAME=REGEX", spec)
+		}
+		if err = add(spec[:i], spec[i+1:], "", nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// ruleStage keep the names of the rules a line matches, counting matches of
+// alert rules
+func ruleStage(line *Line) bool {
+	for _, r := range rules {
+		if r.re.MatchString(line.Text) {
+			line.Rules = append(line.Rules, r.name)
+			if r.alert != nil {
+				checkAlert(r, line)
+			}
+		}
+	}
+
+	return true
+}
+
+// ruleLabelStage print the names of the rules a line matched before it
+func ruleLabelStage(line *Line) bool {
+	if len(line.Rules) == 0 {
+		return true
+	}
+	labels := make([]string, len(line.Rules))
+	for i, name := range line.Rules {
+		labels[i] = Colour(ruleColour(name), "["+name+"]")
+	}
+	line.Text = strings.Join(labels, " ") + " " + line.Text
+
+	return true
+}
+
+// ruleColour get the colour of the rule named name
+func ruleColour(name string) int {
+	for _, r := range rules {
+		if r.name == name {
+			return r.colour
+		}
+	}
+	return NoColour
+}
@@ -0,0 +1,91 @@
+package output
+
+import (
+	"fmt"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+/*
+	A Lua script given with --script defines a function called for each line.
+
+	function process(line, meta)
+	  if line:find("healthcheck") then
+	    return nil                           -- drop the line
+	  end
+	  if meta.format == "json" and line:find('"level":"error"') then
+	    return line, "error from " .. meta.path -- keep it with a note
+	  end
+	  return line:gsub("password=%S+", "password=***") -- change it
+	end
+
+	process returns nil or false to drop the line, true to keep it unchanged,
+	or a string to print in its place. A second string returned is a note
+	printed before the line. meta holds the path, format, and host of the
+	source.
+*/
+
+// lineScript the stage running the --script process function, if any
+var lineScript Stage
+
+// LoadScript load a Lua script defining process(line, meta) and run it for
+// each line. It must be called before any lines are processed.
+func LoadScript(path string) (err error) {
+	stage, err := ScriptStage(path)
+	if err != nil {
+		return
+	}
+	lineScript = stage
+
+	return
+}
+
+// ScriptStage run the process function of a Lua script for each line
+func ScriptStage(path string) (Stage, error) {
+	state := lua.NewState()
+	if err := state.DoFile(path); err != nil {
+		state.Close()
+		return nil, fmt.Errorf("script %s: %v", path, err)
+	}
+	process, ok := state.GetGlobal("process").(*lua.LFunction)
+	if !ok {
+		state.Close()
+		return nil, fmt.Errorf("script %s: no process function", path)
+	}
+
+	// A Lua state can only be used by one goroutine at a time
+	var mutex sync.Mutex
+
+	return func(line *Line) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		meta := state.NewTable()
+		meta.RawSetString("path", lua.LString(line.Path))
+		meta.RawSetString("format", lua.LString(line.Format.String()))
+		meta.RawSetString("host", lua.LString(line.Host))
+
+		err := state.CallByParam(lua.P{Fn: process, NRet: 2, Protect: true}, lua.LString(line.Text), meta)
+		if err != nil {
+			line.Flag("script " + err.Error())
+			return true
+		}
+		result, note := state.Get(-2), state.Get(-1)
+		state.Pop(2)
+
+		if s, ok := note.(lua.LString); ok && s != "" {
+			line.Flag(string(s))
+		}
+		switch v := result.(type) {
+		case lua.LString:
+			line.Text = string(v)
+			return true
+		case lua.LNumber:
+			line.Text = v.String()
+			return true
+		}
+
+		return lua.LVAsBool(result)
+	}, nil
+}
@@ -0,0 +1,68 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// boundLayouts layouts accepted for --since and --until, without a time zone
+// taken as local time
+var boundLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// clockLayouts layouts for a time today
+var clockLayouts = []string{"15:04:05", "15:04"}
+
+// ParseTimeBound parse a --since or --until value. It can be a duration before
+// now such as 1h, a date and time such as 2024-05-01 12:00 or in RFC 3339
+// format, a date, or a time today such as 09:30.
+func ParseTimeBound(value string, now time.Time) (t time.Time, err error) {
+	value = strings.TrimSpace(value)
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range boundLayouts {
+		if t, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range clockLayouts {
+		if c, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			y, m, d := now.Date()
+			return time.Date(y, m, d, c.Hour(), c.Minute(), c.Second(), 0, now.Location()), nil
+		}
+	}
+
+	return t, fmt.Errorf("invalid time %q, expected a duration such as 1h, a date and time such as 2006-01-02 15:04, or a time such as 15:04", value)
+}
+
+// TimeStage drop lines whose timestamp is before since or after until. A zero
+// time leaves that end of the window open. Lines without a timestamp, such as
+// the rest of a stack trace, are kept if the line before from the same source
+// with a timestamp was.
+func TimeStage(since, until time.Time) Stage {
+	var mutex sync.Mutex
+	kept := map[string]bool{}
+
+	return func(line *Line) bool {
+		t, ok := line.timestamp()
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		if !ok {
+			return kept[line.Path]
+		}
+		keep := (since.IsZero() || !t.Before(since)) && (until.IsZero() || !t.After(until))
+		kept[line.Path] = keep
+
+		return keep
+	}
+}
@@ -0,0 +1,238 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/imarsman/gotail/cmd/gotail/metrics"
+	"github.com/imarsman/gotail/internal/config"
+	"github.com/imarsman/gotail/internal/input"
+)
+
+// maxDatagram the largest datagram read from a unixgram socket
+const maxDatagram = 64 * 1024
+
+// FollowedSocket a unix domain socket that gotail listens on so that
+// applications logging to a local socket can be followed, or a socket of any
+// family inherited already listening. Stream sockets accept any number of
+// connections and datagram sockets treat each datagram as one or more lines.
+type FollowedSocket struct {
+	Name     string // the unix:// or unixgram:// source as given
+	Address  string // the socket file, empty for inherited sockets
+	Source   *config.Source
+	Format   Format
+	Metrics  *metrics.Source
+	listener net.Listener   // set for stream sockets
+	packets  net.PacketConn // set for datagram sockets
+	mutex    sync.Mutex
+	conns    map[net.Conn]bool // open stream connections
+	stopped  bool              // set by Stop so no more connections are read
+	stop     chan struct{}     // closed by Stop
+	wg       sync.WaitGroup    // readers of the socket and its connections
+	done     chan struct{}     // closed when all lines have been sent for printing
+}
+
+// NewFollowedSocket listen on the socket for a unix:// or unixgram:// source
+// and print lines as they arrive. A socket file left from an earlier run is
+// replaced.
+func NewFollowedSocket(name string) (fs *FollowedSocket, err error) {
+	network, address, _ := input.SocketAddress(name)
+
+	fs = newFollowedSocket(name)
+	fs.Address = address
+
+	err = input.RemoveStaleSocket(address)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unixgram" {
+		fs.packets, err = net.ListenPacket(network, address)
+	} else {
+		fs.listener, err = net.Listen(network, address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fs.start()
+
+	return
+}
+
+// NewInheritedSocket print lines from a socket inherited from the parent
+// process already listening, as socket activation passes them. It may be a
+// stream or datagram socket of any family, and has no socket file to remove.
+func NewInheritedSocket(name string, file *os.File) (fs *FollowedSocket, err error) {
+	fs = newFollowedSocket(name)
+
+	// Both copy the descriptor, so the file is closed either way
+	defer file.Close()
+	listener, err := net.FileListener(file)
+	if err == nil && listener.Addr().Network() != "unixgram" {
+		fs.listener = listener
+	} else {
+		if listener != nil {
+			listener.Close()
+		}
+		if fs.packets, err = net.FilePacketConn(file); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	fs.start()
+
+	return
+}
+
+// newFollowedSocket get a socket source named name, not yet listened on
+func newFollowedSocket(name string) *FollowedSocket {
+	return &FollowedSocket{
+		Name:    name,
+		Source:  config.ForPath(name),
+		Format:  FormatFor(nil),
+		Metrics: metrics.For(name),
+		conns:   map[net.Conn]bool{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// start read the socket, printing lines as they arrive
+func (fs *FollowedSocket) start() {
+	fs.wg.Add(1)
+	if fs.packets != nil {
+		go fs.readPackets()
+	} else {
+		go fs.accept()
+	}
+
+	fs.Metrics.SetUp(true)
+	go func() {
+		fs.wg.Wait()
+		fs.Metrics.SetUp(false)
+		close(fs.done)
+	}()
+}
+
+// printLine print a line read from the socket
+func (fs *FollowedSocket) printLine(text string) {
+	output, err := GetOutput(fs.Name, fs.Source, fs.Format, text)
+	fs.Metrics.Line(len(text), err == nil)
+	if err != nil {
+		return
+	}
+	outputPrinter.print(fs.Name, output)
+}
+
+// accept read lines from stream connections until the listener is closed
+func (fs *FollowedSocket) accept() {
+	defer fs.wg.Done()
+	for {
+		conn, err := fs.listener.Accept()
+		if err != nil {
+			return
+		}
+		fs.mutex.Lock()
+		if fs.stopped {
+			fs.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		fs.conns[conn] = true
+		fs.mutex.Unlock()
+
+		fs.wg.Add(1)
+		go fs.read(conn)
+	}
+}
+
+// read print lines from a stream connection until it is closed
+func (fs *FollowedSocket) read(conn net.Conn) {
+	defer fs.wg.Done()
+	defer func() {
+		fs.mutex.Lock()
+		delete(fs.conns, conn)
+		fs.mutex.Unlock()
+		conn.Close()
+	}()
+
+	reader, err := input.Decompress(conn, fs.Source.Compression)
+	if err != nil {
+		outputPrinter.print(fs.Name, Colour(BrightRed, err.Error()))
+		return
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	scanner := input.NewScanner(fs.Name, fs.Source.NewReader(reader))
+	supervise(fs.Name, fs.Metrics, fs.stop, func() error {
+		for scanner.Scan() {
+			fs.printLine(scanner.Text())
+		}
+		return nil
+	})
+}
+
+// readPackets print the lines in each datagram until the socket is closed
+func (fs *FollowedSocket) readPackets() {
+	defer fs.wg.Done()
+	buf := make([]byte, maxDatagram)
+	supervise(fs.Name, fs.Metrics, fs.stop, func() error {
+		for {
+			n, _, err := fs.packets.ReadFrom(buf)
+			if err != nil {
+				return nil
+			}
+			for _, line := range datagramLines(fs.Source, buf[:n]) {
+				fs.printLine(line)
+			}
+		}
+	})
+}
+
+// datagramLines split a datagram from source into lines. A trailing newline
+// does not start another line.
+func datagramLines(source *config.Source, datagram []byte) (lines []string) {
+	if source.IsUTF16() {
+		datagram, _ = io.ReadAll(source.NewReader(bytes.NewReader(datagram)))
+	}
+	datagram = bytes.TrimSuffix(datagram, []byte("\n"))
+	for _, line := range bytes.Split(datagram, []byte("\n")) {
+		lines = append(lines, string(bytes.TrimSuffix(line, []byte("\r"))))
+	}
+
+	return
+}
+
+// Stop close the socket and its connections, wait for lines already read to be
+// sent for printing, and remove the socket file.
+func (fs *FollowedSocket) Stop() (err error) {
+	var closer io.Closer = fs.listener
+	if fs.packets != nil {
+		closer = fs.packets
+	}
+	closer.Close()
+
+	fs.mutex.Lock()
+	if !fs.stopped {
+		fs.stopped = true
+		close(fs.stop)
+	}
+	for conn := range fs.conns {
+		conn.Close()
+	}
+	fs.mutex.Unlock()
+	<-fs.done
+
+	if fs.Address == "" {
+		return
+	}
+	err = os.Remove(fs.Address)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+
+	return
+}
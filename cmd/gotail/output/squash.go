@@ -0,0 +1,98 @@
+package output
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/imarsman/gotail/internal/util"
+)
+
+/*
+	With --squash-repeats a followed line that is the same as the line before
+	it from the same source is counted rather than printed, as uniq -c does.
+	Once a different line comes from the source, or no repeat has come for the
+	squash timeout, a note of how many times the line was repeated is printed.
+	A line that comes again after its note is printed again.
+*/
+
+// repeat the last line printed from a source and how many times it has
+// been repeated since
+type repeat struct {
+	line  string
+	count int
+	last  time.Time // when the last repeat came
+}
+
+// squasher the last line printed from each source. Only the printer goroutine
+// uses it.
+type squasher struct {
+	timeout time.Duration
+	last    map[string]*repeat
+}
+
+// SetSquashRepeats count followed lines that repeat the line before them from
+// the same source instead of printing them, noting the count when a different
+// line comes or no repeat has come for timeout. It must be called before any
+// lines are followed.
+func SetSquashRepeats(timeout time.Duration) {
+	outputPrinter.squash = &squasher{timeout: timeout, last: make(map[string]*repeat)}
+
+	// Ask the printer to note repeats that have waited long enough
+	go func() {
+		ticker := time.NewTicker(timeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				select {
+				case outputPrinter.expire <- struct{}{}:
+				case <-outputPrinter.done:
+					return
+				}
+			case <-outputPrinter.done:
+				return
+			}
+		}
+	}()
+}
+
+// add count m if it repeats the last line from its source. Otherwise it is
+// kept as the last line, with a note for the repeats of the line before it.
+func (s *squasher) add(m msg, now time.Time) (repeated bool, notes []msg) {
+	r, ok := s.last[m.path]
+	if ok && r.line == m.line {
+		r.count++
+		r.last = now
+		return true, nil
+	}
+	if ok && r.count > 0 {
+		notes = append(notes, s.note(m.path, r))
+	}
+	s.last[m.path] = &repeat{line: m.line}
+
+	return
+}
+
+// expired get notes for repeats that have waited the timeout or, with flush
+// set, for all repeats, forgetting the lines repeated
+func (s *squasher) expired(now time.Time, flush bool) (notes []msg) {
+	paths := make([]string, 0, len(s.last))
+	for path, r := range s.last {
+		if r.count > 0 && (flush || now.Sub(r.last) >= s.timeout) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		notes = append(notes, s.note(path, s.last[path]))
+		delete(s.last, path)
+	}
+
+	return
+}
+
+// note get the note for the repeats of r from path
+func (s *squasher) note(path string, r *repeat) msg {
+	return msg{path: path, line: fmt.Sprintf("… repeated %d %s", r.count, util.Pluralize("time", "times", r.count))}
+}
@@ -0,0 +1,89 @@
+package output
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// stickyHeader a line kept at the top or bottom of the terminal showing the
+// source of the lines being printed. Lines scroll in the rest of the terminal
+// so the header stays in place however fast output arrives.
+type stickyHeader struct {
+	top  bool
+	fd   int
+	rows int
+	cols int
+	path string
+}
+
+// SetStickyHeader keep a header at the "top" or "bottom" of the terminal
+// showing the source of the lines being printed. Nothing is done if standard
+// output is not a terminal. Must be called before lines are printed.
+func SetStickyHeader(position string) error {
+	if position != "top" && position != "bottom" {
+		return fmt.Errorf("invalid sticky header position %q, expected top or bottom", position)
+	}
+	fd := int(os.Stdout.Fd())
+	if !term.IsTerminal(fd) {
+		return nil
+	}
+	h := &stickyHeader{top: position == "top", fd: fd}
+	os.Stdout.Write(h.draw(""))
+	outputPrinter.sticky = h
+
+	return nil
+}
+
+// headerRow the terminal row the header is drawn on
+func (h *stickyHeader) headerRow() int {
+	if h.top {
+		return 1
+	}
+	return h.rows
+}
+
+// region get the escape sequence limiting scrolling to the rows other than the
+// header and moving the cursor into them
+func (h *stickyHeader) region() string {
+	if h.top {
+		return fmt.Sprintf("\x1b[2;%dr\x1b[%d;1H", h.rows, h.rows)
+	}
+	return fmt.Sprintf("\x1b[1;%dr\x1b[%d;1H", h.rows-1, h.rows-1)
+}
+
+// draw get the escape sequences drawing the header for path. The scrolling
+// region is set again if the terminal has been resized.
+func (h *stickyHeader) draw(path string) (b []byte) {
+	h.path = path
+	cols, rows, err := term.GetSize(h.fd)
+	if err == nil && rows > 2 && (rows != h.rows || cols != h.cols) {
+		h.rows, h.cols = rows, cols
+		b = append(b, h.region()...)
+	}
+	if h.rows == 0 {
+		return
+	}
+
+	text := " gotail"
+	if path != "" {
+		text = " ==> " + path + " <=="
+	}
+	if len(text) > h.cols {
+		text = text[:h.cols]
+	}
+	// Save the cursor, draw the header in reverse video, and restore the cursor
+	b = append(b, fmt.Sprintf("\x1b7\x1b[%d;1H\x1b[2K\x1b[7m%-*s\x1b[0m\x1b8", h.headerRow(), h.cols, text)...)
+
+	return
+}
+
+// reset get the escape sequences restoring normal scrolling and clearing the
+// header
+func (h *stickyHeader) reset() string {
+	if h.rows == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\x1b7\x1b[%d;1H\x1b[2K\x1b8\x1b[r\x1b[%d;1H", h.headerRow(), h.rows)
+}
@@ -0,0 +1,234 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/imarsman/gotail/cmd/gotail/metrics"
+)
+
+/*
+	With --stream the lines printed while following are also served as
+	server-sent events at /lines on the --metrics-addr server, to the clients
+	allowed to fetch metrics. The data of each event is a JSON object like those
+	of --output ndjson. With --stream-replay N the last N lines are kept and
+	sent to each new subscriber before live lines, so that connecting late
+	still gives some context. ?file=PATH subscribes to the lines of one source,
+	and ?replay=N asks for fewer of the lines kept. A subscriber that can't
+	keep up is disconnected rather than holding up printing.
+
+	Lines from files are anchored by where they start, as PATH:OFFSET, which is
+	given as the id of their event. A subscriber that reconnects with the id of
+	the last event it got, as browsers do, is sent the kept lines after it, and
+	?from=PATH:OFFSET starts at the kept line with that anchor so that a link
+	can open a stream at the line someone wants to share.
+*/
+
+// streamBuffer how many lines can wait to be sent to a subscriber before it
+// is disconnected
+const streamBuffer = 1024
+
+// subscriber a client being sent lines
+type subscriber struct {
+	file  string // only send lines from this source if set
+	lines chan msg
+}
+
+// streamer the lines kept for replay and the subscribers to send lines to
+type streamer struct {
+	mutex       sync.Mutex
+	replay      int         // the most lines sent to a new subscriber
+	history     *ringBuffer // nil if no lines are kept
+	subscribers map[*subscriber]bool
+}
+
+// stream set with SetStream, nil if lines aren't streamed
+var stream *streamer
+
+// SetStream serve followed lines at /lines on the metrics server, keeping the
+// last replay lines to send to new subscribers. It must be called before the
+// metrics server is started and before any lines are followed.
+func SetStream(replay int) {
+	stream = &streamer{replay: replay, subscribers: map[*subscriber]bool{}}
+	if replay > 0 {
+		stream.history = &ringBuffer{lines: make([]msg, replay)}
+	}
+	metrics.Handle("/lines", stream.serve)
+}
+
+// publish send m to the subscribers for its source and keep it for replay
+func (s *streamer) publish(m msg) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.history != nil {
+		s.history.add(m)
+	}
+	for sub := range s.subscribers {
+		if sub.file != "" && sub.file != m.path {
+			continue
+		}
+		select {
+		case sub.lines <- m:
+		default:
+			close(sub.lines)
+			delete(s.subscribers, sub)
+		}
+	}
+}
+
+// subscribe add a subscriber to the lines of file, or of every source if file
+// is empty, getting the lines kept for it that pick chooses to send first. No
+// line is both sent first and sent live, or neither.
+func (s *streamer) subscribe(file string, pick func(kept []msg) []msg) (sub *subscriber, history []msg) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var kept []msg
+	if s.history != nil {
+		for _, m := range s.history.snapshot() {
+			if file == "" || m.path == file {
+				kept = append(kept, m)
+			}
+		}
+	}
+	history = pick(kept)
+	sub = &subscriber{file: file, lines: make(chan msg, streamBuffer)}
+	s.subscribers[sub] = true
+
+	return
+}
+
+// unsubscribe stop sending lines to sub
+func (s *streamer) unsubscribe(sub *subscriber) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.subscribers[sub] {
+		close(sub.lines)
+		delete(s.subscribers, sub)
+	}
+}
+
+// close end every subscription
+func (s *streamer) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for sub := range s.subscribers {
+		close(sub.lines)
+		delete(s.subscribers, sub)
+	}
+}
+
+// anchorIndex get the index of the line in lines with anchor, or -1 if none
+// has it
+func anchorIndex(lines []msg, anchor string) int {
+	for i, m := range lines {
+		if m.anchor == anchor {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// serve send lines to a subscriber as server-sent events until it goes away
+// or the lines end
+func (s *streamer) serve(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	query := r.URL.Query()
+	replay := s.replay
+	if value := query.Get("replay"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid replay count", http.StatusBadRequest)
+			return
+		}
+		if n < replay {
+			replay = n
+		}
+	}
+	from := query.Get("from")
+	lastID := r.Header.Get("Last-Event-ID")
+	var missing bool
+	sub, history := s.subscribe(query.Get("file"), func(kept []msg) []msg {
+		switch {
+		case from != "":
+			if i := anchorIndex(kept, from); i >= 0 {
+				return kept[i:]
+			}
+			missing = true
+			return nil
+		case lastID != "":
+			if i := anchorIndex(kept, lastID); i >= 0 {
+				return kept[i+1:]
+			}
+		}
+		if len(kept) > replay {
+			return kept[len(kept)-replay:]
+		}
+		return kept
+	})
+	defer s.unsubscribe(sub)
+	if missing {
+		http.Error(w, "the line at "+from+" is no longer kept", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	for _, m := range history {
+		if writeEvent(w, m) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+	for {
+		select {
+		case m, ok := <-sub.lines:
+			if !ok || writeEvent(w, m) != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent write a line as an event whose data is a JSON object like those
+// of --output ndjson, without colour, and whose id is its anchor
+func writeEvent(w io.Writer, m msg) error {
+	data := m.line
+	if !Records() {
+		b, err := json.Marshal(record{File: m.path, LineNumber: m.number, Text: reEscape.ReplaceAllString(m.line, ""), Anchor: m.anchor})
+		if err != nil {
+			return err
+		}
+		data = string(b)
+	}
+	if m.anchor != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", m.anchor); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "data: %s\n\n", data)
+
+	return err
+}
+
+// stopStream end the subscriptions to streamed lines
+func stopStream() {
+	if stream != nil {
+		stream.close()
+	}
+}
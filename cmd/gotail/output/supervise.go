@@ -0,0 +1,78 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/imarsman/gotail/cmd/gotail/metrics"
+)
+
+/*
+	Each source is read in goroutines of its own. A reader that panics, or a
+	followed file whose tail ends with an error, is restarted rather than
+	taking down gotail or quietly dropping out of a long follow. The wait
+	before a restart doubles with each failure in a row up to a limit, so a
+	source that keeps failing doesn't spin, and starts again from the shortest
+	once a run has gone for a while without failing. Restarts are reported on
+	stderr and counted for the source.
+*/
+
+const (
+	restartDelay    = 100 * time.Millisecond // wait before the first restart
+	maxRestartDelay = 30 * time.Second       // longest wait between restarts
+	restartReset    = time.Minute            // run after which failures are forgotten
+)
+
+// restartWait get the wait before restarting a reader that has failed
+// failures times in a row
+func restartWait(failures int) time.Duration {
+	wait := restartDelay
+	for i := 1; i < failures && wait < maxRestartDelay; i++ {
+		wait *= 2
+	}
+	if wait > maxRestartDelay {
+		wait = maxRestartDelay
+	}
+
+	return wait
+}
+
+// supervise run read until it returns nil or stop is closed, restarting it
+// after a wait when it panics or returns an error. A nil stop is never closed.
+func supervise(name string, m *metrics.Source, stop <-chan struct{}, read func() error) {
+	var failures int
+	for {
+		started := time.Now()
+		err := recovered(read)
+		if err == nil {
+			return
+		}
+		if time.Since(started) >= restartReset {
+			failures = 0
+		}
+		failures++
+		wait := restartWait(failures)
+		m.Restart()
+		fmt.Fprintln(os.Stderr, Colour(BrightRed, fmt.Sprintf("Reading %s failed, restarting in %s: %v", name, wait, err)))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// recovered run read, getting a panic in it as an error
+func recovered(read func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return read()
+}
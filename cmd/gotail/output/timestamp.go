@@ -0,0 +1,170 @@
+package output
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/imarsman/gotail/internal/config"
+)
+
+/*
+	A line's timestamp is found by parsers tried in order: the source's time
+	format from the config file, a JSON time field, then timestamps in common
+	layouts anywhere in the line. A source's lines nearly always have their
+	timestamps in the same form, so the parser that found the last one is
+	tried first for the next line from the source and the rest only if it
+	fails. The timestamp is kept with the line so that --since, --until,
+	--check-order, and records find it once between them.
+*/
+
+// timeParser find the timestamp in a line from source. Timestamps without a
+// time zone are taken as local time.
+type timeParser func(source *config.Source, text string) (time.Time, bool)
+
+// timestampFields JSON fields commonly holding a line's timestamp
+var timestampFields = []string{"time", "ts", "timestamp", "@timestamp"}
+
+// timestampLayouts common timestamp layouts and patterns finding them
+var timestampLayouts = []struct {
+	re     *regexp.Regexp
+	layout string
+}{
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})`), time.RFC3339Nano},
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?`), "2006-01-02T15:04:05.999999999"},
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}`), "2006-01-02 15:04:05"},
+	{regexp.MustCompile(`\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`), "02/Jan/2006:15:04:05 -0700"},
+	{regexp.MustCompile(`^[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}`), time.Stamp},
+}
+
+// timeParsers the parsers tried for a line, in order
+var timeParsers = append([]timeParser{formatTime, jsonFieldTime}, layoutParsers()...)
+
+// layoutParsers get a parser for each common timestamp layout
+func layoutParsers() (parsers []timeParser) {
+	for _, l := range timestampLayouts {
+		re, layout := l.re, l.layout
+		parsers = append(parsers, func(source *config.Source, text string) (t time.Time, ok bool) {
+			match := re.FindString(text)
+			if match == "" {
+				return
+			}
+			t, err := time.ParseInLocation(layout, match, time.Local)
+			if err != nil {
+				return
+			}
+			// Syslog timestamps have no year
+			if t.Year() == 0 {
+				t = t.AddDate(time.Now().Year(), 0, 0)
+			}
+			return t, true
+		})
+	}
+
+	return
+}
+
+// formatTime parse the timestamp starting a line with the source's time format
+func formatTime(source *config.Source, text string) (time.Time, bool) {
+	if source.TimeFormat == "" {
+		return time.Time{}, false
+	}
+
+	return config.ParseTime(source.TimeFormat, text, time.Local)
+}
+
+// jsonFieldTime get the timestamp in a JSON time field of a line
+func jsonFieldTime(source *config.Source, text string) (t time.Time, ok bool) {
+	found, jl := getContent(text)
+	if !found {
+		return
+	}
+	var obj map[string]interface{}
+	if json.Unmarshal([]byte(jl.json), &obj) != nil {
+		return
+	}
+	for _, field := range timestampFields {
+		if t, ok := jsonTime(obj[field]); ok {
+			return t, true
+		}
+	}
+
+	return
+}
+
+// jsonTime get a time from an RFC 3339 string or a number of seconds or
+// milliseconds since the epoch
+func jsonTime(value interface{}) (t time.Time, ok bool) {
+	switch v := value.(type) {
+	case string:
+		if t, err := time.ParseInLocation(time.RFC3339Nano, v, time.Local); err == nil {
+			return t, true
+		}
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return jsonTime(f)
+		}
+	case float64:
+		// Numbers this large are milliseconds
+		if v > 1e11 {
+			v /= 1000
+		}
+		sec := int64(v)
+		return time.Unix(sec, int64((v-float64(sec))*1e9)), true
+	}
+
+	return
+}
+
+// parsedTime the timestamp found in a line's text
+type parsedTime struct {
+	text string // the text it was found in
+	done bool   // whether the text has been parsed
+	t    time.Time
+	ok   bool
+}
+
+var (
+	lastParsers      = map[string]int{} // index of the parser that last found a timestamp, by path
+	lastParsersMutex sync.Mutex
+)
+
+// timestamp get the timestamp of the line, parsing it only if the line's text
+// has changed since it was last found
+func (l *Line) timestamp() (time.Time, bool) {
+	if l.parsed.done && l.parsed.text == l.Text {
+		return l.parsed.t, l.parsed.ok
+	}
+	t, ok := sourceTime(l.Path, l.Source, l.Text)
+	l.parsed = parsedTime{text: l.Text, done: true, t: t, ok: ok}
+
+	return t, ok
+}
+
+// sourceTime get the timestamp of a line from path, trying the parser that
+// found the last one from path first
+func sourceTime(path string, source *config.Source, text string) (t time.Time, ok bool) {
+	lastParsersMutex.Lock()
+	last, seen := lastParsers[path]
+	lastParsersMutex.Unlock()
+	if seen {
+		if t, ok = timeParsers[last](source, text); ok {
+			return
+		}
+	}
+
+	for i, parse := range timeParsers {
+		if seen && i == last {
+			continue
+		}
+		if t, ok = parse(source, text); ok {
+			lastParsersMutex.Lock()
+			lastParsers[path] = i
+			lastParsersMutex.Unlock()
+			return
+		}
+	}
+
+	return
+}
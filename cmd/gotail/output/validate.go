@@ -0,0 +1,85 @@
+package output
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// counts of lines checked by ValidateStage and of those without valid JSON
+var validated, invalid uint64
+
+// jsonPayload get the JSON a line is expected to hold. A line starting with
+// JSON is all payload; otherwise, as with a timestamp or level before it, the
+// payload starts at the first opening brace.
+func jsonPayload(text string) (payload string, ok bool) {
+	trimmed := strings.TrimSpace(text)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		return trimmed, true
+	}
+	if i := strings.IndexByte(trimmed, '{'); i >= 0 {
+		return trimmed[i:], true
+	}
+
+	return "", false
+}
+
+// jsonError get why payload isn't valid JSON, or nil if it is
+func jsonError(payload string) error {
+	if json.Valid([]byte(payload)) {
+		return nil
+	}
+	var v json.RawMessage
+	err := json.Unmarshal([]byte(payload), &v)
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return fmt.Errorf("%v at offset %d", syntaxErr, syntaxErr.Offset)
+	}
+	if err == nil {
+		// Valid rejects what Unmarshal accepts only in unusual cases
+		err = errors.New("invalid JSON")
+	}
+
+	return err
+}
+
+// ValidateStage keep only lines without valid JSON, in place of which is where
+// the line is and why it isn't valid. When lines are written as JSON objects
+// the line is kept and the reason given as its note.
+func ValidateStage(records bool) Stage {
+	return func(line *Line) bool {
+		// Blank lines, such as between records, hold nothing to check
+		if strings.TrimSpace(line.Text) == "" {
+			return false
+		}
+		atomic.AddUint64(&validated, 1)
+		payload, ok := jsonPayload(line.Text)
+		var err error
+		if !ok {
+			err = errors.New("no JSON found")
+		} else if err = jsonError(payload); err == nil {
+			return false
+		}
+		atomic.AddUint64(&invalid, 1)
+
+		if records {
+			line.Flag("invalid JSON: " + err.Error())
+			return true
+		}
+		where := SourceName(line.Path)
+		if line.Number > 0 {
+			where = fmt.Sprintf("%s:%d", where, line.Number)
+		}
+		line.Text = where + ": invalid JSON: " + err.Error()
+
+		return true
+	}
+}
+
+// ValidationCounts get the number of lines checked by ValidateStage and the
+// number of those without valid JSON
+func ValidationCounts() (checked, failed uint64) {
+	return atomic.LoadUint64(&validated), atomic.LoadUint64(&invalid)
+}
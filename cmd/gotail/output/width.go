@@ -0,0 +1,52 @@
+package output
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// ellipsis ends lines cut by TruncateStage
+const ellipsis = "…"
+
+// TruncateStage cut lines longer than width characters, ending them with an
+// ellipsis so that it is clear they were cut
+func TruncateStage(width int) Stage {
+	return func(line *Line) bool {
+		if utf8.RuneCountInString(line.Text) <= width {
+			return true
+		}
+		var n, i int
+		for i = range line.Text {
+			if n == width-1 {
+				break
+			}
+			n++
+		}
+		line.Text = line.Text[:i] + ellipsis
+
+		return true
+	}
+}
+
+// WrapStage break lines longer than width characters onto as many lines as
+// they need
+func WrapStage(width int) Stage {
+	return func(line *Line) bool {
+		if utf8.RuneCountInString(line.Text) <= width {
+			return true
+		}
+		var sb strings.Builder
+		var n int
+		for _, r := range line.Text {
+			if n == width {
+				sb.WriteByte('\n')
+				n = 0
+			}
+			sb.WriteRune(r)
+			n++
+		}
+		line.Text = sb.String()
+
+		return true
+	}
+}
@@ -0,0 +1,163 @@
+package output
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imarsman/gotail/cmd/gotail/metrics"
+	"github.com/imarsman/gotail/internal/util"
+)
+
+// topMatches the number of most frequent matches shown in a summary
+const topMatches = 5
+
+// errorRe finds error levels in lines of any format
+var errorRe = regexp.MustCompile(`(?i)\b(error|err|fatal|panic|critical|crit)\b`)
+
+// windowStats counts for lines printed since the last summary
+type windowStats struct {
+	mutex   sync.Mutex
+	errors  map[string]int // error lines by path
+	matches map[string]int // text matched by --match
+	match   *regexp.Regexp
+	stop    chan struct{} // closed to stop printing summaries
+	done    chan struct{} // closed once summaries have stopped
+}
+
+// window the counts for the current summary window, if summaries are printed
+var window *windowStats
+
+// stage count errors and matches
+func (w *windowStats) stage(line *Line) bool {
+	isError := errorRe.MatchString(line.Text)
+	var matched string
+	if w.match != nil {
+		matched = w.match.FindString(line.Text)
+	}
+
+	w.mutex.Lock()
+	if isError {
+		w.errors[line.Path]++
+	}
+	if matched != "" {
+		// Text not yet counted is left out if there is no memory for it
+		if _, ok := w.matches[matched]; ok || budget.take(len(matched)) {
+			w.matches[matched]++
+		} else {
+			metrics.For(line.Path).Shed(len(matched))
+		}
+	}
+	w.mutex.Unlock()
+
+	return true
+}
+
+// reset get the counts for the window and start a new one
+func (w *windowStats) reset() (errors, matches map[string]int) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	errors, matches = w.errors, w.matches
+	w.errors, w.matches = map[string]int{}, map[string]int{}
+	for text := range matches {
+		budget.give(len(text))
+	}
+
+	return
+}
+
+// StartSummaries print a summary between followed lines every interval, with
+// lines per second and errors for each source and the text most often matched
+// by --match. It must be called before any lines are processed.
+func StartSummaries(every time.Duration, match *regexp.Regexp) {
+	window = &windowStats{errors: map[string]int{}, matches: map[string]int{}, match: match}
+	window.stop = make(chan struct{})
+	window.done = make(chan struct{})
+
+	go func() {
+		defer close(window.done)
+
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		previous := map[string]uint64{}
+		for {
+			select {
+			case <-window.stop:
+				return
+			case <-ticker.C:
+			}
+			lines, lags := map[string]uint64{}, map[string]int64{}
+			metrics.Each(func(name string, s *metrics.Source) {
+				lines[name] = s.Lines() - previous[name]
+				previous[name] = s.Lines()
+				if lag, ok := lagFor(name, s); ok {
+					lags[name] = lag
+				}
+			})
+			errors, matches := window.reset()
+			outputPrinter.printBlock(summarize(every, lines, lags, errors, matches))
+		}
+	}()
+}
+
+// stopSummaries stop printing summaries and wait for one being printed
+func stopSummaries() {
+	if window == nil {
+		return
+	}
+	close(window.stop)
+	<-window.done
+}
+
+// summarize format the summary of a window. Sources with unread bytes are
+// said to be behind by them, which shows when gotail can't keep up.
+func summarize(every time.Duration, lines map[string]uint64, lags map[string]int64, errors, matches map[string]int) string {
+	var sb strings.Builder
+	sb.WriteString(Colour(BrightBlue, fmt.Sprintf("==> summary of the last %s <==", every)))
+	sb.WriteByte('\n')
+
+	names := make([]string, 0, len(lines))
+	for name := range lines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		line := fmt.Sprintf("%s: %.1f lines/s", SourceName(name), float64(lines[name])/every.Seconds())
+		if lags[name] > 0 {
+			line += ", " + util.FormatSize(lags[name]) + " behind"
+		}
+		if errors[name] > 0 {
+			line = Colour(BrightRed, fmt.Sprintf("%s, %d %s", line, errors[name], util.Pluralize("error", "errors", errors[name])))
+		}
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+
+	if len(matches) > 0 {
+		matched := make([]string, 0, len(matches))
+		for text := range matches {
+			matched = append(matched, text)
+		}
+		sort.Slice(matched, func(i, j int) bool {
+			if matches[matched[i]] != matches[matched[j]] {
+				return matches[matched[i]] > matches[matched[j]]
+			}
+			return matched[i] < matched[j]
+		})
+		if len(matched) > topMatches {
+			matched = matched[:topMatches]
+		}
+		top := make([]string, 0, len(matched))
+		for _, text := range matched {
+			top = append(top, fmt.Sprintf("%q %d", text, matches[text]))
+		}
+		sb.WriteString("top matches: " + strings.Join(top, ", "))
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
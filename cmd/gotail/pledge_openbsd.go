@@ -0,0 +1,19 @@
+//go:build openbsd
+// +build openbsd
+
+package main
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// restrict pledge to reading files, using sockets, and ending commands. cpath
+// is kept so that socket files can be removed on exit, and wpath if files are
+// written while following.
+func restrict(writable []string) error {
+	promises := "stdio rpath cpath inet unix dns proc"
+	if len(writable) > 0 {
+		promises += " wpath"
+	}
+	return unix.Pledge(promises, "")
+}
@@ -0,0 +1,10 @@
+//go:build !windows && !openbsd && !linux
+// +build !windows,!openbsd,!linux
+
+package main
+
+// restrict nothing more is done where neither pledge nor landlock is
+// available
+func restrict(writable []string) error {
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/imarsman/gotail/cmd/gotail/output"
+	"github.com/imarsman/gotail/internal/config"
+	"github.com/imarsman/gotail/internal/input"
+)
+
+/*
+	Files such as those under /proc and /sys report a size of 0 and change
+	without fsnotify events, so following them finds nothing. With
+	--watch-interval they are instead read in full every interval and printed
+	under a header giving the time, as watch cat would. With --watch-diff only
+	the lines that changed since the last read are printed, the old ones
+	prefixed with - and the new with +.
+*/
+
+// maxDiffCells the largest table of old by new lines compared for a diff. Past
+// it all old lines are given as removed and all new ones as added.
+const maxDiffCells = 4 * 1024 * 1024
+
+// readAll read every line of the file at path, which is read to its end
+// whatever size it reports
+func readAll(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := input.NewScanner(path, config.ForPath(path).NewReader(f))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return lines, nil
+}
+
+// diffLines get the lines of old missing from new prefixed with - and those of
+// new missing from old prefixed with +, in the order they appear
+func diffLines(old, new []string) []string {
+	var changed []string
+	if len(old)*len(new) > maxDiffCells {
+		for _, line := range old {
+			changed = append(changed, "-"+line)
+		}
+		for _, line := range new {
+			changed = append(changed, "+"+line)
+		}
+		return changed
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of old[i:] and
+	// new[j:]
+	lcs := make([][]int, len(old)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if old[i] == new[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var i, j int
+	for i < len(old) && j < len(new) {
+		switch {
+		case old[i] == new[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			changed = append(changed, "-"+old[i])
+			i++
+		default:
+			changed = append(changed, "+"+new[j])
+			j++
+		}
+	}
+	for ; i < len(old); i++ {
+		changed = append(changed, "-"+old[i])
+	}
+	for ; j < len(new); j++ {
+		changed = append(changed, "+"+new[j])
+	}
+
+	return changed
+}
+
+// watchFiles read each file and print its lines, or with diff the lines
+// changed since the last read, which are kept in last
+func watchFiles(w *bufio.Writer, paths []string, diff bool, last map[string][]string, now time.Time) {
+	for _, path := range paths {
+		lines, err := readAll(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, err.Error()))
+			continue
+		}
+		previous, seen := last[path]
+		last[path] = lines
+		if diff && seen {
+			lines = diffLines(previous, lines)
+			if len(lines) == 0 {
+				continue
+			}
+		}
+
+		if !output.Records() {
+			name := output.SourceName(path)
+			fmt.Fprintln(w, output.Colour(output.HeaderColour(path), fmt.Sprintf("==> %s - %s <==", name, now.Format("15:04:05"))))
+		}
+		output.WriteLines(w, path, lines)
+		w.Flush()
+	}
+}
+
+// runWatch print the files matching patterns every interval until interrupted
+func runWatch(w *bufio.Writer, patterns []string, interval time.Duration, diff bool) error {
+	paths, err := expandGlobs(patterns)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no files to watch")
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := make(map[string][]string, len(paths))
+	watchFiles(w, paths, diff, last, time.Now())
+	for {
+		select {
+		case <-c:
+			return nil
+		case now := <-ticker.C:
+			watchFiles(w, paths, diff, last, now)
+		}
+	}
+}
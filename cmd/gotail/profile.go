@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/imarsman/gotail/cmd/internal/args"
+	"github.com/imarsman/gotail/internal/config"
+)
+
+// applyProfile use the settings of the named config profile for flags that
+// were not given. Sources in the profile are used only if none were given.
+func applyProfile(name string) error {
+	p, err := config.Current.Profile(name)
+	if err != nil {
+		return err
+	}
+
+	if p.Format != "" && args.Args.FormatHint == "auto" {
+		args.Args.FormatHint = p.Format
+	}
+	if p.Match != "" && args.Args.Match == "" {
+		args.Args.Match = p.Match
+	}
+	if p.JSON {
+		args.Args.JSON = true
+	}
+	if p.JSONOnly {
+		args.Args.JSONOnly = true
+	}
+	if len(args.Args.HashFields) == 0 {
+		args.Args.HashFields = p.HashFields
+	}
+	if args.Args.HashKey == "" {
+		args.Args.HashKey = p.HashKey
+	}
+	if len(args.Args.Files)+len(args.Args.Commands)+len(args.Args.Containers) == 0 {
+		args.Args.Files = p.Files
+		args.Args.Commands = p.Commands
+	}
+
+	return nil
+}
+
+// predictProfiles predict profile names from the config file
+func predictProfiles(prefix string) []string {
+	if config.Init(args.Args.Config) != nil {
+		return nil
+	}
+
+	return config.Current.ProfileNames()
+}
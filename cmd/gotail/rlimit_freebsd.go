@@ -0,0 +1,25 @@
+//go:build freebsd
+// +build freebsd
+
+package main
+
+import (
+	"syscall"
+)
+
+// FreeBSD uses signed limits where RLIM_INFINITY is the largest int64
+
+// rlimitCur get the soft limit
+func rlimitCur(rLimit *syscall.Rlimit) uint64 {
+	return uint64(rLimit.Cur)
+}
+
+// rlimitMax get the hard limit
+func rlimitMax(rLimit *syscall.Rlimit) uint64 {
+	return uint64(rLimit.Max)
+}
+
+// setRlimitCur set the soft limit
+func setRlimitCur(rLimit *syscall.Rlimit, limit uint64) {
+	rLimit.Cur = int64(limit)
+}
@@ -0,0 +1,23 @@
+//go:build !windows && !freebsd
+// +build !windows,!freebsd
+
+package main
+
+import (
+	"syscall"
+)
+
+// rlimitCur get the soft limit
+func rlimitCur(rLimit *syscall.Rlimit) uint64 {
+	return rLimit.Cur
+}
+
+// rlimitMax get the hard limit
+func rlimitMax(rLimit *syscall.Rlimit) uint64 {
+	return rLimit.Max
+}
+
+// setRlimitCur set the soft limit
+func setRlimitCur(rLimit *syscall.Rlimit, limit uint64) {
+	rLimit.Cur = limit
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/imarsman/gotail/cmd/internal/args"
+)
+
+// sandboxWritable get the directories gotail writes to while following, which
+// are left writable where the platform can limit writes to given directories
+func sandboxWritable() (dirs []string) {
+	if args.Args.Ring > 0 {
+		dirs = append(dirs, args.Args.RingDir)
+	}
+	if args.Args.ForwardQueue != "" {
+		dirs = append(dirs, filepath.Dir(args.Args.ForwardQueue))
+	}
+
+	return
+}
@@ -0,0 +1,45 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// dropPrivileges switch to the named user and its group, clearing
+// supplementary groups, then restrict the process further where the platform
+// allows, leaving writable the directories given. Files already open stay
+// readable.
+func dropPrivileges(name string, writable []string) (err error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return
+	}
+
+	// The group must be changed while still privileged
+	err = syscall.Setgroups([]int{})
+	if err != nil {
+		return
+	}
+	err = syscall.Setgid(gid)
+	if err != nil {
+		return
+	}
+	err = syscall.Setuid(uid)
+	if err != nil {
+		return
+	}
+
+	return restrict(writable)
+}
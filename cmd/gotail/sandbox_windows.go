@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+)
+
+// dropPrivileges not supported on Windows
+func dropPrivileges(name string, writable []string) error {
+	return errors.New("--sandbox is not supported on windows")
+}
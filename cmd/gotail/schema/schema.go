@@ -0,0 +1,298 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/*
+	A subset of JSON Schema used to check that structured log lines keep to a
+	contract. The keywords supported are type, enum, const, required,
+	properties, additionalProperties, items, minimum, maximum, minLength,
+	maxLength, and pattern. Other keywords are ignored.
+*/
+
+// Schema a JSON Schema or a schema nested within one
+type Schema struct {
+	Type                 typeList           `json:"type"`
+	Enum                 []interface{}      `json:"enum"`
+	Const                *json.RawMessage   `json:"const"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*Schema `json:"properties"`
+	AdditionalProperties *json.RawMessage   `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Pattern              string             `json:"pattern"`
+
+	constValue   interface{}
+	noAdditional bool    // additionalProperties is false
+	additional   *Schema // schema for properties not in Properties
+	pattern      *regexp.Regexp
+}
+
+// typeList the type keyword, which may be a single type or a list of them
+type typeList []string
+
+// UnmarshalJSON accept a string or a list of strings
+func (t *typeList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = typeList{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("type must be a string or a list of strings")
+	}
+	*t = list
+
+	return nil
+}
+
+// Load read a schema from a file
+func Load(path string) (s *Schema, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	s, err = Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("schema %s: %v", path, err)
+	}
+
+	return
+}
+
+// Parse parse a schema and prepare it for validation
+func Parse(data []byte) (s *Schema, err error) {
+	s = new(Schema)
+	err = json.Unmarshal(data, s)
+	if err != nil {
+		return nil, err
+	}
+	err = s.prepare()
+	if err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// prepare compile patterns and decode keywords that can take more than one
+// form, for this schema and those nested in it
+func (s *Schema) prepare() (err error) {
+	for _, t := range s.Type {
+		switch t {
+		case "object", "array", "string", "number", "integer", "boolean", "null":
+		default:
+			return fmt.Errorf("unknown type %q", t)
+		}
+	}
+	if s.Const != nil {
+		if err = json.Unmarshal(*s.Const, &s.constValue); err != nil {
+			return
+		}
+	}
+	if s.Pattern != "" {
+		if s.pattern, err = regexp.Compile(s.Pattern); err != nil {
+			return
+		}
+	}
+	if s.AdditionalProperties != nil {
+		var allowed bool
+		if json.Unmarshal(*s.AdditionalProperties, &allowed) == nil {
+			s.noAdditional = !allowed
+		} else {
+			s.additional = new(Schema)
+			if err = json.Unmarshal(*s.AdditionalProperties, s.additional); err != nil {
+				return
+			}
+		}
+	}
+
+	nested := []*Schema{s.Items, s.additional}
+	for _, p := range s.Properties {
+		nested = append(nested, p)
+	}
+	for _, n := range nested {
+		if n == nil {
+			continue
+		}
+		if err = n.prepare(); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// ValidateJSON check that a JSON document conforms to the schema
+func (s *Schema) ValidateJSON(data string) error {
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return err
+	}
+
+	return s.Validate(value)
+}
+
+// Validate check that a decoded JSON value conforms to the schema. The error
+// names the location of the first problem found as a JSON pointer.
+func (s *Schema) Validate(value interface{}) error {
+	return s.validate("", value)
+}
+
+func (s *Schema) validate(at string, value interface{}) error {
+	if len(s.Type) > 0 && !s.Type.matches(value) {
+		return fmt.Errorf("%s: expected %s, got %s", location(at), strings.Join(s.Type, " or "), typeOf(value))
+	}
+	if len(s.Enum) > 0 {
+		var found bool
+		for _, e := range s.Enum {
+			if equal(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value not in enum", location(at))
+		}
+	}
+	if s.Const != nil && !equal(s.constValue, value) {
+		return fmt.Errorf("%s: value does not equal const", location(at))
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return s.validateObject(at, v)
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.validate(fmt.Sprintf("%s/%d", at, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			return fmt.Errorf("%s: shorter than %d", location(at), *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fmt.Errorf("%s: longer than %d", location(at), *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			return fmt.Errorf("%s: does not match pattern %s", location(at), s.Pattern)
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			return fmt.Errorf("%s: less than %v", location(at), *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			return fmt.Errorf("%s: greater than %v", location(at), *s.Maximum)
+		}
+	}
+
+	return nil
+}
+
+// validateObject check required and listed properties of an object
+func (s *Schema) validateObject(at string, object map[string]interface{}) error {
+	for _, name := range s.Required {
+		if _, ok := object[name]; !ok {
+			return fmt.Errorf("%s: missing required property %s", location(at), name)
+		}
+	}
+
+	// Check in name order so that the error reported is stable
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, listed := s.Properties[name]
+		switch {
+		case listed:
+		case s.noAdditional:
+			return fmt.Errorf("%s: unexpected property %s", location(at), name)
+		case s.additional != nil:
+			property = s.additional
+		default:
+			continue
+		}
+		if err := property.validate(at+"/"+escape(name), object[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// matches check if value is one of the types
+func (t typeList) matches(value interface{}) bool {
+	actual := typeOf(value)
+	for _, want := range t {
+		if want == actual {
+			return true
+		}
+		if want == "number" && actual == "integer" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// typeOf get the JSON Schema type of a decoded value
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	return "unknown"
+}
+
+// equal compare decoded JSON values
+func equal(a, b interface{}) bool {
+	aj, _ := json.Marshal(a)
+	bj, _ := json.Marshal(b)
+	return bytes.Equal(aj, bj)
+}
+
+// location get a JSON pointer for messages, using / for the document itself
+func location(at string) string {
+	if at == "" {
+		return "/"
+	}
+	return at
+}
+
+// escape escape a property name for use in a JSON pointer
+func escape(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
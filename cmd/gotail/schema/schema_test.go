@@ -0,0 +1,58 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+const logSchema = `{
+  "type": "object",
+  "required": ["level", "msg"],
+  "properties": {
+    "level": {"enum": ["debug", "info", "warn", "error"]},
+    "msg": {"type": "string", "minLength": 1},
+    "status": {"type": "integer", "minimum": 100, "maximum": 599},
+    "trace": {"type": "string", "pattern": "^[0-9a-f]{16}$"},
+    "tags": {"type": "array", "items": {"type": "string"}}
+  },
+  "additionalProperties": false
+}`
+
+func TestValidate(t *testing.T) {
+	is := is.New(t)
+
+	s, err := Parse([]byte(logSchema))
+	is.NoErr(err)
+
+	is.NoErr(s.ValidateJSON(`{"level":"info","msg":"started","status":200,"tags":["a","b"]}`))
+
+	for line, want := range map[string]string{
+		`{"msg":"started"}`:                         "/: missing required property level",
+		`{"level":"fatal","msg":"x"}`:               "/level: value not in enum",
+		`{"level":"info","msg":""}`:                 "/msg: shorter than 1",
+		`{"level":"info","msg":"x","status":2.5}`:   "/status: expected integer, got number",
+		`{"level":"info","msg":"x","status":700}`:   "/status: greater than 599",
+		`{"level":"info","msg":"x","trace":"xyz"}`:  "/trace: does not match pattern ^[0-9a-f]{16}$",
+		`{"level":"info","msg":"x","tags":["a",1]}`: "/tags/1: expected string, got integer",
+		`{"level":"info","msg":"x","user":"alice"}`: "/: unexpected property user",
+		`["level"]`: "/: expected object, got array",
+	} {
+		err := s.ValidateJSON(line)
+		is.True(err != nil)
+		is.Equal(err.Error(), want)
+	}
+}
+
+func TestParseBadSchema(t *testing.T) {
+	is := is.New(t)
+
+	_, err := Parse([]byte(`{"type": "text"}`))
+	is.True(err != nil)
+	_, err = Parse([]byte(`{"properties": {"id": {"pattern": "("}}}`))
+	is.True(err != nil)
+
+	s, err := Parse([]byte(`{"type": ["string", "null"], "additionalProperties": {"type": "string"}}`))
+	is.NoErr(err)
+	is.NoErr(s.Validate(nil))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/imarsman/gotail/internal/input"
+)
+
+// snapshotPath get the path to write the tail of path to, relative to the
+// output directory or tar file. Paths under the working directory keep their
+// relative path and others their full path without the root.
+func snapshotPath(path, workingDir string) string {
+	if rel, err := filepath.Rel(workingDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	path = strings.TrimPrefix(path, filepath.VolumeName(path))
+
+	return strings.TrimLeft(path, `/\`)
+}
+
+// snapshotWriter write the tail of a file to its place in a snapshot
+type snapshotWriter func(name string, content []byte) error
+
+// dirWriter get a writer for a snapshot in a directory tree under dir
+func dirWriter(dir string) snapshotWriter {
+	return func(name string, content []byte) error {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(path, content, 0644)
+	}
+}
+
+// tarWriter get a writer for a snapshot in a tar file written to w
+func tarWriter(tw *tar.Writer) snapshotWriter {
+	now := time.Now()
+	return func(name string, content []byte) error {
+		err := tw.WriteHeader(&tar.Header{
+			Name:     filepath.ToSlash(name),
+			Mode:     0644,
+			Size:     int64(len(content)),
+			ModTime:  now,
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(content)
+		return err
+	}
+}
+
+// runSnapshot write the last numLines lines of every file matching patterns
+// to a tree mirroring their paths under dir or to a tar file, gzipped if its
+// name ends in .gz or .tgz. The number of files written is returned.
+func runSnapshot(patterns []string, numLines int, dir, tarPath string) (count int, err error) {
+	if (dir == "") == (tarPath == "") {
+		return 0, errors.New("snapshot needs one of --output-dir or --tar")
+	}
+
+	files, err := expandGlobs(patterns)
+	if err != nil {
+		return
+	}
+	if len(files) == 0 {
+		return 0, fmt.Errorf("no files match %s", strings.Join(patterns, " "))
+	}
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return
+	}
+
+	write := dirWriter(dir)
+	if tarPath != "" {
+		var f *os.File
+		f, err = os.Create(tarPath)
+		if err != nil {
+			return
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}()
+
+		var w io.Writer = f
+		if strings.HasSuffix(tarPath, ".gz") || strings.HasSuffix(tarPath, ".tgz") {
+			zw := gzip.NewWriter(f)
+			defer func() {
+				if cerr := zw.Close(); err == nil {
+					err = cerr
+				}
+			}()
+			w = zw
+		}
+		tw := tar.NewWriter(w)
+		defer func() {
+			if cerr := tw.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		write = tarWriter(tw)
+	}
+
+	for _, path := range files {
+		lines, _, err := input.FileLines(path, false, false, numLines)
+		if err != nil {
+			// Files can go away between globbing and reading
+			fmt.Fprintln(os.Stderr, err.Error())
+			continue
+		}
+		var content []byte
+		for _, line := range lines {
+			content = append(content, line...)
+			content = append(content, '\n')
+		}
+		if err := write(snapshotPath(path, workingDir), content); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/imarsman/gotail/cmd/internal/args"
+)
+
+/*
+	With --strict files are written as coreutils tail and head would write
+	them, byte for byte. Lines are copied as they are, including a last line
+	without a newline, and only files are read, named as given without glob
+	expansion. Headers are only written for more than one file, and files that
+	can't be read are reported on stderr and make the exit status 1 once the
+	rest have been written. Options that change what is written can't be used.
+	Counting bytes with -c writes files the same way, as a count of bytes can
+	end partway through a line.
+*/
+
+// strictConflicts get the options given that change output and so can't be
+// used with --strict
+func strictConflicts() (flags []string) {
+	a := args.Args
+	for _, c := range []struct {
+		flag string
+		set  bool
+	}{
+		{"-m/--match", a.Match != ""},
+		{"--exclude", len(a.Excludes) > 0},
+		{"--highlight", len(a.Highlights) > 0},
+		{"--rule", len(a.Rules) > 0},
+		{"--color always", a.Colour == "always"},
+		{"-j", a.JSON},
+		{"-J/--json-only", a.JSONOnly},
+		{"-N", a.LineNumbers},
+		{"-p", a.PrintExtra},
+		{"--since", a.Since != ""},
+		{"--until", a.Until != ""},
+		{"--schema", a.Schema != ""},
+		{"--check-order", a.CheckOrder},
+		{"--script", a.Script != ""},
+		{"--hash-field", len(a.HashFields) > 0},
+		{"--output", a.Output != "text"},
+		{"--host-column", a.HostColumn},
+		{"--prefix-filename", a.PrefixFilename},
+		{"--canonical", a.Canonical},
+		{"--alias", len(a.Aliases) > 0},
+		{"--short-names", a.ShortNames != "none"},
+		{"--group-dirs", a.GroupDirs},
+		{"--sticky-header", a.StickyHeader != ""},
+		{"--file-colours", a.FileColours},
+		{"--summary-every", a.SummaryEvery > 0},
+		{"--container", len(a.Containers) > 0},
+		{"--cmd", len(a.Commands) > 0},
+		{"--dir", len(a.Dirs) > 0},
+		{"--truncate", a.Truncate != 0},
+		{"--wrap", a.Wrap != 0},
+		{"--explode-array", a.ExplodeArray},
+		{"--validate-json", a.ValidateJSON},
+		{"--watch-interval", a.WatchInterval != 0},
+		{"--start-offset", a.StartOffset != ""},
+		{"--end-offset", a.EndOffset != ""},
+		{"--forward", a.Forward != ""},
+		{"--squash-repeats", a.SquashRepeats},
+	} {
+		if c.set {
+			flags = append(flags, c.flag)
+		}
+	}
+
+	return
+}
+
+// strictError get the text for err as coreutils would give it, without the
+// operation and path that are given separately
+func strictError(err error) string {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	text := err.Error()
+	if text == "" {
+		return text
+	}
+
+	return strings.ToUpper(text[:1]) + text[1:]
+}
+
+// tailStart get the offset of the start of the last n lines of the size bytes
+// in r. A newline ending the last line doesn't start another.
+func tailStart(r io.ReaderAt, size int64, n int) (start int64, err error) {
+	if n <= 0 {
+		return size, nil
+	}
+	end := size
+	if size > 0 {
+		last := make([]byte, 1)
+		if _, err = r.ReadAt(last, size-1); err != nil && err != io.EOF {
+			return
+		}
+		if last[0] == '\n' {
+			end--
+		}
+	}
+
+	buf := make([]byte, 32*1024)
+	var count int
+	for pos := end; pos > 0; {
+		chunk := int64(len(buf))
+		if chunk > pos {
+			chunk = pos
+		}
+		pos -= chunk
+		if _, err = r.ReadAt(buf[:chunk], pos); err != nil && err != io.EOF {
+			return
+		}
+		for i := chunk - 1; i >= 0; i-- {
+			if buf[i] != '\n' {
+				continue
+			}
+			count++
+			if count == n {
+				return pos + i + 1, nil
+			}
+		}
+	}
+
+	return 0, nil
+}
+
+// strictWrite write the lines wanted from file to w. For a tail regular files
+// are read backward from their end and other files are read in full.
+func strictWrite(w io.Writer, file *os.File, head, startAtOffset bool, n int) (err error) {
+	if !head && !startAtOffset {
+		fi, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			start, err := tailStart(file, fi.Size(), n)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(w, io.NewSectionReader(file, start, fi.Size()-start))
+			return err
+		}
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		start, _ := tailStart(bytes.NewReader(data), int64(len(data)), n)
+		_, err = w.Write(data[start:])
+		return err
+	}
+
+	reader := bufio.NewReader(file)
+	if startAtOffset {
+		// +0 starts at the first line as +1 does
+		for i := 1; i < n; i++ {
+			if _, err = reader.ReadSlice('\n'); err == io.EOF {
+				return nil
+			} else if err != nil && err != bufio.ErrBufferFull {
+				return
+			} else if err == bufio.ErrBufferFull {
+				// Keep reading a long line without counting it again
+				i--
+			}
+		}
+		_, err = io.Copy(w, reader)
+		return
+	}
+
+	for i := 0; i < n; {
+		line, err := reader.ReadSlice('\n')
+		if len(line) > 0 {
+			if _, err := w.Write(line); err != nil {
+				return err
+			}
+		}
+		switch err {
+		case nil:
+			i++
+		case bufio.ErrBufferFull:
+		case io.EOF:
+			return nil
+		default:
+			return err
+		}
+	}
+
+	return
+}
+
+// strictWriteBytes write the bytes wanted from file to w. For a tail regular
+// files are read from n bytes before their end and other files are read in
+// full.
+func strictWriteBytes(w io.Writer, file *os.File, head, startAtOffset bool, n int) (err error) {
+	if head && !startAtOffset {
+		_, err = io.CopyN(w, file, int64(n))
+		if err == io.EOF {
+			err = nil
+		}
+		return
+	}
+
+	if startAtOffset {
+		// +0 starts at the first byte as +1 does
+		if n > 1 {
+			if _, err = io.CopyN(io.Discard, file, int64(n-1)); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return
+			}
+		}
+		_, err = io.Copy(w, file)
+		return
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		return
+	}
+	if fi.Mode().IsRegular() {
+		start := fi.Size() - int64(n)
+		if start < 0 {
+			start = 0
+		}
+		_, err = io.Copy(w, io.NewSectionReader(file, start, fi.Size()-start))
+		return
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return
+	}
+	if len(data) > n {
+		data = data[len(data)-n:]
+	}
+	_, err = w.Write(data)
+
+	return
+}
+
+// runStrict write the files named to w as tail or head would, with a header
+// before each if headers is set, returning the name of the last file written
+// and whether any file couldn't be read. n counts bytes if countBytes is set
+// and lines otherwise. Standard input is read for a name of -.
+func runStrict(w io.Writer, names []string, headers, head, startAtOffset bool, n int, countBytes bool) (last string, failed bool) {
+	// As with tail, asking for no lines or bytes of a tail reads nothing
+	if n == 0 && !head && !startAtOffset {
+		return
+	}
+	// Errors are written in order with the lines before them
+	flush := func() {
+		if f, ok := w.(interface{ Flush() error }); ok {
+			f.Flush()
+		}
+	}
+	var written int
+	for _, name := range names {
+		file, display := os.Stdin, "standard input"
+		if name != "-" {
+			var err error
+			if file, err = os.Open(name); err != nil {
+				flush()
+				fmt.Fprintf(os.Stderr, "gotail: cannot open '%s' for reading: %s\n", name, strictError(err))
+				failed = true
+				continue
+			}
+			display = name
+		}
+
+		if headers {
+			if written > 0 {
+				io.WriteString(w, "\n")
+			}
+			fmt.Fprintf(w, "==> %s <==\n", display)
+			written++
+		}
+		write := strictWrite
+		if countBytes {
+			write = strictWriteBytes
+		}
+		if err := write(w, file, head, startAtOffset, n); err != nil {
+			flush()
+			fmt.Fprintf(os.Stderr, "gotail: error reading '%s': %s\n", display, strictError(err))
+			failed = true
+		}
+		if file != os.Stdin {
+			file.Close()
+		}
+		last = name
+	}
+
+	return
+}
+
+// strictFile a file followed with --strict and how far it has been written
+type strictFile struct {
+	name   string
+	file   *os.File // nil while a file followed by name is missing
+	offset int64
+}
+
+// openStrict open name to follow it from its end
+func openStrict(name string) (*strictFile, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &strictFile{name: name, file: file, offset: offset}, nil
+}
+
+// copyNew write the bytes added to f since it was last read to w, with a
+// header first if headers is set and the last bytes written were another
+// file's. The name of the file last written is kept in last.
+func (f *strictFile) copyNew(w io.Writer, headers bool, last *string) error {
+	fi, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() < f.offset {
+		fmt.Fprintf(os.Stderr, "gotail: %s: file truncated\n", f.name)
+		f.offset = 0
+	}
+	if fi.Size() == f.offset {
+		return nil
+	}
+	if headers && *last != f.name {
+		fmt.Fprintf(w, "\n==> %s <==\n", f.name)
+		*last = f.name
+	}
+	n, err := io.Copy(w, io.NewSectionReader(f.file, f.offset, fi.Size()-f.offset))
+	f.offset += n
+
+	return err
+}
+
+// reopen start following the file now at f's name if it has been replaced,
+// as with -F, once what was written to the file it replaced has been copied
+func (f *strictFile) reopen(w io.Writer, headers bool, last *string) {
+	fi, err := os.Stat(f.name)
+	if err != nil {
+		return
+	}
+	change := "appeared"
+	if f.file != nil {
+		if open, err := f.file.Stat(); err == nil && os.SameFile(open, fi) {
+			return
+		}
+		f.copyNew(w, headers, last)
+		f.file.Close()
+		f.file = nil
+		change = "been replaced"
+	}
+	file, err := os.Open(f.name)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "gotail: '%s' has %s;  following new file\n", f.name, change)
+	f.file, f.offset = file, 0
+}
+
+// followStrictOnce copy what has been added to each file to w, reopening
+// files that have been replaced if byName is set
+func followStrictOnce(w io.Writer, files []*strictFile, headers, byName bool, last *string) {
+	for _, f := range files {
+		if byName {
+			f.reopen(w, headers, last)
+		}
+		if f.file == nil {
+			continue
+		}
+		if err := f.copyNew(w, headers, last); err != nil {
+			fmt.Fprintf(os.Stderr, "gotail: error reading '%s': %s\n", f.name, strictError(err))
+		}
+	}
+}
+
+// followStrict follow the regular files named, as tail -f does, until
+// interrupted. The bytes added to files are copied as they are, with headers
+// between those from different files if headers is set. With -F files are
+// followed by name, so a replaced or missing file is followed once it is
+// there.
+func followStrict(names []string, headers bool, last string) {
+	byName := args.Args.FollowName
+	var files []*strictFile
+	for _, name := range names {
+		if name == "-" {
+			continue
+		}
+		f, err := openStrict(name)
+		if err != nil {
+			if byName {
+				files = append(files, &strictFile{name: name})
+			}
+			continue
+		}
+		files = append(files, f)
+	}
+
+	interval := args.Args.SleepInterval
+	if interval <= 0 {
+		interval = 250 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	for {
+		select {
+		case <-c:
+			for _, f := range files {
+				if f.file != nil {
+					f.file.Close()
+				}
+			}
+			return
+		case <-ticker.C:
+			followStrictOnce(os.Stdout, files, headers, byName, &last)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/imarsman/gotail/cmd/gotail/metrics"
+	"github.com/imarsman/gotail/cmd/gotail/output"
+	"github.com/imarsman/gotail/cmd/internal/args"
+	"github.com/imarsman/gotail/internal/util"
+)
+
+// printSummary print the lines read and printed for each followed source to
+// stderr along with the exit status of any command that failed. Return true if
+// a command failed.
+func printSummary() (failed bool) {
+	errs := map[string]error{}
+	for _, fc := range followedCommands {
+		if err := fc.Err(); err != nil {
+			errs[fc.Name] = err
+			failed = true
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, output.Colour(output.BrightBlue, "==> summary <=="))
+	metrics.Each(func(name string, s *metrics.Source) {
+		lines := s.Lines()
+		summary := fmt.Sprintf("%s: %d %s read, %d printed", name, lines, util.Pluralize("line", "lines", int(lines)), s.Matched())
+		if shed := s.ShedBytes(); shed > 0 {
+			summary += fmt.Sprintf(", %s shed to stay under --max-memory", util.FormatSize(int64(shed)))
+		}
+		if restarts := s.Restarts(); restarts > 0 {
+			summary += fmt.Sprintf(", restarted %d %s", restarts, util.Pluralize("time", "times", int(restarts)))
+		}
+		if err, ok := errs[name]; ok {
+			fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, summary+", "+err.Error()))
+		} else {
+			fmt.Fprintln(os.Stderr, summary)
+		}
+		for _, line := range hitLines(s.Hits()) {
+			fmt.Fprintln(os.Stderr, "  "+line)
+		}
+	})
+
+	return
+}
+
+// hitLines format the number of printed lines matching each pattern, most
+// matched first
+func hitLines(hits map[string]uint64) []string {
+	patterns := make([]string, 0, len(hits))
+	for pattern := range hits {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if hits[patterns[i]] != hits[patterns[j]] {
+			return hits[patterns[i]] > hits[patterns[j]]
+		}
+		return patterns[i] < patterns[j]
+	})
+
+	lines := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		n := hits[pattern]
+		lines = append(lines, fmt.Sprintf("%s: %d %s", pattern, n, util.Pluralize("line", "lines", int(n))))
+	}
+
+	return lines
+}
+
+// printValidation print the number of lines checked by --validate-json and of
+// those without valid JSON to stderr. Return true if any were invalid.
+func printValidation() (invalid bool) {
+	if !args.Args.ValidateJSON {
+		return
+	}
+	checked, failed := output.ValidationCounts()
+	summary := fmt.Sprintf("%d %s checked, %d with invalid JSON", checked, util.Pluralize("line", "lines", int(checked)), failed)
+	if failed > 0 {
+		fmt.Fprintln(os.Stderr, output.Colour(output.BrightRed, summary))
+		return true
+	}
+	fmt.Fprintln(os.Stderr, summary)
+
+	return
+}
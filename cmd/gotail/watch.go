@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+/*
+	Directories and patterns with a ** segment are recursive. A directory is
+	treated as dir/** so that all files under it are found, and ** matches any
+	number of directories. When following, recursive patterns are watched with
+	fsnotify rather than being globbed every interval. A watch is added for every
+	directory under the pattern's root, including new directories as they are
+	created, so new files are followed as soon as they appear.
+
+	Directories given with --dir are not recursive. Their files are found with
+	a dir/* pattern, which is watched in the same way but without watches for
+	the directories under it. Other patterns with wildcards only in their last
+	segment, and paths without wildcards, are watched like this as well unless
+	--recheck is interval, so that only patterns with wildcards in a directory
+	are globbed every interval.
+*/
+
+// recursivePattern get the absolute form of pattern if it is recursive
+func recursivePattern(pattern string) (recursive string, ok bool) {
+	abs, err := filepath.Abs(pattern)
+	if err != nil {
+		return
+	}
+	if fi, err := os.Stat(abs); err == nil && fi.IsDir() {
+		return filepath.Join(abs, "**"), true
+	}
+	for _, segment := range strings.Split(filepath.ToSlash(abs), "/") {
+		if segment == "**" {
+			return abs, true
+		}
+	}
+
+	return
+}
+
+// recursiveRoot get the directory to walk for a recursive pattern, which is the
+// part of the pattern before the first segment with a wildcard
+func recursiveRoot(pattern string) string {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	for i, segment := range segments {
+		if strings.ContainsAny(segment, "*?[") {
+			return filepath.FromSlash(strings.Join(segments[:i], "/") + "/")
+		}
+	}
+
+	return filepath.Dir(pattern)
+}
+
+// matchSegments match path segments against pattern segments where ** matches
+// zero or more segments
+func matchSegments(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchSegments(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 {
+		return false
+	}
+	ok, _ := filepath.Match(pattern[0], path[0])
+
+	return ok && matchSegments(pattern[1:], path[1:])
+}
+
+// matchRecursive check whether an absolute path matches a recursive pattern
+func matchRecursive(pattern, path string) bool {
+	return matchSegments(strings.Split(filepath.ToSlash(pattern), "/"), strings.Split(filepath.ToSlash(path), "/"))
+}
+
+// expandRecursive get the files under the root of a pattern that match it.
+// Directories below the root are only searched if the pattern is recursive.
+func expandRecursive(pattern string) (paths []string) {
+	root := filepath.Clean(recursiveRoot(pattern))
+	_, deep := recursivePattern(pattern)
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip unreadable directories rather than stopping
+			return nil
+		}
+		if d.IsDir() && path != root && !deep {
+			return fs.SkipDir
+		}
+		if d.Type().IsRegular() && matchRecursive(pattern, path) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+
+	return
+}
+
+// dirPatterns patterns for the files in directories given with --dir. It is
+// set before any patterns are expanded.
+var dirPatterns = map[string]bool{}
+
+// dirPattern get the absolute pattern for the files in dir, which must be a
+// directory
+func dirPattern(dir string) (pattern string, err error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return
+	}
+	if !fi.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+
+	return filepath.Join(abs, "*"), nil
+}
+
+// flatPattern get the absolute form of pattern if it can be watched by
+// watching one directory, because only its last segment has wildcards. The
+// directory must exist to be watched.
+func flatPattern(pattern string) (flat string, ok bool) {
+	abs, err := filepath.Abs(pattern)
+	if err != nil {
+		return
+	}
+	dir := filepath.Dir(abs)
+	if strings.ContainsAny(dir, "*?[") {
+		return
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return
+	}
+
+	return abs, true
+}
+
+// watchedPattern a pattern whose directories are watched for new files
+type watchedPattern struct {
+	pattern string
+	root    string // the directory watched, with those under it if deep
+	deep    bool   // whether the pattern is recursive
+}
+
+// recursiveWatcher watch the directories of patterns for new files
+type recursiveWatcher struct {
+	watcher  *fsnotify.Watcher
+	patterns []watchedPattern
+}
+
+// newRecursiveWatcher watch the directories of patterns, which must be
+// absolute recursive or flat patterns, calling found with new files that
+// match. Directories below the root of a pattern are only watched if it has a
+// ** segment.
+func newRecursiveWatcher(patterns []string, found func(paths []string)) (rw *recursiveWatcher, err error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return
+	}
+	rw = &recursiveWatcher{watcher: watcher}
+	for _, pattern := range patterns {
+		_, deep := recursivePattern(pattern)
+		root := filepath.Clean(recursiveRoot(pattern))
+		rw.patterns = append(rw.patterns, watchedPattern{pattern: pattern, root: root, deep: deep})
+	}
+
+	for _, wp := range rw.patterns {
+		rw.addTree(wp.root)
+	}
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&fsnotify.Create == 0 {
+					continue
+				}
+				fi, err := os.Stat(event.Name)
+				if err != nil {
+					continue
+				}
+				// Files may have been created in a new directory before its
+				// watch was added so they are gathered while adding it.
+				if fi.IsDir() {
+					if !rw.deep(event.Name) {
+						continue
+					}
+					if paths := rw.addTree(event.Name); len(paths) > 0 {
+						found(paths)
+					}
+					continue
+				}
+				if fi.Mode().IsRegular() && rw.matches(event.Name) {
+					found([]string{event.Name})
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+
+	return
+}
+
+// matches check whether path matches any of the watched patterns
+func (rw *recursiveWatcher) matches(path string) bool {
+	for _, wp := range rw.patterns {
+		if matchRecursive(wp.pattern, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// deep check whether dir is under the root of a recursive pattern
+func (rw *recursiveWatcher) deep(dir string) bool {
+	for _, wp := range rw.patterns {
+		if wp.deep && strings.HasPrefix(dir, wp.root+string(os.PathSeparator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addTree add watches for root and the directories under it that are watched,
+// getting the files found that match a pattern
+func (rw *recursiveWatcher) addTree(root string) (paths []string) {
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && !rw.deep(path) {
+				return fs.SkipDir
+			}
+			rw.watcher.Add(path)
+			return nil
+		}
+		if d.Type().IsRegular() && rw.matches(path) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+
+	return
+}
+
+// Close remove all watches
+func (rw *recursiveWatcher) Close() error {
+	return rw.watcher.Close()
+}
@@ -2,7 +2,9 @@ package args
 
 import (
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/alexflint/go-arg"
 )
@@ -19,26 +21,148 @@ var GitExactTag string
 // Date for use when compiling
 var Date string
 
+// snapshot arguments for the snapshot subcommand
+type snapshot struct {
+	Patterns  []string `arg:"positional,required" help:"files or glob patterns, including ** patterns"`
+	OutputDir string   `arg:"--output-dir,env:GOTAIL_OUTPUT_DIR" help:"directory to write the tail of each file to, mirroring its path"`
+	Tar       string   `arg:"--tar,env:GOTAIL_TAR" help:"tar file to write instead, gzipped if it ends in .gz or .tgz"`
+}
+
+// diff arguments for the diff subcommand
+type diff struct {
+	StateFile string   `arg:"--state-file,required,env:GOTAIL_STATE_FILE" help:"JSON file recording how far each file has been read"`
+	Patterns  []string `arg:"positional,required" help:"files or glob patterns, including ** patterns"`
+}
+
+// gen arguments for the gen subcommand
+type gen struct {
+	Path         string `arg:"positional" help:"file to write lines to"`
+	File         string `arg:"--file,env:GOTAIL_GEN_FILE" help:"file to write lines to, as an alternative to giving it after gen"`
+	Rate         int    `arg:"--rate,env:GOTAIL_GEN_RATE" default:"10" help:"lines to write a second"`
+	Count        int    `arg:"--count,env:GOTAIL_GEN_COUNT" help:"stop after writing this many lines rather than running until interrupted"`
+	Format       string `arg:"--format,env:GOTAIL_GEN_FORMAT" default:"text" help:"form of the lines written: text, json or logfmt"`
+	JSON         bool   `arg:"--json,env:GOTAIL_GEN_JSON" help:"write lines as JSON objects, the same as --format json"`
+	Rotate       string `arg:"--rotate,env:GOTAIL_GEN_ROTATE" help:"rename the file to PATH.1 and start it again when it reaches this size, e.g. 10MB"`
+	CopyTruncate bool   `arg:"--copytruncate,env:GOTAIL_GEN_COPYTRUNCATE" help:"with --rotate, copy the file to PATH.1 and truncate it rather than renaming it"`
+	Seed         int64  `arg:"--seed,env:GOTAIL_GEN_SEED" default:"1" help:"seed for the lines made up, with the same seed giving the same lines"`
+}
+
+// bench arguments for the bench subcommand
+type bench struct {
+	Patterns    []string `arg:"positional,required" help:"files or glob patterns to time reading"`
+	Runs        int      `arg:"--runs,env:GOTAIL_BENCH_RUNS" default:"5" help:"times to run each measurement, with the fastest reported"`
+	Compare     bool     `arg:"--compare,env:GOTAIL_BENCH_COMPARE" help:"also time the system's tail and head doing the same"`
+	FollowLines int      `arg:"--follow-lines,env:GOTAIL_BENCH_FOLLOW_LINES" default:"1000" help:"lines of each file appended to a followed file to time following, 0 to not time it"`
+}
+
 // args to use with go-args
 type args struct {
-	NoColour    bool     `arg:"-C" help:"no colour"`
-	Follow      bool     `arg:"-f" help:"follow new file lines."`
-	NumLines    string   `arg:"-n" default:"10" help:"number of lines - prefix '+' for head to start at line n"`
-	PrintExtra  bool     `arg:"-p" help:"print extra formatting to output if more than one file is listed"`
-	LineNumbers bool     `arg:"-N" help:"show line numbers"`
-	JSON        bool     `arg:"-j" help:"pretty print JSON"`
-	JSONOnly    bool     `arg:"-J,--json-only" help:"ignore non-JSON and process JSON"`
-	Match       string   `arg:"-m,--match" help:"match lines by regex"`
-	Head        bool     `arg:"-H" help:"print head of file rather than tail"`
-	Interval    uint     `arg:"-i" help:"seconds between new file checks" default:"1"`
-	Files       []string `arg:"-f,--files" help:"files to tail"`
+	Snapshot          *snapshot     `arg:"subcommand:snapshot" help:"write the last lines of each file to a directory or tar file"`
+	Diff              *diff         `arg:"subcommand:diff" help:"print lines added to files since the last diff with the same state file"`
+	Gen               *gen          `arg:"subcommand:gen" help:"write made up log lines to a file at a steady rate for trying gotail out"`
+	Bench             *bench        `arg:"subcommand:bench" help:"time gotail reading and following files, optionally against the system's tail"`
+	NoColour          bool          `arg:"-C,env:GOTAIL_NO_COLOUR" help:"no colour, the same as --color never"`
+	Colour            string        `arg:"--color,env:GOTAIL_COLOR" help:"when to colour output: always, auto for when standard output is a terminal, or never" default:"auto"`
+	Follow            bool          `arg:"-f,env:GOTAIL_FOLLOW" help:"follow new file lines, stopping if a file is renamed or removed"`
+	FollowName        bool          `arg:"-F,env:GOTAIL_FOLLOW_NAME" help:"follow new file lines, reopening files by name when they are rotated"`
+	NumLines          string        `arg:"-n,env:GOTAIL_LINES" default:"10" help:"number of lines, with a suffix such as 10k - prefix '+' for head to start at line n"`
+	Bytes             string        `arg:"-c,--bytes,env:GOTAIL_BYTES" help:"number of bytes rather than lines, with a suffix such as 10M - prefix '+' to start at byte n"`
+	PrintExtra        bool          `arg:"-p,env:GOTAIL_PRINT_EXTRA" help:"print extra formatting to output if more than one file is listed"`
+	LineNumbers       bool          `arg:"-N,env:GOTAIL_LINE_NUMBERS" help:"show line numbers"`
+	NumberStart       int           `arg:"--number-start,env:GOTAIL_NUMBER_START" help:"with -N, the number given to the first line of a file, such as 0" default:"1"`
+	NumberSeparator   string        `arg:"--number-separator,env:GOTAIL_NUMBER_SEPARATOR" help:"with -N, what is printed between a line number and its line" default:" "`
+	JSON              bool          `arg:"-j,env:GOTAIL_JSON" help:"pretty print JSON"`
+	JSONOnly          bool          `arg:"-J,--json-only,env:GOTAIL_JSON_ONLY" help:"ignore non-JSON and process JSON"`
+	KeepKeyOrder      bool          `arg:"--keep-key-order,env:GOTAIL_KEEP_KEY_ORDER" help:"with -j, keep JSON keys in the order they are in lines rather than sorted, which is faster"`
+	Match             string        `arg:"-m,--match,env:GOTAIL_MATCH" help:"match lines by regex"`
+	Excludes          []string      `arg:"--exclude,separate,env:GOTAIL_EXCLUDE" help:"drop lines matching a regex, like grep -v"`
+	Highlights        []string      `arg:"--highlight,separate,env:GOTAIL_HIGHLIGHT" help:"colour parts of lines matching a regex given as REGEX or COLOUR:REGEX, e.g. red:ERROR"`
+	Rules             []string      `arg:"--rule,separate,env:GOTAIL_RULE" help:"print the name of a rule given as NAME=REGEX before lines matching it, as for rules in the config file"`
+	Since             string        `arg:"--since,env:GOTAIL_SINCE" help:"print only lines timestamped at or after this time, e.g. 1h, 09:30, or 2024-05-01 12:00"`
+	Until             string        `arg:"--until,env:GOTAIL_UNTIL" help:"print only lines timestamped at or before this time, in the same forms as --since"`
+	ExplodeArray      bool          `arg:"--explode-array,env:GOTAIL_EXPLODE_ARRAY" help:"print each element of a line holding a JSON array as a line of its own"`
+	ValidateJSON      bool          `arg:"--validate-json,env:GOTAIL_VALIDATE_JSON" help:"print where lines without valid JSON are and why, with a count of them on exit"`
+	Schema            string        `arg:"--schema,env:GOTAIL_SCHEMA" help:"flag lines whose JSON does not conform to this JSON Schema file"`
+	SchemaInvalid     bool          `arg:"--schema-invalid,env:GOTAIL_SCHEMA_INVALID" help:"with --schema, print only lines whose JSON does not conform"`
+	CheckOrder        bool          `arg:"--check-order,env:GOTAIL_CHECK_ORDER" help:"flag lines whose timestamp is before the previous line's or after it by more than --clock-jump"`
+	ClockJump         time.Duration `arg:"--clock-jump,env:GOTAIL_CLOCK_JUMP" help:"with --check-order, flag forward jumps larger than this" default:"1h"`
+	Script            string        `arg:"--script,env:GOTAIL_SCRIPT" help:"Lua script whose process(line, meta) function can drop, change, or annotate lines"`
+	CopyMatch         bool          `arg:"--copy-match,env:GOTAIL_COPY_MATCH" help:"copy the most recent matching line to the clipboard on exit, or when c is pressed while following"`
+	NoScrollInterrupt bool          `arg:"--no-scroll-interrupt,env:GOTAIL_NO_SCROLL_INTERRUPT" help:"pause printing followed lines when space is pressed in a terminal, holding new lines until it is pressed again"`
+	SquashRepeats     bool          `arg:"--squash-repeats,env:GOTAIL_SQUASH_REPEATS" help:"print a followed line that repeats the one before it from the same source once, with a count of the repeats"`
+	SquashTimeout     time.Duration `arg:"--squash-timeout,env:GOTAIL_SQUASH_TIMEOUT" help:"with --squash-repeats, print the count once no repeat has come for this long" default:"2s"`
+	HashFields        []string      `arg:"--hash-field,separate,env:GOTAIL_HASH_FIELDS" help:"replace values of a JSON or logfmt field with a keyed hash"`
+	HashKey           string        `arg:"--hash-key,env:GOTAIL_HASH_KEY" help:"key for --hash-field hashes, or env:NAME or file:PATH to read it from"`
+	StartOffset       string        `arg:"--start-offset,env:GOTAIL_START_OFFSET" help:"read files from this byte offset, e.g. 1M, numbering lines as they are in the file"`
+	EndOffset         string        `arg:"--end-offset,env:GOTAIL_END_OFFSET" help:"read files up to this byte offset"`
+	MaxLineLength     string        `arg:"--max-line-length,env:GOTAIL_MAX_LINE_LENGTH" help:"the longest line read, with longer lines cut to it, e.g. 4M" default:"1M"`
+	Truncate          int           `arg:"--truncate,env:GOTAIL_TRUNCATE" help:"cut printed lines longer than this many characters, ending them with an ellipsis"`
+	Wrap              int           `arg:"--wrap,env:GOTAIL_WRAP" help:"break printed lines longer than this many characters onto more lines"`
+	Head              bool          `arg:"-H,env:GOTAIL_HEAD" help:"print head of file rather than tail"`
+	Recheck           string        `arg:"--recheck,env:GOTAIL_RECHECK" help:"when following, how to find new files for patterns: notify to watch their directories, or interval" default:"notify"`
+	Interval          uint          `arg:"-i,env:GOTAIL_INTERVAL" help:"seconds between new file checks" default:"1"`
+	FormatHint        string        `arg:"--format-hint,env:GOTAIL_FORMAT_HINT" help:"line format: auto, json, logfmt, access, or plain" default:"auto"`
+	Aliases           []string      `arg:"--alias,separate,env:GOTAIL_ALIAS" help:"show NAME in headers for files matching PATH, given as PATH=NAME"`
+	ShortNames        string        `arg:"--short-names,env:GOTAIL_SHORT_NAMES" help:"shorten paths in headers: none, base, or prefix" default:"none"`
+	Output            string        `arg:"--output,env:GOTAIL_OUTPUT" help:"write lines as text, or as JSON objects one per line with ndjson" default:"text"`
+	FallbackTime      string        `arg:"--fallback-time,env:GOTAIL_FALLBACK_TIME" help:"with --output ndjson, time for lines without a timestamp: none, received, or mtime" default:"none"`
+	HostColumn        bool          `arg:"--host-column,env:GOTAIL_HOST_COLUMN" help:"prefix lines with the host they come from, from the config file or ssh commands"`
+	PrefixFilename    bool          `arg:"--prefix-filename,env:GOTAIL_PREFIX_FILENAME" help:"print the short name of each line's file before it instead of headers"`
+	Canonical         bool          `arg:"--canonical,env:GOTAIL_CANONICAL" help:"print lines without colour or headers, carriage returns, or differences in JSON key order, so that runs can be diffed"`
+	Containers        []string      `arg:"--container,separate,env:GOTAIL_CONTAINER" help:"follow a file in a container given as NAME:/path/file.log"`
+	ContainerRuntime  string        `arg:"--container-runtime,env:GOTAIL_CONTAINER_RUNTIME" help:"docker, podman, nerdctl, or kubectl" default:"docker"`
+	Commands          []string      `arg:"--cmd,separate,env:GOTAIL_CMD" help:"follow the output of a shell command, decompressing it if needed"`
+	Fds               []int         `arg:"--fd,separate,env:GOTAIL_FD" help:"read a descriptor inherited from the parent process, such as a pipe from a supervisor or a listening socket from socket activation"`
+	Backend           string        `arg:"--backend,env:GOTAIL_BACKEND" help:"file change notification: auto, inotify, kqueue, or poll" default:"auto"`
+	Sandbox           string        `arg:"--sandbox,env:GOTAIL_SANDBOX" help:"with -f, switch to this user once files are open, e.g. nobody"`
+	MaxMemory         string        `arg:"--max-memory,env:GOTAIL_MAX_MEMORY" help:"when following, the most memory buffers can hold before the oldest data is dropped, e.g. 256MB"`
+	GroupDirs         bool          `arg:"--group-dirs,env:GOTAIL_GROUP_DIRS" help:"with many files, group file headers under a header for each directory"`
+	Quiet             bool          `arg:"-q,--quiet,env:GOTAIL_QUIET" help:"never print headers giving file names"`
+	Verbose           bool          `arg:"-v,--verbose,env:GOTAIL_VERBOSE" help:"always print headers giving file names, even for one file"`
+	Strict            bool          `arg:"--strict,env:GOTAIL_STRICT" help:"write files byte for byte as tail and head do, with their headers and exit status, for scripts"`
+	StickyHeader      string        `arg:"--sticky-header,env:GOTAIL_STICKY_HEADER" help:"when following in a terminal, keep the current source on a line at the top or bottom"`
+	FileColours       bool          `arg:"--file-colours,env:GOTAIL_FILE_COLOURS" help:"give each file's headers a colour of its own unless the config file sets one"`
+	FileBar           bool          `arg:"--file-bar,env:GOTAIL_FILE_BAR" help:"with --file-colours, print a bar in the file's colour before each followed line"`
+	SummaryEvery      time.Duration `arg:"--summary-every,env:GOTAIL_SUMMARY_EVERY" help:"when following, print a summary of lines, errors, and matches this often, e.g. 1m"`
+	Heartbeat         time.Duration `arg:"--heartbeat,env:GOTAIL_HEARTBEAT" help:"with --output ndjson, when following write a stats record for each source this often, e.g. 30s"`
+	StallWarning      time.Duration `arg:"--stall-warning,env:GOTAIL_STALL_WARNING" help:"warn when a followed source has no new lines for this long, e.g. 10m"`
+	FollowStdin       bool          `arg:"--follow-stdin,env:GOTAIL_FOLLOW_STDIN" help:"keep reading piped standard input as it grows, as --follow does when it is the only source"`
+	WatchInterval     time.Duration `arg:"--watch-interval,env:GOTAIL_WATCH_INTERVAL" help:"read files in full and print them this often, e.g. 2s, for files such as those in /proc that can't be followed"`
+	WatchDiff         bool          `arg:"--watch-diff,env:GOTAIL_WATCH_DIFF" help:"with --watch-interval, print only the lines changed since the last read"`
+	Ring              int           `arg:"--ring,env:GOTAIL_RING" help:"when following, keep this many of the last lines printed to write to a file on SIGUSR2"`
+	RingDir           string        `arg:"--ring-dir,env:GOTAIL_RING_DIR" help:"directory --ring files are written to" default:"."`
+	Forward           string        `arg:"--forward,env:GOTAIL_FORWARD" help:"also write lines as JSON objects to tcp://host:port, udp://host:port, unix:///path, or unixgram:///path"`
+	ForwardOnly       bool          `arg:"--forward-only,env:GOTAIL_FORWARD_ONLY" help:"with --forward, forward lines instead of printing them"`
+	ForwardQueue      string        `arg:"--forward-queue,env:GOTAIL_FORWARD_QUEUE" help:"with --forward, keep lines in this file while the connection is down and send them once it is back, rather than dropping them"`
+	ForwardQueueSize  string        `arg:"--forward-queue-size,env:GOTAIL_FORWARD_QUEUE_SIZE" help:"the most --forward-queue holds, e.g. 64MB" default:"64MB"`
+	ForwardDrop       string        `arg:"--forward-drop,env:GOTAIL_FORWARD_DROP" help:"when --forward-queue is full, drop the newest lines or the oldest" default:"newest"`
+	SleepInterval     time.Duration `arg:"--sleep-interval,env:GOTAIL_SLEEP_INTERVAL" help:"with --backend poll, how often followed files are checked for changes, e.g. 500ms or, as for tail, 0.5" default:"250ms"`
+	RateCapacity      uint16        `arg:"--rate-capacity,env:GOTAIL_RATE_CAPACITY" help:"lines a followed file can send in a burst before following it pauses" default:"1000"`
+	RateInterval      time.Duration `arg:"--rate-interval,env:GOTAIL_RATE_INTERVAL" help:"how often room for another line is made once a followed file has used its burst" default:"1ms"`
+	ExitOnEOF         bool          `arg:"--exit-on-eof,env:GOTAIL_EXIT_ON_EOF" help:"when following, exit once all sources have been read to their end"`
+	MetricsAddr       string        `arg:"--metrics-addr,env:GOTAIL_METRICS_ADDR" help:"serve Prometheus metrics at /metrics on this address when following"`
+	MetricsTLSCert    string        `arg:"--metrics-tls-cert,env:GOTAIL_METRICS_TLS_CERT" help:"serve metrics over TLS with this PEM certificate"`
+	MetricsTLSKey     string        `arg:"--metrics-tls-key,env:GOTAIL_METRICS_TLS_KEY" help:"PEM private key for --metrics-tls-cert"`
+	MetricsClientCA   string        `arg:"--metrics-client-ca,env:GOTAIL_METRICS_CLIENT_CA" help:"with --metrics-tls-cert, require client certificates signed by a CA in this PEM file"`
+	MetricsToken      string        `arg:"--metrics-token,env:GOTAIL_METRICS_TOKEN" help:"require this token to fetch metrics, as a bearer token or basic auth password, given as is or as env:NAME or file:PATH"`
+	MetricsAllow      []string      `arg:"--metrics-allow,separate,env:GOTAIL_METRICS_ALLOW" help:"only serve metrics to clients from this address or network, e.g. 10.0.0.0/8"`
+	Stream            bool          `arg:"--stream,env:GOTAIL_STREAM" help:"when following, also serve lines as server-sent events at /lines on --metrics-addr, for one file with ?file=PATH"`
+	StreamReplay      int           `arg:"--stream-replay,env:GOTAIL_STREAM_REPLAY" help:"with --stream, keep this many of the last lines to send new subscribers before live ones, or fewer with ?replay=N"`
+	Profile           string        `arg:"--profile,env:GOTAIL_PROFILE" help:"use the settings of a named profile in the config file"`
+	Config            string        `arg:"--config,env:GOTAIL_CONFIG" help:"JSON config file with per-source settings, profiles, and flag defaults (default ~/.gotail.json)"`
+	Files             []string      `arg:"-f,--files,env:GOTAIL_FILES" help:"files to tail"`
+	Dirs              []string      `arg:"--dir,separate,env:GOTAIL_DIR" help:"tail the files in a directory, following new ones as they are created"`
 }
 
 func (args) Description() string {
 	return `This is an implementation of the tail utility. File patterns can be specified
-with one or more final arguments or as glob patterns with one or more -G parameters.
-If files are followed for new data the glob file list will be checked every 
-interval seconds. Initiate completion by running COMP_INSTALL=1 gotail
+after a command or with --files as paths or as quoted glob patterns. Commands are
+tail (the default), head, follow, serve (follow and serve lines with --stream),
+and agent (follow and forward lines with --forward-only), as in
+gotail follow -n 20 app.log. Flags are the same for all of them.
+If files are followed for new data the directories of glob patterns are watched
+for new files, or the patterns are checked every interval seconds. Initiate
+completion by running COMP_INSTALL=1 gotail
 `
 }
 
@@ -55,13 +179,51 @@ func (args) Version() string {
 	return sb.String()
 }
 
-// Args incoming arguments
+// Args incoming arguments, set by Parse
 var Args args
 
-func init() {
-	// Start off by gathering arguments
-	arg.MustParse(&Args)
+// Parse gather arguments into Args, exiting with usage information if they
+// are invalid. Most can also be set with GOTAIL_* environment variables, which
+// command line arguments override, and any can be given a default in the
+// config file. GNU tail spellings such as --lines=5 are accepted. Only the
+// command calls Parse; packages are given what they need from Args through
+// their own options.
+func Parse() {
+	argv, err := gnuArgs(os.Args[1:])
+	if err != nil {
+		p, _ := arg.NewParser(arg.Config{}, &Args)
+		p.Fail(err.Error())
+	}
+	argv = commandArgs(argv)
+	os.Args = append(os.Args[:1], argv...)
+	p := arg.MustParse(&Args)
+	if err := loadDefaults(argv); err != nil {
+		p.Fail(err.Error())
+	}
+	mode, ok := colourMode(Args.Colour)
+	if !ok {
+		p.Fail(fmt.Sprintf("invalid --color %q, expected always, auto, or never", Args.Colour))
+	}
+	Args.Colour = mode
+	if Args.NoColour {
+		Args.Colour = "never"
+	}
 	if Args.JSONOnly {
 		Args.JSON = true
 	}
 }
+
+// colourMode get the --color mode a value stands for, taking the words that
+// GOTAIL_COLOR has long taken to turn colour off as never
+func colourMode(value string) (mode string, ok bool) {
+	switch strings.ToLower(value) {
+	case "always", "true", "1", "yes", "on":
+		return "always", true
+	case "auto", "":
+		return "auto", true
+	case "never", "false", "0", "no", "off":
+		return "never", true
+	}
+
+	return "", false
+}
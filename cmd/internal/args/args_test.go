@@ -0,0 +1,174 @@
+package args
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/matryer/is"
+)
+
+func TestEnv(t *testing.T) {
+	is := is.New(t)
+
+	os.Setenv("GOTAIL_LINES", "25")
+	os.Setenv("GOTAIL_HASH_FIELDS", "user,ip")
+	os.Setenv("GOTAIL_STALL_WARNING", "10m")
+	os.Setenv("GOTAIL_MATCH", "error")
+	os.Setenv("GOTAIL_NO_COLOUR", "true")
+	os.Setenv("GOTAIL_CMD", `"journalctl -f -o cat",dmesg -w`)
+	defer func() {
+		for _, name := range []string{"GOTAIL_LINES", "GOTAIL_HASH_FIELDS", "GOTAIL_STALL_WARNING", "GOTAIL_MATCH", "GOTAIL_NO_COLOUR", "GOTAIL_CMD"} {
+			os.Unsetenv(name)
+		}
+	}()
+
+	var a args
+	p, err := arg.NewParser(arg.Config{}, &a)
+	is.NoErr(err)
+	// Command line arguments override the environment
+	is.NoErr(p.Parse([]string{"--match", "warn"}))
+
+	is.Equal(a.NumLines, "25")
+	is.Equal(a.HashFields, []string{"user", "ip"})
+	is.Equal(a.StallWarning, 10*time.Minute)
+	is.Equal(a.Match, "warn")
+	is.True(a.NoColour)
+	// Values holding commas are quoted
+	is.Equal(a.Commands, []string{"journalctl -f -o cat", "dmesg -w"})
+}
+
+func TestEnvForEveryFlag(t *testing.T) {
+	for _, v := range []interface{}{args{}, snapshot{}, diff{}, gen{}, bench{}} {
+		typ := reflect.TypeOf(v)
+		for i := 0; i < typ.NumField(); i++ {
+			tag := typ.Field(i).Tag.Get("arg")
+			if !strings.HasPrefix(tag, "-") {
+				continue
+			}
+			if !strings.Contains(tag, "env:GOTAIL_") {
+				t.Errorf("%s.%s has no GOTAIL_* environment variable", typ.Name(), typ.Field(i).Name)
+			}
+		}
+	}
+}
+
+func TestColourMode(t *testing.T) {
+	is := is.New(t)
+
+	for value, want := range map[string]string{"never": "never", "FALSE": "never", "always": "always", "": "auto"} {
+		mode, ok := colourMode(value)
+		is.True(ok)
+		is.Equal(mode, want)
+	}
+	_, ok := colourMode("sometimes")
+	is.True(!ok)
+}
+
+func TestGNUArgs(t *testing.T) {
+	is := is.New(t)
+
+	argv, err := gnuArgs([]string{"--lines=5", "--follow=name", "--silent", "--sleep-interval", "0.5", "--files", "a.log"})
+	is.NoErr(err)
+	is.Equal(argv, []string{"-n", "5", "-F", "--quiet", "--sleep-interval", "500ms", "--files", "a.log"})
+
+	argv, err = gnuArgs([]string{"--sleep-interval=2s"})
+	is.NoErr(err)
+	is.Equal(argv, []string{"--sleep-interval", "2s"})
+
+	argv, err = gnuArgs([]string{"--lines", "-20", "--follow", "--", "--silent"})
+	is.NoErr(err)
+	is.Equal(argv, []string{"-n", "20", "--follow", "--", "--silent"})
+
+	argv, err = gnuArgs([]string{"--bytes=-10k", "--bytes", "+5"})
+	is.NoErr(err)
+	is.Equal(argv, []string{"-c", "10k", "-c", "+5"})
+
+	_, err = gnuArgs([]string{"--bytes"})
+	is.True(err != nil)
+	_, err = gnuArgs([]string{"--follow=inode"})
+	is.True(err != nil)
+	_, err = gnuArgs([]string{"--lines"})
+	is.True(err != nil)
+}
+
+func TestVerbose(t *testing.T) {
+	is := is.New(t)
+
+	var a args
+	p, err := arg.NewParser(arg.Config{}, &a)
+	is.NoErr(err)
+	// -v prints headers as it does for tail, so excluding is only --exclude
+	is.NoErr(p.Parse([]string{"-v", "--exclude", "debug"}))
+	is.True(a.Verbose)
+	is.Equal(a.Excludes, []string{"debug"})
+}
+
+func TestCommandArgs(t *testing.T) {
+	is := is.New(t)
+
+	// Files without a command are tailed
+	is.Equal(commandArgs([]string{"-n", "5", "app.log", "-"}), []string{"-n", "5", "--files", "app.log", "-"})
+	is.Equal(commandArgs([]string{"tail", "app.log"}), []string{"--files", "app.log"})
+
+	// Commands stand for flags, and files are gathered with those of --files
+	is.Equal(commandArgs([]string{"follow", "-m", "error", "a.log", "--files", "b.log", "-j"}),
+		[]string{"-F", "-m", "error", "-j", "--files", "a.log", "b.log"})
+	is.Equal(commandArgs([]string{"head", "-n", "+5", "a.log"}), []string{"-H", "-n", "+5", "--files", "a.log"})
+	is.Equal(commandArgs([]string{"agent", "--forward", "host:514", "a.log"}),
+		[]string{"-F", "--forward-only", "--forward", "host:514", "--files", "a.log"})
+	// A command after a file is a file
+	is.Equal(commandArgs([]string{"a.log", "head"}), []string{"--files", "a.log", "head"})
+	is.Equal(commandArgs([]string{"--", "-odd.log"}), []string{"--files", "-odd.log"})
+
+	// Subcommands with their own flags are left to the parser
+	argv := []string{"-n", "5", "snapshot", "a.log", "--tar", "x.tar"}
+	is.Equal(commandArgs(argv), argv)
+	is.Equal(commandArgs([]string{"-C", "--files", "a.log"}), []string{"-C", "--files", "a.log"})
+
+	// The result parses
+	var a args
+	p, err := arg.NewParser(arg.Config{}, &a)
+	is.NoErr(err)
+	is.NoErr(p.Parse(commandArgs([]string{"serve", "--metrics-addr", ":9090", "a.log", "b.log"})))
+	is.True(a.FollowName && a.Stream)
+	is.Equal(a.Files, []string{"a.log", "b.log"})
+}
+
+func TestDefaults(t *testing.T) {
+	is := is.New(t)
+	defer func() { Args = args{} }()
+
+	os.Setenv("GOTAIL_INTERVAL", "7")
+	defer os.Unsetenv("GOTAIL_INTERVAL")
+
+	var defaults map[string]interface{}
+	is.NoErr(json.Unmarshal([]byte(`{
+		"C": true, "i": 2, "rate-capacity": 500, "match": "error",
+		"highlight": ["red:ERROR", "yellow:WARN"], "files": ["a.log", "b.log"]
+	}`), &defaults))
+
+	argv := []string{"-m", "warn", "-f"}
+	p, err := arg.NewParser(arg.Config{}, &Args)
+	is.NoErr(err)
+	is.NoErr(p.Parse(argv))
+	is.NoErr(applyDefaults(argv, defaults))
+
+	is.True(Args.NoColour)
+	is.Equal(Args.RateCapacity, uint16(500))
+	is.Equal(Args.Highlights, []string{"red:ERROR", "yellow:WARN"})
+	// -f is --follow, so files still have their default
+	is.True(Args.Follow)
+	is.Equal(Args.Files, []string{"a.log", "b.log"})
+	// The command line and environment come before defaults
+	is.Equal(Args.Match, "warn")
+	is.Equal(Args.Interval, uint(7))
+
+	is.True(applyDefaults(nil, map[string]interface{}{"no-such-flag": true}) != nil)
+	is.True(applyDefaults(nil, map[string]interface{}{"match": []interface{}{"a", "b"}}) != nil)
+	is.True(applyDefaults(nil, map[string]interface{}{"rate-interval": 5.0}) != nil)
+}
@@ -0,0 +1,106 @@
+package args
+
+import (
+	"reflect"
+	"strings"
+)
+
+/*
+	Commands say what a run is for. gotail tail, head and follow print files
+	as gotail does with no flags, -H, and -F, gotail serve follows files and
+	serves their lines with --stream, and gotail agent follows files and
+	forwards their lines without printing them. Flags are shared by all of
+	them, and files are given after the command rather than with --files, as
+	in gotail follow -n 20 app.log. Files given without a command are tailed,
+	so gotail app.log is the same as gotail tail app.log. Subcommands with
+	flags of their own, such as gen and bench, are left to the parser.
+*/
+
+// commandFlags the flags each command stands for
+var commandFlags = map[string][]string{
+	"tail":   nil,
+	"head":   {"-H"},
+	"follow": {"-F"},
+	"serve":  {"-F", "--stream"},
+	"agent":  {"-F", "--forward-only"},
+}
+
+// parserCommands subcommands handled by the parser, which take their own
+// arguments
+var parserCommands = map[string]bool{
+	"snapshot": true,
+	"diff":     true,
+	"gen":      true,
+	"bench":    true,
+}
+
+// valueFlags get the flags that take a value, which is the argument after
+// them unless it is joined with =. A name used by more than one field has the
+// meaning of the first, as with the parser.
+func valueFlags() map[string]bool {
+	flags := make(map[string]bool)
+	t := reflect.TypeOf(args{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Type.Kind() == reflect.Ptr {
+			continue
+		}
+		for _, name := range strings.Split(field.Tag.Get("arg"), ",") {
+			if !strings.HasPrefix(name, "-") {
+				continue
+			}
+			if _, ok := flags[name]; !ok {
+				flags[name] = field.Type.Kind() != reflect.Bool
+			}
+		}
+	}
+
+	return flags
+}
+
+// commandArgs translate a command and the files after it in argv into flags.
+// Files are gathered with any given with --files into one --files at the end,
+// as a repeated --files replaces the one before.
+func commandArgs(argv []string) []string {
+	takesValue := valueFlags()
+
+	var flags, files []string
+	var command string
+	var inFiles bool // whether arguments are values of --files
+	for i := 0; i < len(argv); i++ {
+		a := argv[i]
+		switch {
+		case a == "--":
+			files = append(files, argv[i+1:]...)
+			i = len(argv)
+		case a == "--files":
+			inFiles = true
+		case strings.HasPrefix(a, "-") && a != "-":
+			inFiles = false
+			flags = append(flags, a)
+			if takesValue[a] && i+1 < len(argv) {
+				i++
+				flags = append(flags, argv[i])
+			}
+		case inFiles || command != "" || len(files) > 0:
+			files = append(files, a)
+		case parserCommands[a]:
+			// The parser takes the rest
+			return argv
+		default:
+			// The first argument that isn't a flag is a command or a file
+			if extra, ok := commandFlags[a]; ok {
+				command = a
+				flags = append(flags, extra...)
+				continue
+			}
+			files = append(files, a)
+		}
+	}
+	if len(files) > 0 {
+		flags = append(flags, "--files")
+		flags = append(flags, files...)
+	}
+
+	return flags
+}
@@ -0,0 +1,185 @@
+package args
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alexflint/go-arg"
+	"github.com/imarsman/gotail/internal/config"
+)
+
+/*
+	The config file can give defaults for flags under "defaults", named by a
+	flag without its dashes, such as "C": true, "i": 2, or "rate-capacity":
+	500. Flags that can be given more than once take a list. A default is only
+	used when its flag isn't given on the command line and isn't set with its
+	GOTAIL_* environment variable, so the command line comes first, then the
+	environment, then the config file. A profile can be used by default with
+	"profile". Defaults aren't used with --strict, whose output is always that
+	of tail and head.
+*/
+
+// argField a field of args and the names of its flag
+type argField struct {
+	index    int
+	names    []string // the flag's names with their dashes
+	env      string   // its environment variable, if any
+	list     bool     // whether the flag takes more than one value
+	separate bool     // whether each value is given with a flag of its own
+}
+
+// argFields get the fields of args with flags by the flag names without their
+// dashes
+func argFields() map[string]argField {
+	fields := make(map[string]argField)
+	t := reflect.TypeOf(args{})
+	for i := 0; i < t.NumField(); i++ {
+		field := argField{index: i, list: t.Field(i).Type.Kind() == reflect.Slice}
+		for _, part := range strings.Split(t.Field(i).Tag.Get("arg"), ",") {
+			switch {
+			case strings.HasPrefix(part, "-"):
+				field.names = append(field.names, part)
+			case strings.HasPrefix(part, "env:"):
+				field.env = strings.TrimPrefix(part, "env:")
+			case part == "separate":
+				field.separate = true
+			}
+		}
+		for _, name := range field.names {
+			if _, ok := fields[strings.TrimLeft(name, "-")]; !ok {
+				fields[strings.TrimLeft(name, "-")] = field
+			}
+		}
+	}
+
+	return fields
+}
+
+// givenFlags get the names without dashes of the flags in argv
+func givenFlags(argv []string) map[string]bool {
+	given := make(map[string]bool)
+	for _, a := range argv {
+		if a == "--" {
+			break
+		}
+		if !strings.HasPrefix(a, "-") || a == "-" {
+			continue
+		}
+		name := strings.TrimLeft(a, "-")
+		if eq := strings.Index(name, "="); eq >= 0 {
+			name = name[:eq]
+		}
+		given[name] = true
+	}
+
+	return given
+}
+
+// defaultValue get a default from the config file as it is given after a flag
+func defaultValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+
+	return "", fmt.Errorf("unsupported value %v", value)
+}
+
+// applyDefaults set flags from defaults in the config file where they weren't
+// given in argv or the environment
+func applyDefaults(argv []string, defaults map[string]interface{}) error {
+	if len(defaults) == 0 {
+		return nil
+	}
+	fields := argFields()
+	given := givenFlags(argv)
+
+	names := make([]string, 0, len(defaults))
+	for name := range defaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Defaults are parsed as flags into args of their own, so that they are
+	// read as flags are, then copied to Args
+	var defaultArgv []string
+	var used []argField
+	for _, name := range names {
+		field, ok := fields[name]
+		if !ok {
+			return fmt.Errorf("config defaults: unknown flag %q", name)
+		}
+		flag := "--" + name
+		if len(name) == 1 {
+			flag = "-" + name
+		}
+		values, isList := defaults[name].([]interface{})
+		if isList && !field.list {
+			return fmt.Errorf("config defaults: %s takes one value", name)
+		}
+		if !isList {
+			values = []interface{}{defaults[name]}
+		}
+		if field.list && !field.separate {
+			defaultArgv = append(defaultArgv, flag)
+		}
+		for _, value := range values {
+			v, err := defaultValue(value)
+			if err != nil {
+				return fmt.Errorf("config defaults: %s: %v", name, err)
+			}
+			if field.list && !field.separate {
+				defaultArgv = append(defaultArgv, v)
+			} else {
+				defaultArgv = append(defaultArgv, flag+"="+v)
+			}
+		}
+
+		_, skip := os.LookupEnv(field.env)
+		skip = skip && field.env != ""
+		for _, n := range field.names {
+			// A name shared with an earlier field, as -f is, is that field's
+			n = strings.TrimLeft(n, "-")
+			skip = skip || given[n] && fields[n].index == field.index
+		}
+		if !skip {
+			used = append(used, field)
+		}
+	}
+
+	var d args
+	p, err := arg.NewParser(arg.Config{}, &d)
+	if err != nil {
+		return err
+	}
+	if err = p.Parse(defaultArgv); err != nil {
+		return fmt.Errorf("config defaults: %v", err)
+	}
+	for _, field := range used {
+		reflect.ValueOf(&Args).Elem().Field(field.index).Set(reflect.ValueOf(d).Field(field.index))
+	}
+
+	return nil
+}
+
+// loadDefaults apply the defaults in the config file, if there is one
+func loadDefaults(argv []string) error {
+	path := config.Path(Args.Config)
+	if path == "" || Args.Strict {
+		return nil
+	}
+	c, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+
+	return applyDefaults(argv, c.Defaults)
+}
@@ -0,0 +1,91 @@
+package args
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	GNU tail spells some options differently than gotail does. Those spellings
+	are translated to gotail's own before arguments are parsed so that scripts
+	written for tail keep working. Short options such as -n, -c, -f, -F, -q,
+	and -v mean the same in both so are left as they are.
+*/
+
+// gnuValue split a --name=value argument, taking the value from the next
+// argument if it isn't joined. The number of arguments used is returned.
+func gnuValue(argv []string, i int, name string) (value string, used int, err error) {
+	if strings.HasPrefix(argv[i], name+"=") {
+		return strings.TrimPrefix(argv[i], name+"="), 1, nil
+	}
+	if i+1 >= len(argv) {
+		return "", 0, fmt.Errorf("%s requires a value", name)
+	}
+
+	return argv[i+1], 2, nil
+}
+
+// gnuArgs translate GNU tail options in argv to gotail's. Arguments after --
+// are left as they are.
+func gnuArgs(argv []string) (translated []string, err error) {
+	for i := 0; i < len(argv); i++ {
+		a := argv[i]
+		name := a
+		if eq := strings.Index(a, "="); eq > 0 && strings.HasPrefix(a, "--") {
+			name = a[:eq]
+		}
+
+		switch name {
+		case "--":
+			return append(translated, argv[i:]...), nil
+		case "--lines", "--bytes":
+			value, used, err := gnuValue(argv, i, name)
+			if err != nil {
+				return nil, err
+			}
+			i += used - 1
+			flag := "-n"
+			if name == "--bytes" {
+				flag = "-c"
+			}
+			// tail takes -5 as the last 5 lines or bytes, as does 5
+			translated = append(translated, flag, strings.TrimPrefix(value, "-"))
+		case "--follow":
+			if name == a {
+				translated = append(translated, a)
+				continue
+			}
+			switch value := strings.TrimPrefix(a, name+"="); value {
+			case "descriptor":
+				translated = append(translated, "--follow")
+			case "name":
+				translated = append(translated, "-F")
+			default:
+				return nil, fmt.Errorf("invalid --follow value %q, expected name or descriptor", value)
+			}
+		case "--silent":
+			translated = append(translated, "--quiet")
+		case "--sleep-interval":
+			value, used, err := gnuValue(argv, i, name)
+			if err != nil {
+				return nil, err
+			}
+			i += used - 1
+			// tail takes a number of seconds, which may have a fraction, where
+			// gotail takes a duration such as 500ms
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+				if seconds < 0 {
+					return nil, fmt.Errorf("invalid --sleep-interval value %q", value)
+				}
+				value = time.Duration(seconds * float64(time.Second)).String()
+			}
+			translated = append(translated, "--sleep-interval", value)
+		default:
+			translated = append(translated, a)
+		}
+	}
+
+	return
+}
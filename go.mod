@@ -3,12 +3,16 @@ module github.com/imarsman/gotail
 go 1.16
 
 require (
-	github.com/TylerBrock/colorjson v0.0.0-20200706003622-8a50f05110d2
 	github.com/alexflint/go-arg v1.4.2
 	github.com/fatih/color v1.13.0
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/hokaccha/go-prettyjson v0.0.0-20211117102719-0474bc63780f // indirect
 	github.com/jwalton/gchalk v1.1.0
+	github.com/klauspost/compress v1.15.0
 	github.com/matryer/is v1.4.0
 	github.com/nxadm/tail v1.4.8
 	github.com/posener/complete/v2 v2.0.1-alpha.13
+	github.com/yuin/gopher-lua v1.1.0
+	golang.org/x/sys v0.0.0-20210630005230-0f9fa26af87c
+	golang.org/x/term v0.0.0-20210220032956-6a3ed077a48d
 )
@@ -0,0 +1,322 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+	The config file is JSON and is read from the path given with --config or,
+	failing that, from ~/.gotail.json if it exists. Per-source settings are
+	matched against a file's path using a glob pattern so that one session can
+	follow files with differing formats. For example
+
+	{
+	  "sources": [
+	    {"path": "/var/log/iis/*.log", "encoding": "utf-16le"},
+	    {"path": "*.json.log", "levelfield": "level"},
+	    {"path": "/var/log/app/*.log", "multiline": "^\\d{4}-\\d{2}-\\d{2}"},
+	    {"path": "/var/log/java/*.log", "timeformat": "2006-01-02 15:04:05"},
+	    {"path": "api.log", "colour": "cyan", "label": "API"}
+	  ],
+	  "profiles": {
+	    "nginx": {"format": "access", "match": " (4|5)\\d\\d ", "files": ["/var/log/nginx/*.log"]},
+	    "audit": {"hashfields": ["user"], "hashkey": "file:/etc/gotail/hash.key"}
+	  },
+	  "rules": [
+	    {"name": "oom", "match": "Out of memory|OOMKilled", "colour": "red"},
+	    {"name": "slow", "match": "took \\d{4,}ms"},
+	    {"name": "5xx", "match": "\" 5\\d\\d ", "count": 10, "window": "1m"}
+	  ],
+	  "notify": {"webhook": "https://hooks.example.com/gotail", "command": "logger -t gotail"},
+	  "defaults": {"C": true, "i": 2, "j": true, "rate-capacity": 500, "highlight": ["red:ERROR"]}
+	}
+
+	A profile is selected with --profile and supplies settings for flags that
+	were not given. Lines matching a rule are printed with the rule's name
+	before them. A rule with a count and window is also an alert, raised when
+	more lines than the count match within the window while following. Alerts
+	are written to stderr and sent to the webhook and command under notify.
+	Defaults are used for flags, named without their dashes, that aren't given
+	on the command line or in the environment.
+*/
+
+// Source settings for files whose path matches Path
+type Source struct {
+	Path        string `json:"path"`        // glob pattern matched against full path or base name
+	Encoding    string `json:"encoding"`    // utf-8 (default), utf-16le (or utf-16), or utf-16be
+	Multiline   string `json:"multiline"`   // regex matching the first line of a record
+	TimeFormat  string `json:"timeformat"`  // Go time layout for the timestamp starting a record
+	LevelField  string `json:"levelfield"`  // JSON field holding the log level
+	Compression string `json:"compression"` // command output compression: auto (default), gzip, bzip2, zstd, or none
+	Colour      string `json:"colour"`      // header colour: green, yellow, blue (default), red, cyan, magenta, white, or none
+	Label       string `json:"label"`       // short name shown in headers in place of the path
+	Host        string `json:"host"`        // machine the lines come from, shown with --host-column
+
+	multilineRegexp *regexp.Regexp
+}
+
+// Profile settings bundled under a name so that a common setup can be used
+// with --profile NAME
+type Profile struct {
+	Format     string   `json:"format"`     // format hint: auto, json, logfmt, access, or plain
+	Match      string   `json:"match"`      // regex lines must match to be printed
+	JSON       bool     `json:"json"`       // format and colourize JSON in lines
+	JSONOnly   bool     `json:"jsononly"`   // print only the JSON in lines
+	HashFields []string `json:"hashfields"` // fields whose values are hashed
+	HashKey    string   `json:"hashkey"`    // key for hashes, best given as env:NAME or file:PATH
+	Files      []string `json:"files"`      // files followed when no sources are given
+	Commands   []string `json:"commands"`   // commands followed when no sources are given
+}
+
+// Rule a named regex, with lines that match it printed with the name
+type Rule struct {
+	Name   string `json:"name"`   // name printed before matching lines
+	Match  string `json:"match"`  // regex lines match
+	Colour string `json:"colour"` // colour of the name, as for a source
+	Count  int    `json:"count"`  // alert when more lines than this match within Window
+	Window string `json:"window"` // duration matches are counted over, such as 1m
+
+	window time.Duration
+}
+
+// WindowDuration get the duration matches are counted over for an alert, or 0
+// if the rule isn't an alert
+func (r *Rule) WindowDuration() time.Duration {
+	return r.window
+}
+
+// Notify where alerts are sent as well as standard error
+type Notify struct {
+	Webhook string `json:"webhook"` // URL alerts are posted to as JSON objects
+	Command string `json:"command"` // command run with the system shell for each alert
+}
+
+// Config the contents of the config file
+type Config struct {
+	Sources  []*Source              `json:"sources"`
+	Profiles map[string]*Profile    `json:"profiles"`
+	Rules    []*Rule                `json:"rules"`
+	Notify   *Notify                `json:"notify"`
+	Defaults map[string]interface{} `json:"defaults"`
+}
+
+// Current the config in use for this run
+var Current = new(Config)
+
+// defaultSource used when no source settings match a path
+var defaultSource = new(Source)
+
+// Path get the path of the config file to use, which is path if it isn't
+// empty, or else ~/.gotail.json if it exists. It is empty if there is none.
+func Path(path string) string {
+	if path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	path = filepath.Join(home, ".gotail.json")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+
+	return path
+}
+
+// Init load the config file at path into Current. If path is empty
+// ~/.gotail.json is used if it exists.
+func Init(path string) (err error) {
+	path = Path(path)
+	if path == "" {
+		return nil
+	}
+
+	c, err := Load(path)
+	if err != nil {
+		return
+	}
+	Current = c
+
+	return
+}
+
+// Load read and validate a config file
+func Load(path string) (c *Config, err error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	c = new(Config)
+	err = json.Unmarshal(bytes, c)
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %v", path, err)
+	}
+
+	for _, s := range c.Sources {
+		if _, err = filepath.Match(s.Path, ""); err != nil {
+			return nil, fmt.Errorf("config %s: bad path pattern %q: %v", path, s.Path, err)
+		}
+		switch strings.ToLower(s.Encoding) {
+		case "", "utf-8", "utf8", "utf-16", "utf16", "utf-16le", "utf16le", "utf-16be", "utf16be":
+		default:
+			return nil, fmt.Errorf("config %s: unsupported encoding %q", path, s.Encoding)
+		}
+		switch strings.ToLower(s.Compression) {
+		case "", "auto", "none", "gzip", "gz", "bzip2", "bz2", "zstd", "zst":
+		default:
+			return nil, fmt.Errorf("config %s: unsupported compression %q", path, s.Compression)
+		}
+		switch strings.ToLower(s.Colour) {
+		case "", "green", "yellow", "blue", "red", "cyan", "magenta", "white", "none":
+		default:
+			return nil, fmt.Errorf("config %s: unsupported colour %q", path, s.Colour)
+		}
+		if s.Multiline != "" {
+			s.multilineRegexp, err = regexp.Compile(s.Multiline)
+			if err != nil {
+				return nil, fmt.Errorf("config %s: bad multiline regex %q: %v", path, s.Multiline, err)
+			}
+		}
+	}
+	for name, p := range c.Profiles {
+		if p == nil {
+			return nil, fmt.Errorf("config %s: profile %q is empty", path, name)
+		}
+		if _, err = regexp.Compile(p.Match); err != nil {
+			return nil, fmt.Errorf("config %s: profile %q: bad match regex %q: %v", path, name, p.Match, err)
+		}
+	}
+	for _, r := range c.Rules {
+		if r == nil || r.Name == "" || r.Match == "" {
+			return nil, fmt.Errorf("config %s: rules need a name and a match regex", path)
+		}
+		if _, err = regexp.Compile(r.Match); err != nil {
+			return nil, fmt.Errorf("config %s: rule %q: bad match regex %q: %v", path, r.Name, r.Match, err)
+		}
+		switch strings.ToLower(r.Colour) {
+		case "", "green", "yellow", "blue", "red", "cyan", "magenta", "white", "none":
+		default:
+			return nil, fmt.Errorf("config %s: rule %q: unsupported colour %q", path, r.Name, r.Colour)
+		}
+		if r.Count != 0 || r.Window != "" {
+			if r.window, err = time.ParseDuration(r.Window); err != nil || r.window <= 0 || r.Count < 1 {
+				return nil, fmt.Errorf("config %s: rule %q: alerts need a count of at least 1 and a window such as 1m", path, r.Name)
+			}
+		}
+	}
+	if n := c.Notify; n != nil && n.Webhook != "" {
+		if u, err := url.Parse(n.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("config %s: notify webhook %q is not an http or https URL", path, n.Webhook)
+		}
+	}
+
+	return
+}
+
+// Profile get the named profile
+func (c *Config) Profile(name string) (*Profile, error) {
+	p, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("no profile %q in config", name)
+	}
+
+	return p, nil
+}
+
+// ProfileNames get the names of profiles in sorted order
+func (c *Config) ProfileNames() (names []string) {
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return
+}
+
+// ForPath get the settings for the first source matching path. A source with
+// default settings is returned if none match.
+func (c *Config) ForPath(path string) *Source {
+	for _, s := range c.Sources {
+		if ok, _ := filepath.Match(s.Path, path); ok {
+			return s
+		}
+		if ok, _ := filepath.Match(s.Path, filepath.Base(path)); ok {
+			return s
+		}
+	}
+
+	return defaultSource
+}
+
+// ForPath get the settings for path from the current config
+func ForPath(path string) *Source {
+	return Current.ForPath(path)
+}
+
+// IsMultiline whether lines are to be joined into records
+func (s *Source) IsMultiline() bool {
+	return s.multilineRegexp != nil || s.TimeFormat != ""
+}
+
+// IsUTF16 whether lines are UTF-16 encoded
+func (s *Source) IsUTF16() bool {
+	switch strings.ToLower(s.Encoding) {
+	case "utf-16", "utf16", "utf-16le", "utf16le", "utf-16be", "utf16be":
+		return true
+	}
+	return false
+}
+
+// StartsRecord check if line is the first line of a record. Without multiline
+// settings every line is a record.
+func (s *Source) StartsRecord(line string) bool {
+	if s.multilineRegexp != nil {
+		return s.multilineRegexp.MatchString(line)
+	}
+	if s.TimeFormat != "" {
+		_, ok := ParseTime(s.TimeFormat, line, time.UTC)
+		return ok
+	}
+
+	return true
+}
+
+// timeSlack how much longer a formatted time can be than its layout, as when
+// the layout has Jan and the month is September or has Z07:00 and the zone is
+// Z, making the time shorter
+const timeSlack = 16
+
+// ParseTime parse the time at the start of text with layout, taking a time
+// without a zone as being in loc. The formatted time can be longer or shorter
+// than the layout, so each prefix of text that ends before a character that
+// can't continue the time is tried, longest first.
+func ParseTime(layout, text string, loc *time.Location) (time.Time, bool) {
+	n := len(layout) + timeSlack
+	if n > len(text) {
+		n = len(text)
+	}
+	for ; n > 0; n-- {
+		if n < len(text) && isTimeChar(text[n]) {
+			continue
+		}
+		if t, err := time.ParseInLocation(layout, text[:n], loc); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// isTimeChar whether c can be part of a word or number in a formatted time
+func isTimeChar(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestForPath(t *testing.T) {
+	is := is.New(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gotail.json")
+	err := os.WriteFile(path, []byte(`{"sources": [{"path": "*.log", "encoding": "utf-16le", "multiline": "^\\d"}]}`), 0644)
+	is.NoErr(err)
+
+	c, err := Load(path)
+	is.NoErr(err)
+
+	s := c.ForPath("/var/log/iis/u_ex221119.log")
+	is.Equal(s.Encoding, "utf-16le")
+	is.True(s.IsMultiline())
+	is.True(s.StartsRecord("2022-11-19 21:19:19 GET /"))
+	is.True(!s.StartsRecord("    at com.example.Main"))
+
+	s = c.ForPath("/var/log/app.txt")
+	is.True(!s.IsMultiline())
+}
+
+func TestProfiles(t *testing.T) {
+	is := is.New(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gotail.json")
+	err := os.WriteFile(path, []byte(`{"profiles": {"nginx": {"format": "access", "match": " 5\\d\\d "}, "k8s-json": {"json": true}}}`), 0644)
+	is.NoErr(err)
+
+	c, err := Load(path)
+	is.NoErr(err)
+	is.Equal(c.ProfileNames(), []string{"k8s-json", "nginx"})
+
+	p, err := c.Profile("nginx")
+	is.NoErr(err)
+	is.Equal(p.Format, "access")
+	is.Equal(p.Match, ` 5\d\d `)
+
+	_, err = c.Profile("missing")
+	is.True(err != nil)
+
+	err = os.WriteFile(path, []byte(`{"profiles": {"bad": {"match": "("}}}`), 0644)
+	is.NoErr(err)
+	_, err = Load(path)
+	is.True(err != nil)
+}
+
+func TestDecoder(t *testing.T) {
+	is := is.New(t)
+
+	// The lines of utf-16le "\ufeff上海\r\nhi\n" split on the newline byte.
+	// The first byte of 上 (U+4E0A) is the newline byte.
+	le := (&Source{Encoding: "utf-16le"}).NewDecoder()
+	is.Equal(le.Lines("\xff\xfe"), nil)
+	is.Equal(le.Lines("N\x77m\r\x00"), nil)
+	is.Equal(le.Lines("\x00h\x00i\x00"), []string{"上海"})
+	// The last line is held until flushed
+	is.Equal(le.Flush(), []string{"hi"})
+	is.Equal(le.Lines("\x00"), nil)
+	is.Equal(le.Flush(), []string{""})
+
+	be := (&Source{Encoding: "utf-16be"}).NewDecoder()
+	is.Equal(be.Lines("\x00h\x00i\x00"), []string{"hi"})
+	is.Equal(be.Lines("\x00h\x00i\x00"), []string{"hi"})
+
+	plain := (&Source{}).NewDecoder()
+	is.Equal(plain.Lines("hi"), []string{"hi"})
+}
+
+func TestNewReader(t *testing.T) {
+	is := is.New(t)
+
+	le := &Source{Encoding: "utf-16le"}
+	text, err := io.ReadAll(le.NewReader(iotest.OneByteReader(strings.NewReader("\xff\xfe\x0aN\x77m\r\x00\n\x00=\xd8\x00\xde\n\x00"))))
+	is.NoErr(err)
+	is.Equal(string(text), "上海\r\n😀\n")
+
+	be := &Source{Encoding: "utf-16be"}
+	text, err = io.ReadAll(be.NewReader(strings.NewReader("\x4e\x0a\x00\n")))
+	is.NoErr(err)
+	is.Equal(string(text), "上\n")
+
+	is.Equal(le.LineEnd([]byte("\x0aN\n\x00h\x00")), 4)
+	is.Equal(le.LineEnd([]byte("\x0aN")), 0)
+	is.Equal((&Source{}).LineEnd([]byte("a\nb")), 2)
+}
+
+func TestParseTime(t *testing.T) {
+	is := is.New(t)
+
+	s := &Source{TimeFormat: "2006-01-02T15:04:05Z07:00"}
+	is.True(s.StartsRecord("2024-01-02T03:04:05Z a"))
+	is.True(s.StartsRecord("2024-01-02T03:04:05+01:00 a"))
+	is.True(!s.StartsRecord("  at a"))
+
+	tm, ok := ParseTime("January 2 15:04:05", "May 30 01:02:03 host", time.UTC)
+	is.True(ok)
+	is.Equal(tm.Month(), time.May)
+}
+
+func TestRules(t *testing.T) {
+	is := is.New(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gotail.json")
+	err := os.WriteFile(path, []byte(`{"rules": [{"name": "oom", "match": "OOM"}, {"name": "5xx", "match": " 5\\d\\d ", "count": 10, "window": "1m"}], "notify": {"webhook": "https://hooks.example.com/x"}}`), 0644)
+	is.NoErr(err)
+
+	c, err := Load(path)
+	is.NoErr(err)
+	is.Equal(c.Rules[0].WindowDuration(), time.Duration(0))
+	is.Equal(c.Rules[1].WindowDuration(), time.Minute)
+	is.Equal(c.Notify.Webhook, "https://hooks.example.com/x")
+}
+
+func TestLoadBadConfig(t *testing.T) {
+	is := is.New(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gotail.json")
+	err := os.WriteFile(path, []byte(`{"sources": [{"path": "*.log", "encoding": "latin-1"}]}`), 0644)
+	is.NoErr(err)
+
+	_, err = Load(path)
+	is.True(err != nil)
+
+	err = os.WriteFile(path, []byte(`{"sources": [{"path": "*.log", "colour": "orange"}]}`), 0644)
+	is.NoErr(err)
+
+	_, err = Load(path)
+	is.True(err != nil)
+
+	err = os.WriteFile(path, []byte(`{"rules": [{"name": "oom", "match": "("}]}`), 0644)
+	is.NoErr(err)
+
+	_, err = Load(path)
+	is.True(err != nil)
+
+	err = os.WriteFile(path, []byte(`{"rules": [{"match": "OOM"}]}`), 0644)
+	is.NoErr(err)
+
+	_, err = Load(path)
+	is.True(err != nil)
+
+	err = os.WriteFile(path, []byte(`{"rules": [{"name": "5xx", "match": " 5\\d\\d ", "count": 10}]}`), 0644)
+	is.NoErr(err)
+
+	_, err = Load(path)
+	is.True(err != nil)
+
+	err = os.WriteFile(path, []byte(`{"notify": {"webhook": "hooks.example.com"}}`), 0644)
+	is.NoErr(err)
+
+	_, err = Load(path)
+	is.True(err != nil)
+}
+
+func TestResolveSecret(t *testing.T) {
+	is := is.New(t)
+
+	os.Setenv("GOTAIL_TEST_SECRET", "from-env")
+	defer os.Unsetenv("GOTAIL_TEST_SECRET")
+	path := filepath.Join(t.TempDir(), "key")
+	is.NoErr(os.WriteFile(path, []byte("from-file\n"), 0600))
+
+	secret, err := ResolveSecret("env:GOTAIL_TEST_SECRET")
+	is.NoErr(err)
+	is.Equal(secret, "from-env")
+
+	secret, err = ResolveSecret("file:" + path)
+	is.NoErr(err)
+	is.Equal(secret, "from-file")
+
+	secret, err = ResolveSecret("plain")
+	is.NoErr(err)
+	is.Equal(secret, "plain")
+
+	_, err = ResolveSecret("env:GOTAIL_TEST_UNSET")
+	is.True(err != nil)
+	_, err = ResolveSecret("file:" + filepath.Join(t.TempDir(), "missing"))
+	is.True(err != nil)
+}
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+/*
+	UTF-16 text can't be split into lines on the newline byte as UTF-8 can. A
+	newline is a two-byte unit, and the newline byte is also one half of many
+	other characters, such as U+4E0A, whose little endian bytes are 0a 4e.
+	Streams that gotail reads itself are decoded to UTF-8 before being split
+	into lines. Lines from the tail package, which splits on the newline byte,
+	are joined back together and split on whole newline units by a Decoder.
+	The second byte of a little endian newline comes at the start of the next
+	line from the tail package, so the decoder holds a line back until the
+	next one comes or it is flushed when no more have come for a while.
+*/
+
+// bigEndian whether UTF-16 text is big endian. UTF-16 without a byte order is
+// taken as little endian as Windows writes it.
+func (s *Source) bigEndian() bool {
+	switch strings.ToLower(s.Encoding) {
+	case "utf-16be", "utf16be":
+		return true
+	}
+	return false
+}
+
+// unit get the UTF-16 unit of the two bytes at the start of b
+func (s *Source) unit(b []byte) uint16 {
+	if s.bigEndian() {
+		return uint16(b[0])<<8 | uint16(b[1])
+	}
+	return uint16(b[1])<<8 | uint16(b[0])
+}
+
+// decodeUnits convert UTF-16 bytes into UTF-8, dropping an odd last byte. A
+// byte order mark is removed if start is set.
+func (s *Source) decodeUnits(b []byte, start bool) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, s.unit(b[i:]))
+	}
+	if start && len(units) > 0 && units[0] == 0xfeff {
+		units = units[1:]
+	}
+
+	return string(utf16.Decode(units))
+}
+
+// NewReader get a reader of the text of reader as UTF-8. Text in UTF-8 is read
+// as it is.
+func (s *Source) NewReader(reader io.Reader) io.Reader {
+	if !s.IsUTF16() {
+		return reader
+	}
+
+	return &utf16Reader{source: s, reader: reader, start: true}
+}
+
+// utf16Reader decode UTF-16 text from reader into UTF-8
+type utf16Reader struct {
+	source  *Source
+	reader  io.Reader
+	raw     []byte // bytes read and not yet decoded
+	decoded []byte // text decoded and not yet read
+	start   bool   // whether nothing has been decoded yet
+	err     error
+}
+
+// Read read decoded text
+func (r *utf16Reader) Read(p []byte) (int, error) {
+	buf := make([]byte, 4096)
+	for len(r.decoded) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		n, err := r.reader.Read(buf)
+		r.raw = append(r.raw, buf[:n]...)
+		r.err = err
+
+		// Keep a part unit, or the first half of a surrogate pair, for the
+		// next read unless there is nothing more to read
+		end := len(r.raw) &^ 1
+		if err != nil {
+			end = len(r.raw)
+		} else if end >= 2 {
+			if u := r.source.unit(r.raw[end-2:]); u >= 0xd800 && u < 0xdc00 {
+				end -= 2
+			}
+		}
+		r.decoded = append(r.decoded, r.source.decodeUnits(r.raw[:end], r.start)...)
+		if end > 0 {
+			r.start = false
+		}
+		r.raw = r.raw[end:]
+	}
+	n := copy(p, r.decoded)
+	r.decoded = r.decoded[n:]
+
+	return n, nil
+}
+
+// Decoder decode the lines of a source that were split on the newline byte
+type Decoder struct {
+	source   *Source
+	raw      []byte // bytes of a UTF-16 line not yet ended with a newline
+	start    bool   // whether no lines have been decoded yet
+	dropZero bool   // whether the next line starts with the rest of a newline
+}
+
+// NewDecoder get a decoder for the lines of a stream from the source
+func (s *Source) NewDecoder() *Decoder {
+	return &Decoder{source: s, start: true}
+}
+
+// Lines decode a line that was followed by the newline byte, giving the lines
+// it completes. A UTF-8 line is given as it is. A UTF-16 line can complete no
+// lines, if the newline byte was part of another character, or more than one.
+func (d *Decoder) Lines(line string) (lines []string) {
+	if !d.source.IsUTF16() {
+		return []string{line}
+	}
+
+	if d.dropZero {
+		d.dropZero = false
+		line = strings.TrimPrefix(line, "\x00")
+	}
+	d.raw = append(d.raw, line...)
+	d.raw = append(d.raw, '\n')
+	for {
+		end := -1
+		for i := 0; i+1 < len(d.raw); i += 2 {
+			if d.source.unit(d.raw[i:]) == '\n' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			break
+		}
+		lines = append(lines, d.decode(d.raw[:end]))
+		d.raw = d.raw[end+2:]
+	}
+
+	return
+}
+
+// Flush get the line held back waiting for the second byte of a little endian
+// newline, which only comes with the line after it. Call it when no lines
+// have come for a while, as lines are written whole so the newline byte
+// ending them all is a newline.
+func (d *Decoder) Flush() (lines []string) {
+	if len(d.raw)%2 == 0 || d.raw[len(d.raw)-1] != '\n' || d.source.bigEndian() {
+		return
+	}
+	lines = append(lines, d.decode(d.raw[:len(d.raw)-1]))
+	d.raw = d.raw[:0]
+	d.dropZero = true
+
+	return
+}
+
+// decode convert the bytes of a UTF-16 line into UTF-8
+func (d *Decoder) decode(b []byte) string {
+	text := d.source.decodeUnits(b, d.start)
+	d.start = false
+
+	return strings.TrimSuffix(text, "\r")
+}
+
+// LineEnd get the length of b through its last newline, or 0 if it has none.
+// b starts at the start of a line.
+func (s *Source) LineEnd(b []byte) int {
+	if !s.IsUTF16() {
+		return bytes.LastIndexByte(b, '\n') + 1
+	}
+
+	var end int
+	for i := 0; i+1 < len(b); i += 2 {
+		if s.unit(b[i:]) == '\n' {
+			end = i + 2
+		}
+	}
+
+	return end
+}
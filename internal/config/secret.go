@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+/*
+	Secrets such as the key for --hash-field can be given as a reference to
+	where they are kept so that they don't have to be written on the command
+	line, where other users can see them, or in the config file. A value of
+	env:NAME is read from the environment variable NAME and file:PATH from the
+	file at PATH, without a final newline. Other values are used as they are.
+*/
+
+// ResolveSecret get the secret value refers to
+func ResolveSecret(value string) (secret string, err error) {
+	switch {
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("secret environment variable %s is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, "file:"):
+		path := strings.TrimPrefix(value, "file:")
+		bytes, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("secret file: %v", err)
+		}
+		return strings.TrimRight(string(bytes), "\r\n"), nil
+	}
+
+	return value, nil
+}
@@ -0,0 +1,79 @@
+package input
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/imarsman/gotail/internal/config"
+)
+
+// ContainerCommand get the command that runs tail inside a container for a
+// NAME:/path/file.log spec. The runtime is docker, podman, nerdctl, or kubectl.
+// The name returned is used in place of a path for headers and config lookups.
+func ContainerCommand(containerRuntime, spec string, head, startAtOffset, follow bool, linesWanted int) (name string, command []string, err error) {
+	i := strings.Index(spec, ":")
+	if i < 1 || i == len(spec)-1 {
+		err = fmt.Errorf("invalid container source %q, expected NAME:/path/file", spec)
+		return
+	}
+	container, path := spec[:i], spec[i+1:]
+	name = spec
+
+	// Build the command to run inside the container. Lines are selected again
+	// by GetCommandLines so an offset is applied there.
+	var inner []string
+	switch {
+	case startAtOffset:
+		inner = []string{"cat", path}
+	case head:
+		inner = []string{"head", "-n", strconv.Itoa(linesWanted), path}
+	case follow:
+		inner = []string{"tail", "-n", strconv.Itoa(linesWanted), "-F", path}
+	default:
+		inner = []string{"tail", "-n", strconv.Itoa(linesWanted), path}
+	}
+
+	switch containerRuntime {
+	case "docker", "podman", "nerdctl":
+		command = append([]string{containerRuntime, "exec", container}, inner...)
+	case "kubectl":
+		command = append([]string{containerRuntime, "exec", container, "--"}, inner...)
+	default:
+		err = fmt.Errorf("unsupported container runtime %q", containerRuntime)
+	}
+
+	return
+}
+
+// ShellCommand get the command to run a --cmd source with the system shell
+func ShellCommand(line string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C", line}
+	}
+	return []string{"sh", "-c", line}
+}
+
+// GetCommandLines run command and get lines from its output as GetLines does
+// for a file. The name is used to look up config file settings. Compressed
+// output is decompressed.
+func GetCommandLines(name string, command []string, head, startAtOffset bool, linesWanted int) (lines []string, totalLines int, err error) {
+	out, err := exec.Command(command[0], command[1:]...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			err = fmt.Errorf("%s: %s", name, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return
+	}
+
+	reader, err := Decompress(bytes.NewReader(out), config.ForPath(name).Compression)
+	if err != nil {
+		err = fmt.Errorf("%s: %v", name, err)
+		return
+	}
+
+	return getLines(reader, name, head, startAtOffset, linesWanted)
+}
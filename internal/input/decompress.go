@@ -0,0 +1,74 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// compressedExtensions compression for file name extensions
+var compressedExtensions = map[string]string{
+	".gz":  "gzip",
+	".bz2": "bzip2",
+	".zst": "zstd",
+}
+
+// FileCompression get the compression of the file at path from its extension,
+// or an empty string if it isn't compressed
+func FileCompression(path string) string {
+	return compressedExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// Decompress wrap reader to decompress its stream. The compression can be
+// gzip, bzip2, zstd, none, or auto (or empty) to detect compression from the
+// first bytes of the stream. A zstd reader is also an io.Closer, which should
+// be closed to release its resources.
+func Decompress(reader io.Reader, compression string) (io.Reader, error) {
+	buffered := bufio.NewReader(reader)
+
+	compression = strings.ToLower(compression)
+	if compression == "" || compression == "auto" {
+		// An error here means a short or empty stream, which is not compressed
+		magic, _ := buffered.Peek(len(zstdMagic))
+		switch {
+		case bytes.HasPrefix(magic, gzipMagic):
+			compression = "gzip"
+		case bytes.HasPrefix(magic, bzip2Magic):
+			compression = "bzip2"
+		case bytes.HasPrefix(magic, zstdMagic):
+			compression = "zstd"
+		default:
+			compression = "none"
+		}
+	}
+
+	switch compression {
+	case "none":
+		return buffered, nil
+	case "gzip", "gz":
+		return gzip.NewReader(buffered)
+	case "bzip2", "bz2":
+		return bzip2.NewReader(buffered), nil
+	case "zstd", "zst":
+		decoder, err := zstd.NewReader(buffered, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unknown compression %q", compression)
+	}
+}
@@ -0,0 +1,43 @@
+package input
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+/*
+	Descriptors given with --fd are inherited from the parent process and are
+	read in place of a path. Process supervisors pass pipes, and socket
+	activation passes sockets that are already listening, from descriptor 3
+	on. Anything but a socket is read as a stream, as standard input is.
+*/
+
+// FdName get the name used in place of a path for inherited descriptor n
+func FdName(n int) string {
+	return "fd:" + strconv.Itoa(n)
+}
+
+// OpenFd get inherited descriptor n as a file, along with the kind of file it
+// is. An error is returned if it isn't open.
+func OpenFd(n int) (file *os.File, kind Kind, err error) {
+	if n < 0 {
+		return nil, Other, fmt.Errorf("invalid descriptor %d", n)
+	}
+	file = os.NewFile(uintptr(n), FdName(n))
+	if file == nil {
+		return nil, Other, fmt.Errorf("invalid descriptor %d", n)
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, Other, fmt.Errorf("descriptor %d is not open", n)
+	}
+
+	return file, Probe(fi), nil
+}
+
+// FdLines get lines from an inherited descriptor as GetLines does from
+// standard input
+func FdLines(file *os.File, head, startAtOffset bool, linesWanted int) (lines []string, totalLines int, err error) {
+	return readLines(file, file.Name(), head, startAtOffset, linesWanted)
+}
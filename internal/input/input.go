@@ -0,0 +1,208 @@
+package input
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/imarsman/gotail/internal/config"
+)
+
+// maxInitialLines the most lines room is made for before any are read
+const maxInitialLines = 4096
+
+// GetLines get linesWanted lines or start gathering lines at linesWanted if
+// head is true and startAtOffset is true. Return lines as a string slice.
+// Return an error if for instance a filename is incorrect. Lines are decoded
+// and joined into records according to any config file settings for path.
+// A tail of a file is read backward from its end, in which case totalLines is
+// -1 if the file is too long for all of it to have been read. Standard input
+// is read for a path of -.
+func GetLines(path string, head, startAtOffset bool, linesWanted int) (lines []string, totalLines int, err error) {
+	if path == "-" {
+		lines, totalLines, err = getLines(os.Stdin, path, head, startAtOffset, linesWanted)
+		if err != nil {
+			err = fmt.Errorf("standard input: %v", err)
+		}
+	} else {
+		lines, totalLines, err = FileLines(path, head, startAtOffset, linesWanted)
+	}
+	if err != nil {
+		// Something wrong like bad file path or a read error
+		fmt.Fprintln(os.Stderr, err.Error())
+	}
+
+	return
+}
+
+// NewDecoder get a decoder for the lines of the file at path as the tail
+// package splits them, decoding them as the config file says to for the path
+func NewDecoder(path string) *config.Decoder {
+	return config.ForPath(path).NewDecoder()
+}
+
+// FileLines get lines from the file at path as described for GetLines. Unlike
+// GetLines stdin is never read, even for a path of -.
+func FileLines(path string, head, startAtOffset bool, linesWanted int) (lines []string, totalLines int, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return
+	}
+	// A byte range is read as it is in the file, which compressed files can't
+	// be as their offsets are in the compressed data
+	if Ranged() {
+		if FileCompression(path) != "" {
+			return nil, 0, fmt.Errorf("%s: a byte range can't be read from a compressed file", path)
+		}
+		reader, err := rangeReader(file)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %v", path, err)
+		}
+		return readLines(reader, path, head, startAtOffset, linesWanted)
+	}
+	if ReadStrategy(path, Probe(fi), head) == ReverseSeek {
+		return tailLines(file, fi.Size(), linesWanted)
+	}
+
+	// Compressed files are read from the start as they are decompressed
+	if compression := FileCompression(path); compression != "" {
+		reader, err := Decompress(file, compression)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %v", path, err)
+		}
+		if closer, ok := reader.(io.Closer); ok {
+			defer closer.Close()
+		}
+		return readLines(reader, path, head, startAtOffset, linesWanted)
+	}
+
+	return readLines(file, path, head, startAtOffset, linesWanted)
+}
+
+// FileTail get the last linesWanted lines of the file at path as FileLines
+// does, along with the offset in the file the lines read end at, so that the
+// file can be followed from there without a line being missed or read twice
+func FileTail(path string, linesWanted int) (lines []string, end int64, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return
+	}
+	// Lines added after the size is taken are left for following
+	end = fi.Size()
+	if ReadStrategy(path, Probe(fi), false) == ReverseSeek {
+		lines, _, err = tailLines(file, end, linesWanted)
+		return
+	}
+	var reader io.Reader = io.NewSectionReader(file, 0, end)
+	if compression := FileCompression(path); compression != "" {
+		if reader, err = Decompress(reader, compression); err != nil {
+			return nil, 0, fmt.Errorf("%s: %v", path, err)
+		}
+		if closer, ok := reader.(io.Closer); ok {
+			defer closer.Close()
+		}
+	}
+	lines, _, err = readLines(reader, path, false, false, linesWanted)
+
+	return
+}
+
+// readLines get lines from the file at path as getLines does, giving the path
+// with any error
+func readLines(reader io.Reader, path string, head, startAtOffset bool, linesWanted int) (lines []string, totalLines int, err error) {
+	lines, totalLines, err = getLines(reader, path, head, startAtOffset, linesWanted)
+	if err != nil {
+		err = fmt.Errorf("%s: %v", path, err)
+	}
+
+	return
+}
+
+// getLines get lines from reader as described for GetLines. The path is used
+// to look up config file settings.
+func getLines(reader io.Reader, path string, head, startAtOffset bool, linesWanted int) (lines []string, totalLines int, err error) {
+	name := path
+	if path == "-" {
+		name = "standard input"
+	}
+	source := config.ForPath(path)
+	lineScanner := NewScanner(name, source.NewReader(reader))
+
+	// Use a slice the capacity of the number of lines wanted, up to a limit as
+	// far more lines can be asked for than a source has. In the case of offset
+	// from head this will be less efficient as re-allocation will be done.
+	capacity := linesWanted
+	if capacity > maxInitialLines {
+		capacity = maxInitialLines
+	}
+	lines = make([]string, 0, capacity)
+
+	scanner := newRecordScanner(lineScanner, source)
+
+	// Get head lines and return. Easiest option as we don't need to use slice
+	// tricks to get last lines.
+	if head {
+		// Handle starting at offset, get lines, then return
+		if startAtOffset {
+			totalLines = 1
+			for scanner.Scan() {
+				// Add to lines slice when in range
+				if totalLines >= linesWanted {
+					lines = append(lines, scanner.Text())
+				}
+				totalLines++
+			}
+			// scanner keeps track of non-EOF error
+			if scanner.Err() != nil {
+				return []string{}, totalLines, scanner.Err()
+			}
+
+			return lines, totalLines, nil
+		}
+		// not starting at offset so get head lines
+		totalLines = 0
+		for scanner.Scan() {
+			// Add to lines slice when in range
+			if totalLines < linesWanted {
+				lines = append(lines, scanner.Text())
+			}
+			totalLines++
+		}
+		// scanner keeps track of non-EOF error
+		if scanner.Err() != nil {
+			return []string{}, totalLines, scanner.Err()
+		}
+
+		return lines, totalLines, nil
+	}
+
+	// Get tail lines and return
+	totalLines = 0
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		totalLines++
+		// Add to lines slice when in range
+		if totalLines > linesWanted {
+			// Get rid of the first element to keep this a "last" slice
+			lines = lines[1:]
+		}
+	}
+	// scanner keeps track of non-EOF error
+	if scanner.Err() != nil {
+		return []string{}, totalLines, scanner.Err()
+	}
+
+	return
+}
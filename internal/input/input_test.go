@@ -0,0 +1,315 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var sampleDir = "../../sample"
+
+const (
+	bechmarkBytesPerOp int64 = 10
+)
+
+// Get some lines
+func TestGetLines(t *testing.T) {
+	lines, total, err := GetLines(sampleDir+"/1.txt", false, false, 10)
+	if err != nil {
+		t.Fail()
+	}
+	t.Log("lines", lines, "total", total)
+
+	// Asking for far more lines than there are doesn't allocate room for them
+	lines, _, err = GetLines(sampleDir+"/1.txt", true, false, 1<<30)
+	if err != nil || len(lines) == 0 || cap(lines) > maxInitialLines*2 {
+		t.Fatal("lines", len(lines), "capacity", cap(lines), err)
+	}
+}
+
+// go test -run=XXX -bench=. -benchmem
+// BenchmarkGetLines-12    659.9 ns/op    15.15 MB/s    363 B/op    3 allocs/op
+func BenchmarkGetLines(b *testing.B) {
+
+	var lines []string
+	var total int
+	var err error
+
+	b.SetBytes(bechmarkBytesPerOp)
+	b.ReportAllocs()
+	// Change rlimit prior to trying to run with this level of parallelism
+	b.SetParallelism(30)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			lines, total, err = GetLines(sampleDir+"/1.txt", false, false, 10)
+		}
+	})
+
+	if len(lines) == 0 {
+		b.Fail()
+	}
+	if total == 0 {
+		b.Fail()
+	}
+	if err != nil {
+		b.Fail()
+	}
+}
+
+func TestContainerCommand(t *testing.T) {
+	name, command, err := ContainerCommand("kubectl", "web-0:/var/log/app.log", false, false, true, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "web-0:/var/log/app.log" {
+		t.Errorf("unexpected name %s", name)
+	}
+	want := "kubectl exec web-0 -- tail -n 10 -F /var/log/app.log"
+	if got := strings.Join(command, " "); got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	_, _, err = ContainerCommand("docker", "web-0", false, false, true, 10)
+	if err == nil {
+		t.Error("expected error for spec without path")
+	}
+}
+
+func TestSocketAddress(t *testing.T) {
+	network, address, ok := SocketAddress("unix:///run/app.sock")
+	if !ok || network != "unix" || address != "/run/app.sock" {
+		t.Errorf("got %s %s %v", network, address, ok)
+	}
+	network, address, ok = SocketAddress("unixgram:///run/app.sock")
+	if !ok || network != "unixgram" || address != "/run/app.sock" {
+		t.Errorf("got %s %s %v", network, address, ok)
+	}
+	for _, name := range []string{"/var/log/app.log", "unix://", "tcp://localhost:514"} {
+		if _, _, ok := SocketAddress(name); ok {
+			t.Errorf("%s should not be a socket source", name)
+		}
+	}
+}
+
+func TestOpenFd(t *testing.T) {
+	if name := FdName(3); name != "fd:3" {
+		t.Errorf("got %s", name)
+	}
+	if _, _, err := OpenFd(-1); err == nil {
+		t.Error("a negative descriptor should not open")
+	}
+	if _, _, err := OpenFd(1 << 20); err == nil {
+		t.Error("a descriptor that isn't open should not open")
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write([]byte("one\ntwo\n"))
+	w.Close()
+
+	for _, compression := range []string{"auto", "gzip"} {
+		reader, err := Decompress(bytes.NewReader(compressed.Bytes()), compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != "one\ntwo\n" {
+			t.Errorf("got %q for %s", out, compression)
+		}
+	}
+
+	// Uncompressed input is passed through
+	reader, err := Decompress(strings.NewReader("plain\n"), "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := ioutil.ReadAll(reader)
+	if string(out) != "plain\n" {
+		t.Errorf("got %q", out)
+	}
+}
+
+func TestCompressedFileLines(t *testing.T) {
+	dir := t.TempDir()
+	var text strings.Builder
+	for i := 1; i <= 20; i++ {
+		fmt.Fprintf(&text, "line %d\n", i)
+	}
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(text.String()))
+	gw.Close()
+
+	var zst bytes.Buffer
+	zw, err := zstd.NewWriter(&zst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw.Write([]byte(text.String()))
+	zw.Close()
+
+	for name, data := range map[string][]byte{"app.log.1.gz": gz.Bytes(), "app.log.2.zst": zst.Bytes()} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		lines, total, err := FileLines(path, false, false, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 20 || strings.Join(lines, ",") != "line 19,line 20" {
+			t.Errorf("got %v of %d for %s", lines, total, name)
+		}
+	}
+
+	if FileCompression("app.log.3.BZ2") != "bzip2" || FileCompression("app.log") != "" {
+		t.Error("unexpected compression from extension")
+	}
+}
+
+func TestStrategy(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	ioutil.WriteFile(path, []byte("line\n"), 0644)
+
+	kind, err := ProbePath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind != Regular {
+		t.Errorf("got kind %d for a file", kind)
+	}
+	if kind, _ := ProbePath(dir); kind != Other {
+		t.Errorf("got kind %d for a directory", kind)
+	}
+
+	tests := []struct {
+		path         string
+		kind         Kind
+		head         bool
+		read, follow Strategy
+	}{
+		{"app.log", Regular, false, ReverseSeek, FileFollow},
+		{"app.log", Regular, true, FullScan, FileFollow},
+		{"app.log.1.gz", Regular, false, FullScan, NoFollow},
+		{"pipe", Pipe, false, FullScan, StreamFollow},
+		{"tty", CharDevice, false, FullScan, StreamFollow},
+		{"app.sock", Socket, false, FullScan, NoFollow},
+	}
+	for _, test := range tests {
+		if got := ReadStrategy(test.path, test.kind, test.head); got != test.read {
+			t.Errorf("ReadStrategy(%+v) = %d", test, got)
+		}
+		if got := FollowStrategy(test.path, test.kind); got != test.follow {
+			t.Errorf("FollowStrategy(%+v) = %d", test, got)
+		}
+	}
+}
+
+func TestTailLines(t *testing.T) {
+	defer func(size int) { reverseBlockSize = size }(reverseBlockSize)
+
+	contents := []string{"", "\n", "one", "one\n", "one\r\ntwo\r\n", "\n\nthree\n\n", "a\nbb\nccc\ndddd\neeeee\nffffff\n", "a\nbb\nccc\ndddd\neeeee\nffffff"}
+	dir := t.TempDir()
+	for _, blockSize := range []int{1, 2, 3, 7, 64 * 1024} {
+		reverseBlockSize = blockSize
+		for i, content := range contents {
+			path := filepath.Join(dir, fmt.Sprintf("%d.txt", i))
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			for _, wanted := range []int{0, 1, 2, 4, 10} {
+				want, wantTotal, _ := getLines(strings.NewReader(content), path, false, false, wanted)
+
+				file, err := os.Open(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, total, err := tailLines(file, int64(len(content)), wanted)
+				file.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if strings.Join(got, "|") != strings.Join(want, "|") || len(got) != len(want) {
+					t.Errorf("block %d content %q wanted %d: got %q want %q", blockSize, content, wanted, got, want)
+				}
+				if total != -1 && total != wantTotal {
+					t.Errorf("block %d content %q: got total %d want %d", blockSize, content, total, wantTotal)
+				}
+			}
+		}
+	}
+}
+
+func TestNewScanner(t *testing.T) {
+	defer SetMaxLineLength(maxLineLength)
+	SetMaxLineLength(8)
+
+	text := strings.Repeat("a", 100) + "\nshort\r\n" + strings.Repeat("é", 10) + "\nlast"
+	scanner := NewScanner("test", strings.NewReader(text))
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"aaaaaaaa", "short", "éééé", "last"}
+	if strings.Join(lines, ",") != strings.Join(want, ",") {
+		t.Errorf("got lines %q, want %q", lines, want)
+	}
+
+	if got := CutLine("test", strings.Repeat("é", 10)); got != "éééé" {
+		t.Errorf("CutLine got %q", got)
+	}
+}
+
+func TestScanLinesCut(t *testing.T) {
+	var cuts int
+	scanner := bufio.NewScanner(strings.NewReader(strings.Repeat("a", 20) + "\nok\n" + strings.Repeat("b", 30)))
+	scanner.Buffer(make([]byte, 0, 4), 8)
+	scanner.Split(scanLines(8, func() { cuts++ }))
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if cuts != 2 || strings.Join(lines, ",") != "aaaaaaaa,ok,bbbbbbbb" {
+		t.Errorf("got %d cuts and lines %q", cuts, lines)
+	}
+}
+
+func TestByteRange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	ioutil.WriteFile(path, []byte("one\ntwo\nthree\nfour\n"), 0644)
+
+	SetByteRange(4, 14)
+	defer SetByteRange(0, 0)
+	lines, total, err := FileLines(path, true, false, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || strings.Join(lines, ",") != "two,three" {
+		t.Errorf("got %v of %d", lines, total)
+	}
+	if before, err := LinesBefore(path); err != nil || before != 1 {
+		t.Errorf("got %d lines before the range, %v", before, err)
+	}
+}
@@ -0,0 +1,96 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/imarsman/gotail/internal/util"
+)
+
+// maxLineLength the longest line read in bytes. A bufio.Scanner fails on a
+// longer line, so longer lines are cut to this length and the rest skipped.
+var maxLineLength = 1024 * 1024
+
+// SetMaxLineLength set the longest line read in bytes. It must be called
+// before any lines are read.
+func SetMaxLineLength(n int) {
+	maxLineLength = n
+}
+
+// cutWarned sources already warned about for cut lines
+var cutWarned sync.Map
+
+// warnCut say on stderr, once for each source, that a line from it was cut
+func warnCut(name string) {
+	if _, warned := cutWarned.LoadOrStore(name, true); warned {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: lines longer than %s were cut, set --max-line-length to read more of them\n", name, util.FormatSize(int64(maxLineLength)))
+}
+
+// cutLength get the length of b cut to max bytes without splitting a character
+func cutLength(b []byte, max int) int {
+	if len(b) <= max {
+		return len(b)
+	}
+	n := max
+	for n > 0 && !utf8.RuneStart(b[n]) {
+		n--
+	}
+
+	return n
+}
+
+// CutLine cut text from the source name to the longest line read
+func CutLine(name, text string) string {
+	if len(text) <= maxLineLength {
+		return text
+	}
+	warnCut(name)
+
+	return text[:cutLength([]byte(text[:maxLineLength+1]), maxLineLength)]
+}
+
+// scanLines split lines as bufio.ScanLines does, cutting lines longer than max
+// and skipping the rest of them. cut is called for each line cut.
+func scanLines(max int, cut func()) bufio.SplitFunc {
+	var skipping bool
+
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if skipping {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				return len(data), nil, nil
+			}
+			skipping = false
+			return i + 1, nil, nil
+		}
+		advance, token, err = bufio.ScanLines(data, atEOF)
+		if advance == 0 && err == nil && len(data) >= max {
+			skipping = true
+			cut()
+			return len(data), data[:cutLength(data, max)], nil
+		}
+
+		return
+	}
+}
+
+// NewScanner get a scanner for the lines of reader, from the source name, that
+// cuts lines longer than the longest line read rather than fail
+func NewScanner(name string, reader io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(reader)
+	initial := 4096
+	if maxLineLength < initial {
+		initial = maxLineLength
+	}
+	scanner.Buffer(make([]byte, 0, initial), maxLineLength)
+	scanner.Split(scanLines(maxLineLength, func() { warnCut(name) }))
+
+	return scanner
+}
@@ -0,0 +1,137 @@
+package input
+
+import (
+	"io"
+	"os"
+
+	"github.com/imarsman/gotail/internal/config"
+)
+
+/*
+	What an input is decides how it can be read. Only a regular file can be
+	read backward from its end or followed by watching it for writes. Pipes,
+	sockets, and terminals can only be read as streams from where they are,
+	and reading them to their end uses them up. Compressed files have to be
+	read from the start and are not written to once compressed.
+*/
+
+// Kind the sort of file an input is
+type Kind int
+
+const (
+	// Regular a regular file
+	Regular Kind = iota
+	// Pipe a pipe or FIFO
+	Pipe
+	// Socket a unix socket
+	Socket
+	// CharDevice a terminal or other character device
+	CharDevice
+	// Other anything else, such as a directory
+	Other
+)
+
+// Strategy how lines are got from an input
+type Strategy int
+
+const (
+	// ReverseSeek read backward from the end for the last lines
+	ReverseSeek Strategy = iota
+	// FullScan read from the start to the end
+	FullScan
+	// FileFollow watch the file for lines written to it
+	FileFollow
+	// StreamFollow read lines as they arrive until the stream ends
+	StreamFollow
+	// NoFollow the input is not followed
+	NoFollow
+)
+
+// Probe get the kind of file described by fi
+func Probe(fi os.FileInfo) Kind {
+	mode := fi.Mode()
+	switch {
+	case mode.IsRegular():
+		return Regular
+	case mode&os.ModeNamedPipe != 0:
+		return Pipe
+	case mode&os.ModeSocket != 0:
+		return Socket
+	case mode&os.ModeCharDevice != 0:
+		return CharDevice
+	default:
+		return Other
+	}
+}
+
+// ProbePath get the kind of file at path
+func ProbePath(path string) (kind Kind, err error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	return Probe(fi), nil
+}
+
+// ProbeStdin get the kind of file standard input is. Pipes that aren't named,
+// such as from a shell pipeline, are Pipe.
+func ProbeStdin() Kind {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return Other
+	}
+
+	return Probe(fi)
+}
+
+// ReadStrategy get how to get the initial lines of an input of kind at path.
+// Only the tail of a regular file whose lines need no decoding, joining, or
+// decompressing can be read backward.
+func ReadStrategy(path string, kind Kind, head bool) Strategy {
+	if head || kind != Regular || FileCompression(path) != "" {
+		return FullScan
+	}
+	source := config.ForPath(path)
+	if source.IsMultiline() || source.IsUTF16() {
+		return FullScan
+	}
+
+	return ReverseSeek
+}
+
+// FollowStrategy get how to follow an input of kind at path. Unix sockets
+// can't be opened to be read, so they are listened on as unix:// sources.
+func FollowStrategy(path string, kind Kind) Strategy {
+	switch {
+	case kind == Regular && FileCompression(path) == "":
+		return FileFollow
+	case kind == Pipe || kind == CharDevice:
+		return StreamFollow
+	default:
+		return NoFollow
+	}
+}
+
+// stream a file opened when it is first read
+type stream struct {
+	path string
+	file *os.File
+}
+
+// OpenStream get a reader for the stream at path that opens it when it is
+// first read, as opening a named pipe waits until it is opened for writing
+func OpenStream(path string) io.Reader {
+	return &stream{path: path}
+}
+
+// Read open the file if needed and read from it
+func (s *stream) Read(p []byte) (n int, err error) {
+	if s.file == nil {
+		if s.file, err = os.Open(s.path); err != nil {
+			return
+		}
+	}
+
+	return s.file.Read(p)
+}
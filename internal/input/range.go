@@ -0,0 +1,63 @@
+package input
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+// byteStart and byteEnd the window of each file read, set with SetByteRange.
+// byteEnd is 0 to read to the end of the file.
+var byteStart, byteEnd int64
+
+// SetByteRange read only the bytes of files from start up to end, or to the
+// end of the file if end is 0. Lines cut by the window are read as far as it
+// goes. It must be called before any lines are read.
+func SetByteRange(start, end int64) {
+	byteStart, byteEnd = start, end
+}
+
+// Ranged whether reads are limited to a window set with SetByteRange
+func Ranged() bool {
+	return byteStart > 0 || byteEnd > 0
+}
+
+// rangeReader get a reader for the window of file
+func rangeReader(file *os.File) (io.Reader, error) {
+	if _, err := file.Seek(byteStart, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if byteEnd == 0 {
+		return file, nil
+	}
+
+	return io.LimitReader(file, byteEnd-byteStart), nil
+}
+
+// LinesBefore get the number of lines in the file at path that end before the
+// window set with SetByteRange, so that lines in it can be numbered as they
+// are in the file
+func LinesBefore(path string) (count int, err error) {
+	if byteStart == 0 {
+		return 0, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, 32*1024)
+	reader := io.LimitReader(file, byteStart)
+	for {
+		n, err := reader.Read(buf)
+		count += bytes.Count(buf[:n], []byte{'\n'})
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
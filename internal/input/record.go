@@ -0,0 +1,67 @@
+package input
+
+import (
+	"bufio"
+	"strings"
+
+	"github.com/imarsman/gotail/internal/config"
+)
+
+// recordScanner scan records of decoded lines, joining continuation lines onto the
+// record they belong to when the source has multiline settings.
+type recordScanner struct {
+	scanner     *bufio.Scanner
+	source      *config.Source
+	pending     string // start of the next record, already read
+	havePending bool
+	record      string
+}
+
+func newRecordScanner(scanner *bufio.Scanner, source *config.Source) *recordScanner {
+	return &recordScanner{scanner: scanner, source: source}
+}
+
+// Scan advance to the next record
+func (rs *recordScanner) Scan() bool {
+	if !rs.source.IsMultiline() {
+		if !rs.scanner.Scan() {
+			return false
+		}
+		rs.record = rs.scanner.Text()
+		return true
+	}
+
+	var builder strings.Builder
+	started := rs.havePending
+	if rs.havePending {
+		builder.WriteString(rs.pending)
+		rs.havePending = false
+	}
+	for rs.scanner.Scan() {
+		line := rs.scanner.Text()
+		// A new record starts so hold the line for the next call
+		if started && rs.source.StartsRecord(line) {
+			rs.pending = line
+			rs.havePending = true
+			break
+		}
+		if started {
+			builder.WriteString("\n")
+		}
+		builder.WriteString(line)
+		started = true
+	}
+	rs.record = builder.String()
+
+	return started
+}
+
+// Text the current record
+func (rs *recordScanner) Text() string {
+	return rs.record
+}
+
+// Err the first non-EOF error encountered
+func (rs *recordScanner) Err() error {
+	return rs.scanner.Err()
+}
@@ -0,0 +1,85 @@
+package input
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// reverseBlockSize the size of blocks read backward from the end of a file
+var reverseBlockSize = 64 * 1024
+
+// tailLines get the last linesWanted lines of the first size bytes of file by
+// reading blocks backward from there, so that only the end of a large file is
+// read. The total is the number of lines in the file if all of it had to be
+// read, otherwise -1 as the number is not known.
+func tailLines(file *os.File, size int64, linesWanted int) (lines []string, totalLines int, err error) {
+	offset := size
+
+	// Blocks read so far, last first, and the newlines in them
+	var blocks [][]byte
+	var newlines int
+	var trailingNewline bool
+	for offset > 0 {
+		blockSize := int64(reverseBlockSize)
+		if offset < blockSize {
+			blockSize = offset
+		}
+		offset -= blockSize
+
+		block := make([]byte, blockSize)
+		_, err = file.ReadAt(block, offset)
+		if err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+		err = nil
+		if len(blocks) == 0 && len(block) > 0 && block[len(block)-1] == '\n' {
+			trailingNewline = true
+		}
+		blocks = append(blocks, block)
+		newlines += bytes.Count(block, []byte{'\n'})
+
+		// The lines wanted are all read once the newline before the first of
+		// them is. A final line without a newline needs one fewer.
+		needed := linesWanted
+		if trailingNewline {
+			needed++
+		}
+		if newlines >= needed {
+			break
+		}
+	}
+
+	var data []byte
+	for i := len(blocks) - 1; i >= 0; i-- {
+		data = append(data, blocks[i]...)
+	}
+	if trailingNewline {
+		data = data[:len(data)-1]
+	}
+
+	var all [][]byte
+	if len(data) > 0 {
+		all = bytes.Split(data, []byte{'\n'})
+	} else if trailingNewline {
+		// A file holding only a newline has one empty line
+		all = [][]byte{{}}
+	}
+	if offset > 0 {
+		// The first line is only part of one
+		all = all[1:]
+		totalLines = -1
+	} else {
+		totalLines = len(all)
+	}
+	if len(all) > linesWanted {
+		all = all[len(all)-linesWanted:]
+	}
+
+	lines = make([]string, 0, len(all))
+	for _, line := range all {
+		lines = append(lines, CutLine(file.Name(), string(bytes.TrimSuffix(line, []byte{'\r'}))))
+	}
+
+	return
+}
@@ -0,0 +1,37 @@
+package input
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SocketAddress get the network and socket path for a unix:// (stream) or
+// unixgram:// (datagram) source. Return false if name is not a socket source.
+func SocketAddress(name string) (network, address string, ok bool) {
+	for _, network := range []string{"unix", "unixgram"} {
+		prefix := network + "://"
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			return network, name[len(prefix):], true
+		}
+	}
+
+	return
+}
+
+// RemoveStaleSocket remove a socket file left behind at path so that it can
+// be listened on again. Anything other than a socket is left alone.
+func RemoveStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,35 @@
+package util
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// clipboardCommands commands that copy standard input to the system
+// clipboard, in order of preference.
+var clipboardCommands = [][]string{
+	{"pbcopy"},
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+	{"clip.exe"},
+	{"clip"},
+}
+
+// CopyToClipboard copy text to the system clipboard using the first clipboard
+// command found in the path.
+func CopyToClipboard(text string) (err error) {
+	for _, command := range clipboardCommands {
+		path, err := exec.LookPath(command[0])
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(path, command[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+
+		return cmd.Run()
+	}
+
+	return errors.New("no clipboard command found")
+}
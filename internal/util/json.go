@@ -0,0 +1,134 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+// bufferPool reuses buffers for JSON that is indented for every line
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// IndentJSON indent json with its keys sorted, so that lines can be compared,
+// and numbers as they are written. If keepOrder is true keys are kept in the
+// order given and the JSON isn't decoded, which is much faster. An error is
+// returned if the JSON isn't valid.
+func IndentJSON(input string, keepOrder bool) (result string, err error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(buf)
+	buf.Reset()
+
+	if keepOrder {
+		if err = json.Indent(buf, []byte(input), "", "  "); err != nil {
+			return
+		}
+		return string(bytes.TrimSpace(buf.Bytes())), nil
+	}
+
+	var obj interface{}
+	decoder := json.NewDecoder(strings.NewReader(input))
+	decoder.UseNumber()
+	if err = decoder.Decode(&obj); err != nil {
+		return
+	}
+	encoder := json.NewEncoder(buf)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(obj); err != nil {
+		return
+	}
+
+	return string(bytes.TrimSpace(buf.Bytes())), nil
+}
+
+// CanonicalJSON write json on one line with its keys sorted, numbers as they
+// are written and no HTML escaping, so that the same JSON always gives the
+// same text. An error is returned if the JSON isn't valid.
+func CanonicalJSON(input string) (result string, err error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(buf)
+	buf.Reset()
+
+	var obj interface{}
+	decoder := json.NewDecoder(strings.NewReader(input))
+	decoder.UseNumber()
+	if err = decoder.Decode(&obj); err != nil {
+		return
+	}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err = encoder.Encode(obj); err != nil {
+		return
+	}
+
+	return string(bytes.TrimSpace(buf.Bytes())), nil
+}
+
+// Colours of the parts of JSON coloured by ColourJSON
+var (
+	jsonKeyColour    = color.New(color.FgHiBlue)
+	jsonStringColour = color.New(color.FgGreen)
+	jsonNumberColour = color.New(color.FgCyan)
+	jsonBoolColour   = color.New(color.FgYellow)
+	jsonNullColour   = color.New(color.FgHiBlack)
+)
+
+// ColourJSON indent json as IndentJSON does with its keys kept in order, and
+// colour its keys and values. JSON that is already indented keeps its key
+// order and numbers as they are. An error is returned if the JSON isn't
+// valid.
+func ColourJSON(input string) (result string, err error) {
+	indented, err := IndentJSON(input, true)
+	if err != nil {
+		return
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(indented) * 2)
+	for i := 0; i < len(indented); {
+		end := i + 1
+		var colour *color.Color
+		switch c := indented[i]; {
+		case c == '"':
+			for end < len(indented) && indented[end] != '"' {
+				if indented[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end++
+			// Indented keys are followed straight away by a colon
+			colour = jsonStringColour
+			if end < len(indented) && indented[end] == ':' {
+				colour = jsonKeyColour
+			}
+		case c == '-' || c >= '0' && c <= '9':
+			for end < len(indented) && strings.IndexByte("0123456789+-.eE", indented[end]) >= 0 {
+				end++
+			}
+			colour = jsonNumberColour
+		case c == 't' || c == 'f' || c == 'n':
+			for end < len(indented) && indented[end] >= 'a' && indented[end] <= 'z' {
+				end++
+			}
+			colour = jsonBoolColour
+			if c == 'n' {
+				colour = jsonNullColour
+			}
+		default:
+			sb.WriteByte(c)
+			i++
+			continue
+		}
+		sb.WriteString(colour.Sprint(indented[i:end]))
+		i = end
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,86 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/matryer/is"
+)
+
+func TestIndentJSON(t *testing.T) {
+	is := is.New(t)
+
+	// Keys are sorted and large numbers aren't rounded
+	result, err := IndentJSON(`{"b":1668892759600613277,"a":[1,2]} `, false)
+	is.NoErr(err)
+	is.Equal(result, "{\n  \"a\": [\n    1,\n    2\n  ],\n  \"b\": 1668892759600613277\n}")
+	// or kept in their order
+	result, err = IndentJSON(`{"b":1668892759600613277,"a":[1,2]} `, true)
+	is.NoErr(err)
+	is.Equal(result, "{\n  \"b\": 1668892759600613277,\n  \"a\": [\n    1,\n    2\n  ]\n}")
+
+	_, err = IndentJSON(`{"b":`, false)
+	is.True(err != nil)
+	_, err = IndentJSON(`{"b":`, true)
+	is.True(err != nil)
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	is := is.New(t)
+
+	result, err := CanonicalJSON(`{ "b": 1668892759600613277, "a": "<x>" }`)
+	is.NoErr(err)
+	is.Equal(result, `{"a":"<x>","b":1668892759600613277}`)
+
+	_, err = CanonicalJSON(`{"b":`)
+	is.True(err != nil)
+}
+
+func TestColourJSON(t *testing.T) {
+	is := is.New(t)
+
+	noColor := color.NoColor
+	color.NoColor = false
+	defer func() { color.NoColor = noColor }()
+
+	// Keys keep their order and numbers are as written, with only colour
+	// added to the indented JSON
+	input := `{"b":1668892759600613277,"a":["x \"y\"",true,null]}`
+	result, err := ColourJSON(input)
+	is.NoErr(err)
+	indented, err := IndentJSON(input, true)
+	is.NoErr(err)
+	is.True(result != indented)
+	is.Equal(regexp.MustCompile("\x1b\\[[0-9;]*m").ReplaceAllString(result, ""), indented)
+	is.True(strings.Contains(result, jsonKeyColour.Sprint(`"b"`)))
+	is.True(strings.Contains(result, jsonStringColour.Sprint(`"x \"y\""`)))
+
+	_, err = ColourJSON(`{"a":`)
+	is.True(err != nil)
+}
+
+// benchmarkJSON the JSON of a line of the kind gotail indents
+const benchmarkJSON = `{"Name":"997b2ae0","NodeID":"84cb91a8","TaskState":"running","TaskFailed":false,"TaskEvent":{"Type":"Started","Time":1668892759600613277,"Details":{}}}`
+
+// BenchmarkIndentJSON benchmark indenting the JSON in a line
+// Before, decoding and encoding:  6232 ns/op     24.23 MB/s    1768 B/op    34 allocs/op
+// After, with json.Indent:          546.9 ns/op  276.11 MB/s     208 B/op     1 allocs/op
+func BenchmarkIndentJSON(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkJSON)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		IndentJSON(benchmarkJSON, true)
+	}
+}
+
+// BenchmarkIndentJSONSorted benchmark indenting the JSON in a line with its
+// keys sorted, as is done by default
+func BenchmarkIndentJSONSorted(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkJSON)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		IndentJSON(benchmarkJSON, false)
+	}
+}
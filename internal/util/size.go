@@ -0,0 +1,66 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits multipliers for size suffixes. As with tail and other coreutils a
+// suffix alone or with iB is a power of 1024 and with B a power of 1000.
+var sizeUnits = map[string]int64{
+	"":    1,
+	"B":   1,
+	"K":   1 << 10,
+	"KIB": 1 << 10,
+	"KB":  1000,
+	"M":   1 << 20,
+	"MIB": 1 << 20,
+	"MB":  1000 * 1000,
+	"G":   1 << 30,
+	"GIB": 1 << 30,
+	"GB":  1000 * 1000 * 1000,
+	"T":   1 << 40,
+	"TIB": 1 << 40,
+	"TB":  1000 * 1000 * 1000 * 1000,
+}
+
+// ParseSize parse a whole number with an optional unit suffix such as 10k,
+// 256MB, or 2GiB. Suffixes are not case sensitive.
+func ParseSize(value string) (size int64, err error) {
+	s := strings.TrimSpace(value)
+	i := len(s)
+	for i > 0 && (s[i-1] < '0' || s[i-1] > '9') {
+		i--
+	}
+	multiplier, ok := sizeUnits[strings.ToUpper(strings.TrimSpace(s[i:]))]
+	if !ok || i == 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	n, err := strconv.ParseInt(s[:i], 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	if n > 0 && multiplier > (1<<63-1)/n {
+		return 0, fmt.Errorf("size %q is too large", value)
+	}
+
+	return n * multiplier, nil
+}
+
+// FormatSize format a number of bytes with the largest unit that is a power
+// of 1024 and leaves at least 1, such as 1.5MiB
+func FormatSize(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(size)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d%s", size, units[0])
+	}
+
+	return strconv.FormatFloat(value, 'f', 1, 64) + units[i]
+}
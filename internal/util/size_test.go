@@ -0,0 +1,36 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestParseSize(t *testing.T) {
+	is := is.New(t)
+
+	tests := []struct {
+		value string
+		size  int64
+	}{
+		{"10", 10},
+		{"1k", 1024},
+		{"2M", 2 << 20},
+		{"256MB", 256 * 1000 * 1000},
+		{"1GiB", 1 << 30},
+		{"10 KB", 10000},
+	}
+	for _, test := range tests {
+		size, err := ParseSize(test.value)
+		is.NoErr(err)
+		is.Equal(size, test.size)
+	}
+
+	for _, value := range []string{"", "MB", "1x", "-1", "1.5M", "9999999999T"} {
+		_, err := ParseSize(value)
+		is.True(err != nil)
+	}
+
+	is.Equal(FormatSize(512), "512B")
+	is.Equal(FormatSize(3<<19), "1.5MiB")
+}
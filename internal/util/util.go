@@ -0,0 +1,9 @@
+package util
+
+// Pluralize produce sigular or plural output depending on number value
+var Pluralize = func(singular, plural string, number int) string {
+	if number == 1 {
+		return singular
+	}
+	return plural
+}
@@ -0,0 +1,176 @@
+package gotail
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// subscriberLines number of lines a subscriber can fall behind by before new
+// lines are dropped for it
+const subscriberLines = 256
+
+// entry a line kept in a Buffer, numbered in the order lines were added so
+// that lines from different sources can be put back in that order
+type entry struct {
+	seq  uint64
+	line Line
+}
+
+// ring the most recent lines for a source. Once full the oldest line is
+// overwritten.
+type ring struct {
+	entries []entry
+	next    int
+	full    bool
+}
+
+// add add e, overwriting the oldest entry if the ring is full
+func (r *ring) add(e entry) {
+	r.entries[r.next] = e
+	r.next++
+	if r.next == len(r.entries) {
+		r.next, r.full = 0, true
+	}
+}
+
+// all get the entries from oldest to newest
+func (r *ring) all() []entry {
+	if !r.full {
+		return r.entries[:r.next]
+	}
+
+	return append(append([]entry{}, r.entries[r.next:]...), r.entries[:r.next]...)
+}
+
+// Buffer keep the last lines from each source and send new lines to
+// subscribers, so that programs embedding gotail can show recent history to
+// new viewers without reading files again. A Buffer is safe for concurrent
+// use.
+type Buffer struct {
+	mutex       sync.Mutex
+	size        int
+	seq         uint64
+	sources     map[string]*ring
+	subscribers map[*Subscription]bool
+}
+
+// NewBuffer get a buffer keeping the last size lines of each source
+func NewBuffer(size int) *Buffer {
+	if size <= 0 {
+		size = DefaultLines
+	}
+
+	return &Buffer{
+		size:        size,
+		sources:     map[string]*ring{},
+		subscribers: map[*Subscription]bool{},
+	}
+}
+
+// Add keep line and send it to subscribers
+func (b *Buffer) Add(line Line) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	r, ok := b.sources[line.Path]
+	if !ok {
+		r = &ring{entries: make([]entry, b.size)}
+		b.sources[line.Path] = r
+	}
+	b.seq++
+	r.add(entry{seq: b.seq, line: line})
+
+	// A subscriber that isn't keeping up misses lines rather than holding up
+	// every source
+	for s := range b.subscribers {
+		select {
+		case s.lines <- line:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// Feed add lines from c, such as the channel from Follow, until it is closed
+func (b *Buffer) Feed(c <-chan Line) {
+	for line := range c {
+		b.Add(line)
+	}
+}
+
+// Recent get the lines kept for path from oldest to newest
+func (b *Buffer) Recent(path string) []Line {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	r, ok := b.sources[path]
+	if !ok {
+		return nil
+	}
+
+	return lines(r.all())
+}
+
+// Subscribe get the lines kept for every source in the order they were added
+// along with a subscription that gets lines added from now on. No line is in
+// both. Close the subscription when done with it.
+func (b *Buffer) Subscribe() *Subscription {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var entries []entry
+	for _, r := range b.sources {
+		entries = append(entries, r.all()...)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].seq < entries[j].seq
+	})
+
+	s := &Subscription{
+		History: lines(entries),
+		lines:   make(chan Line, subscriberLines),
+		buffer:  b,
+	}
+	s.Lines = s.lines
+	b.subscribers[s] = true
+
+	return s
+}
+
+// lines get the lines in entries
+func lines(entries []entry) []Line {
+	result := make([]Line, len(entries))
+	for i, e := range entries {
+		result[i] = e.line
+	}
+
+	return result
+}
+
+// Subscription recent and new lines from a Buffer
+type Subscription struct {
+	History []Line      // lines kept when the subscription was made, oldest first
+	Lines   <-chan Line // lines added since, closed by Close
+
+	lines   chan Line
+	buffer  *Buffer
+	dropped uint64
+}
+
+// Dropped get the number of lines missed because they weren't received
+// quickly enough
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close stop sending lines to the subscription and close its channel
+func (s *Subscription) Close() {
+	s.buffer.mutex.Lock()
+	defer s.buffer.mutex.Unlock()
+
+	if s.buffer.subscribers[s] {
+		delete(s.buffer.subscribers, s)
+		close(s.lines)
+	}
+}
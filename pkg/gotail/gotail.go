@@ -0,0 +1,203 @@
+// Package gotail gathers the head or tail of a file and follows it for new
+// lines, for programs that want gotail's behaviour without running the
+// gotail command. Config file settings such as decoding and multiline records
+// apply as they do for the command.
+package gotail
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/imarsman/gotail/internal/input"
+	"github.com/imarsman/gotail/internal/util"
+	"github.com/nxadm/tail"
+)
+
+// DefaultLines number of lines gathered if Options.Lines is not set
+const DefaultLines = 10
+
+// flushInterval how often Follow sends a UTF-16 line held back waiting for
+// the line after it
+const flushInterval = 100 * time.Millisecond
+
+// afterRead called by Follow between reading the last lines and following,
+// for tests
+var afterRead = func() {}
+
+// Options settings for gathering and following lines
+type Options struct {
+	Lines    int            // number of lines, DefaultLines if zero
+	FromLine bool           // for Head, start at line Lines rather than stopping there
+	Match    *regexp.Regexp // only send lines that match
+	Exclude  *regexp.Regexp // don't send lines that match
+	JSON     bool           // indent JSON found in lines
+	Colour   bool           // with JSON, colour the indented JSON
+	Poll     bool           // for Follow, poll for changes rather than use notification
+}
+
+// Line a line from a file
+type Line struct {
+	Path string
+	Text string
+}
+
+// Tail send the last lines of the file at path on the returned channel, which
+// is closed after the last line.
+func Tail(path string, opts Options) (<-chan Line, error) {
+	lines, _, err := input.FileLines(path, false, false, opts.lines())
+	if err != nil {
+		return nil, err
+	}
+
+	return send(path, lines, opts), nil
+}
+
+// Head send the first lines of the file at path on the returned channel, or
+// the lines from line Options.Lines on if Options.FromLine is set. The channel
+// is closed after the last line.
+func Head(path string, opts Options) (<-chan Line, error) {
+	lines, _, err := input.FileLines(path, true, opts.FromLine, opts.lines())
+	if err != nil {
+		return nil, err
+	}
+
+	return send(path, lines, opts), nil
+}
+
+// Follow send the last lines of the file at path on the returned channel,
+// then lines as they are added. The file is reopened if it is rotated. The
+// channel is closed once ctx is done.
+func Follow(ctx context.Context, path string, opts Options) (<-chan Line, error) {
+	// Following starts where the last lines read end, so a line written in
+	// between is sent once
+	lines, end, err := input.FileTail(path, opts.lines())
+	if err != nil {
+		return nil, err
+	}
+	afterRead()
+
+	tf, err := tail.TailFile(path, tail.Config{
+		Follow: true, ReOpen: true, Location: &tail.SeekInfo{Offset: end, Whence: io.SeekStart},
+		Logger: tail.DiscardingLogger, Poll: opts.Poll},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lines are decoded as they are for the command, with a UTF-16 line held
+	// back by the decoder sent once no more have come for a while
+	decoder := input.NewDecoder(path)
+	c := make(chan Line)
+	go func() {
+		defer close(c)
+		defer tf.Cleanup()
+		defer tf.Stop()
+
+		sendAll := func(lines []string) bool {
+			for _, text := range lines {
+				if !opts.sendLine(ctx, c, path, text) {
+					return false
+				}
+			}
+			return true
+		}
+		if !sendAll(lines) {
+			return
+		}
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !sendAll(decoder.Flush()) {
+					return
+				}
+			case tl, ok := <-tf.Lines:
+				if !ok {
+					sendAll(decoder.Flush())
+					return
+				}
+				if tl.Err != nil {
+					continue
+				}
+				if !sendAll(decoder.Lines(tl.Text)) {
+					return
+				}
+			}
+		}
+	}()
+
+	return c, nil
+}
+
+// send send lines on a channel that is closed after the last one
+func send(path string, lines []string, opts Options) <-chan Line {
+	c := make(chan Line)
+	go func() {
+		defer close(c)
+		for _, text := range lines {
+			opts.sendLine(context.Background(), c, path, text)
+		}
+	}()
+
+	return c
+}
+
+// lines get the number of lines wanted
+func (opts Options) lines() int {
+	if opts.Lines <= 0 {
+		return DefaultLines
+	}
+
+	return opts.Lines
+}
+
+// sendLine send a line on c if it matches, formatting any JSON. False is
+// returned if ctx is done first.
+func (opts Options) sendLine(ctx context.Context, c chan<- Line, path, text string) bool {
+	if opts.Match != nil && !opts.Match.MatchString(text) {
+		return true
+	}
+	if opts.Exclude != nil && opts.Exclude.MatchString(text) {
+		return true
+	}
+	if opts.JSON {
+		text = formatJSON(text, opts.Colour)
+	}
+
+	select {
+	case c <- Line{Path: path, Text: text}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// formatJSON indent a JSON object starting at the first opening brace in
+// text, leaving any prefix as it is. Keys are kept in the order given and
+// numbers as they are written, with or without colour. Text without valid
+// JSON is returned as is.
+func formatJSON(text string, colour bool) string {
+	i := strings.IndexByte(text, '{')
+	if i < 0 {
+		return text
+	}
+	prefix, content := text[:i], text[i:]
+
+	formatted, err := util.IndentJSON(content, true)
+	if err != nil {
+		return text
+	}
+	if colour {
+		if formatted, err = util.ColourJSON(formatted); err != nil {
+			return text
+		}
+	}
+
+	return prefix + formatted
+}
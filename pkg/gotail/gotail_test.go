@@ -0,0 +1,170 @@
+package gotail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/matryer/is"
+)
+
+// collect gather the lines sent on c
+func collect(c <-chan Line) (texts []string) {
+	for line := range c {
+		texts = append(texts, line.Text)
+	}
+
+	return
+}
+
+func TestTailHead(t *testing.T) {
+	is := is.New(t)
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	os.WriteFile(path, []byte("1\n2\n3\n4\n5\n"), 0644)
+
+	c, err := Tail(path, Options{Lines: 2})
+	is.NoErr(err)
+	is.Equal(collect(c), []string{"4", "5"})
+
+	c, err = Head(path, Options{Lines: 2})
+	is.NoErr(err)
+	is.Equal(collect(c), []string{"1", "2"})
+
+	c, err = Head(path, Options{Lines: 4, FromLine: true})
+	is.NoErr(err)
+	is.Equal(collect(c), []string{"4", "5"})
+
+	c, err = Tail(path, Options{Match: regexp.MustCompile(`[24]`)})
+	is.NoErr(err)
+	is.Equal(collect(c), []string{"2", "4"})
+
+	c, err = Tail(path, Options{Match: regexp.MustCompile(`[24]`), Exclude: regexp.MustCompile(`4`)})
+	is.NoErr(err)
+	is.Equal(collect(c), []string{"2"})
+
+	_, err = Tail(filepath.Join(t.TempDir(), "missing.log"), Options{})
+	is.True(err != nil)
+}
+
+func TestFormatJSON(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(formatJSON(`app: {"a":1}`, false), "app: {\n  \"a\": 1\n}")
+	is.Equal(formatJSON(`app: {"a":`, false), `app: {"a":`)
+	is.Equal(formatJSON("plain", false), "plain")
+
+	// Colour keeps the key order and numbers of the indented JSON
+	noColor := color.NoColor
+	color.NoColor = false
+	defer func() { color.NoColor = noColor }()
+	coloured := formatJSON(`app: {"b":1668892759600613277,"a":1}`, true)
+	is.True(coloured != formatJSON(`app: {"b":1668892759600613277,"a":1}`, false))
+	is.Equal(regexp.MustCompile("\x1b\\[[0-9;]*m").ReplaceAllString(coloured, ""), "app: {\n  \"b\": 1668892759600613277,\n  \"a\": 1\n}")
+	is.Equal(formatJSON(`app: {"a":`, true), `app: {"a":`)
+}
+
+func TestFollow(t *testing.T) {
+	is := is.New(t)
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	os.WriteFile(path, []byte("1\n2\n"), 0644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := Follow(ctx, path, Options{Lines: 1, Poll: true})
+	is.NoErr(err)
+
+	is.Equal((<-c).Text, "2")
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	is.NoErr(err)
+	f.WriteString("3\n")
+	f.Close()
+
+	select {
+	case line := <-c:
+		is.Equal(line.Text, "3")
+		is.Equal(line.Path, path)
+	case <-time.After(5 * time.Second):
+		t.Fatal("followed line not sent")
+	}
+
+	cancel()
+	for range c {
+	}
+}
+
+func TestFollowLineWhileStarting(t *testing.T) {
+	is := is.New(t)
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	os.WriteFile(path, []byte("1\n2\n"), 0644)
+	appendLine := func(text string) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		is.NoErr(err)
+		f.WriteString(text + "\n")
+		f.Close()
+	}
+
+	// A line written after the last lines are read and before following
+	// starts is sent once
+	afterRead = func() { appendLine("3") }
+	defer func() { afterRead = func() {} }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := Follow(ctx, path, Options{Lines: 1, Poll: true})
+	is.NoErr(err)
+	appendLine("4")
+
+	var texts []string
+	for len(texts) < 3 {
+		select {
+		case line := <-c:
+			texts = append(texts, line.Text)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("followed lines not sent, got %v", texts)
+		}
+	}
+	is.Equal(texts, []string{"2", "3", "4"})
+
+	cancel()
+	for range c {
+	}
+}
+
+func TestBuffer(t *testing.T) {
+	is := is.New(t)
+
+	b := NewBuffer(2)
+	for _, line := range []Line{{"a", "1"}, {"b", "1"}, {"a", "2"}, {"a", "3"}} {
+		b.Add(line)
+	}
+	is.Equal(b.Recent("a"), []Line{{"a", "2"}, {"a", "3"}})
+	is.Equal(b.Recent("c"), []Line(nil))
+
+	s := b.Subscribe()
+	is.Equal(s.History, []Line{{"b", "1"}, {"a", "2"}, {"a", "3"}})
+
+	b.Add(Line{"b", "2"})
+	is.Equal(<-s.Lines, Line{"b", "2"})
+
+	// Lines are dropped for a subscriber that falls behind
+	for i := 0; i < subscriberLines+5; i++ {
+		b.Add(Line{"a", "x"})
+	}
+	is.Equal(s.Dropped(), uint64(5))
+
+	s.Close()
+	s.Close()
+	n := 0
+	for range s.Lines {
+		n++
+	}
+	is.Equal(n, subscriberLines)
+}